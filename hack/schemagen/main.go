@@ -0,0 +1,28 @@
+// schemagen writes the JSON schemas of git-promotion.yaml for all apiVersions to the directory given as argument
+package main
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"keptn/git-promotion-service/pkg/config"
+)
+
+func main() {
+	if len(os.Args) != 2 {
+		log.Fatalf("usage: %s <directory>", os.Args[0])
+	}
+	for _, apiVersion := range config.SchemaVersions() {
+		schema, err := config.JSONSchema(apiVersion)
+		if err != nil {
+			log.Fatal(err)
+		}
+		file := filepath.Join(os.Args[1], config.SchemaFileName(apiVersion))
+		if err := os.WriteFile(file, append(schema, '\n'), 0644); err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("%s written", strings.TrimPrefix(file, "./"))
+	}
+}
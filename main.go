@@ -3,15 +3,19 @@ package main
 import (
 	"context"
 	"fmt"
+	"keptn/git-promotion-service/pkg/cli"
 	"keptn/git-promotion-service/pkg/handler"
+	"keptn/git-promotion-service/pkg/secrets"
 	"log"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"sync"
 	"syscall"
 
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
 
 	cloudevents "github.com/cloudevents/sdk-go/v2"
 	"github.com/kelseyhightower/envconfig"
@@ -27,9 +31,18 @@ import (
 var keptnOptions = keptn.KeptnOpts{}
 var env envConfig
 
+// secretSource is created once at startup and shared by all events
+var secretSource secrets.Source
+
 const envVarLogLevel = "LOG_LEVEL"
 const ServiceName = "git-promotion-service"
 
+const (
+	secretSourceKubernetes = "kubernetes"
+	secretSourceDirectory  = "directory"
+	secretSourceEnv        = "env"
+)
+
 type envConfig struct {
 	// Port on which to listen for cloudevents
 	Port int `envconfig:"RCV_PORT" default:"8080"`
@@ -39,6 +52,16 @@ type envConfig struct {
 	KeptnAPIURL string `envconfig:"KEPTN_API_URL" required:"true"`
 	// The token of the keptn API
 	KeptnAPIToken string `envconfig:"KEPTN_API_TOKEN" required:"true"`
+	// Source of the secrets: kubernetes, directory or env
+	SecretSource string `envconfig:"SECRET_SOURCE" default:"kubernetes"`
+	// Directory with a subdirectory per secret for the secret source directory
+	SecretDir string `envconfig:"SECRET_DIR" default:"/etc/git-promotion-service/secrets"`
+	// Namespace of the secrets for the secret source kubernetes, defaults to the namespace of the kubeconfig context
+	Namespace string `envconfig:"K8S_NAMESPACE"`
+	// Namespace whose secrets are watched and cached for the secret source kubernetes, other secrets are read on every event
+	WatchNamespace string `envconfig:"SECRET_WATCH_NAMESPACE"`
+	// Kubeconfig used outside of the cluster, a list of files like for kubectl, defaults to ~/.kube/config
+	Kubeconfig string `envconfig:"KUBECONFIG"`
 }
 
 // Opaque key type used for graceful shutdown context value
@@ -47,6 +70,9 @@ type gracefulShutdownKeyType struct{}
 var gracefulShutdownKey = gracefulShutdownKeyType{}
 
 func main() {
+	if len(os.Args) > 1 && cli.IsCommand(os.Args[1]) {
+		os.Exit(cli.Run(os.Args[1:], os.Stdout, os.Stderr))
+	}
 	logger.SetLevel(logger.InfoLevel)
 	logger.Printf("Starting keptn git promotion service")
 	if os.Getenv(envVarLogLevel) != "" {
@@ -71,6 +97,11 @@ func _main(args []string, env envConfig) int {
 
 	keptnOptions.ConfigurationServiceURL = fmt.Sprintf("%s/resource-service", env.KeptnAPIURL)
 
+	var err error
+	if secretSource, err = newSecretSource(env); err != nil {
+		log.Fatalf("failed to initialize secret source, %v", err)
+	}
+
 	p, err := cloudevents.NewHTTP(cloudevents.WithPath(env.Path), cloudevents.WithPort(env.Port), cloudevents.WithGetHandlerFunc(keptnapi.HealthEndpointHandler))
 	if err != nil {
 		log.Fatalf("failed to create client, %v", err)
@@ -79,7 +110,12 @@ func _main(args []string, env envConfig) int {
 	if err != nil {
 		log.Fatalf("failed to create client, %v", err)
 	}
-	log.Fatal(c.StartReceiver(ctx, gotEvent))
+	err = c.StartReceiver(ctx, gotEvent)
+	// the informers of the secret cache are stopped when the receiver exits
+	if cache, ok := secretSource.(*secrets.Cache); ok {
+		cache.Stop()
+	}
+	log.Fatal(err)
 
 	return 0
 }
@@ -118,19 +154,8 @@ func switchEvent(ctx context.Context, event cloudevents.Event) {
 		return
 	}
 
-	config, err := rest.InClusterConfig()
-	if err != nil {
-		logger.WithError(err).Error("failed to initialize kube client rest")
-		return
-	}
-	kubeAPI, err := kubernetes.NewForConfig(config)
-	if err != nil {
-		logger.WithError(err).Error("failed to initialize kube client config")
-		return
-	}
-
 	handlers := []handler.Handler{
-		handler.NewGitPromotionTriggeredEventHandler(keptnHandlerV2, apiSet, kubeAPI),
+		handler.NewGitPromotionTriggeredEventHandler(keptnHandlerV2, apiSet, secretSource),
 	}
 
 	unhandled := true
@@ -146,9 +171,57 @@ func switchEvent(ctx context.Context, event cloudevents.Event) {
 	}
 }
 
+// newSecretSource returns the secret source configured with SECRET_SOURCE
+func newSecretSource(env envConfig) (secrets.Source, error) {
+	switch env.SecretSource {
+	case secretSourceKubernetes:
+		kubeClient, namespace, err := newKubeClient(env.Kubeconfig)
+		if err != nil {
+			return nil, err
+		}
+		if env.Namespace != "" {
+			namespace = env.Namespace
+		}
+		logger.Infof("reading secrets of namespace %s, caching secrets of namespace %q", namespace, env.WatchNamespace)
+		return secrets.NewCache(kubeClient, namespace, env.WatchNamespace), nil
+	case secretSourceDirectory:
+		logger.Infof("reading secrets from directory %s", env.SecretDir)
+		return secrets.NewDirectory(env.SecretDir), nil
+	case secretSourceEnv:
+		logger.Infof("reading secrets from environment variables %s*", secrets.DefaultEnvPrefix)
+		return secrets.NewEnv(secrets.DefaultEnvPrefix), nil
+	default:
+		return nil, fmt.Errorf("unknown secret source %s, must be %s, %s or %s", env.SecretSource, secretSourceKubernetes, secretSourceDirectory, secretSourceEnv)
+	}
+}
+
+// newKubeClient returns a client for the cluster the service runs in or, outside of the cluster or with kubeconfig
+// set, for the current context of the kubeconfig. The namespace is the one of the service account or the context
+func newKubeClient(kubeconfig string) (client *kubernetes.Clientset, namespace string, err error) {
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	if kubeconfig != "" {
+		// like kubectl, KUBECONFIG may be a list of files that are merged
+		loadingRules.Precedence = filepath.SplitList(kubeconfig)
+	}
+	clientConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, &clientcmd.ConfigOverrides{})
+	config, err := rest.InClusterConfig()
+	if kubeconfig != "" || err == rest.ErrNotInCluster {
+		if config, err = clientConfig.ClientConfig(); err != nil {
+			return nil, "", fmt.Errorf("could not load kubeconfig: %w", err)
+		}
+	} else if err != nil {
+		return nil, "", err
+	}
+	if namespace, _, err = clientConfig.Namespace(); err != nil {
+		return nil, "", err
+	}
+	client, err = kubernetes.NewForConfig(config)
+	return client, namespace, err
+}
+
 func getGracefulContext() context.Context {
 
-	ch := make(chan os.Signal)
+	ch := make(chan os.Signal, 1)
 	signal.Notify(ch, syscall.SIGINT, syscall.SIGTERM)
 	wg := &sync.WaitGroup{}
 	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), gracefulShutdownKey, wg))
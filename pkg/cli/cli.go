@@ -0,0 +1,180 @@
+package cli
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+	logger "github.com/sirupsen/logrus"
+	"keptn/git-promotion-service/pkg/config"
+	"keptn/git-promotion-service/pkg/model"
+	"keptn/git-promotion-service/pkg/placeholder"
+	"keptn/git-promotion-service/pkg/replacer"
+)
+
+const (
+	exitOK       = 0
+	exitFindings = 1
+	exitUsage    = 2
+
+	envVarLogLevel = "LOG_LEVEL"
+	// fallbackValue replaces the placeholders of event fields while validating without event. The builtin
+	// placeholders are replaced by their names
+	fallbackValue = "placeholder"
+)
+
+// command runs a subcommand with the arguments following the name of the command and returns the exit code
+type command func(args []string, stdout, stderr io.Writer) int
+
+var commands = map[string]command{
+	"validate": runValidate,
+	"render":   runRender,
+	"diff":     runDiff,
+	"replay":   runReplay,
+}
+
+// IsCommand returns true if name is one of the subcommands (validate, render, diff, replay)
+func IsCommand(name string) bool {
+	_, ok := commands[name]
+	return ok
+}
+
+// Run executes the subcommand args[0]. The subcommands work without Kubernetes, replay reads the
+// configuration from files or the Keptn API
+func Run(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 || !IsCommand(args[0]) {
+		fmt.Fprintln(stderr, "usage: git-promotion-service validate|render|diff|replay [flags]")
+		return exitUsage
+	}
+	// the log of the promotion goes to stderr, only warnings are shown unless LOG_LEVEL is set
+	logger.SetOutput(stderr)
+	logger.SetLevel(logger.WarnLevel)
+	if level, err := logger.ParseLevel(os.Getenv(envVarLogLevel)); err == nil {
+		logger.SetLevel(level)
+	}
+	return commands[args[0]](args[1:], stdout, stderr)
+}
+
+// stringList is a flag which can be given multiple times
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+func runValidate(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("validate", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "usage: git-promotion-service validate [flags] git-promotion.yaml...")
+		fmt.Fprintln(stderr, "Merges the configuration files in the given order (project, stage, service) and validates the result.")
+		flags.PrintDefaults()
+	}
+	eventFile := flags.String("event", "", "CloudEvent (JSON) used to resolve the placeholders. Without event all placeholders are accepted")
+	nextStage := flags.String("next-stage", "", "value of the placeholder ${nextstage}")
+	output := flags.String("o", "text", "output format of the findings: text or json")
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if flags.NArg() == 0 || (*output != "text" && *output != "json") {
+		flags.Usage()
+		return exitUsage
+	}
+	effective, err := mergeFiles(flags.Args())
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitUsage
+	}
+	var resolver placeholder.Resolver
+	if *eventFile == "" {
+		resolver = placeholder.NewResolver(config.Builtins("project", "stage", "nextstage", "service"), nil).WithFallback(fallbackValue)
+	} else {
+		e, err := readEvent(*eventFile)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return exitUsage
+		}
+		resolver = e.resolver(*nextStage)
+	}
+	_, findings := config.ResolveAndValidate(effective.Config, resolver)
+	findings = append(effective.Findings, findings...)
+	if err := printFindings(stdout, *output, findings); err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitUsage
+	}
+	if len(model.Errors(findings)) > 0 {
+		return exitFindings
+	}
+	return exitOK
+}
+
+func printFindings(w io.Writer, output string, findings []model.Finding) error {
+	if output == "json" {
+		if findings == nil {
+			findings = []model.Finding{}
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(findings)
+	}
+	if len(findings) == 0 {
+		fmt.Fprintln(w, "configuration is valid")
+	}
+	for _, f := range findings {
+		fmt.Fprintf(w, "%s: %s (%s)\n", f.Severity, f.String(), f.Code)
+	}
+	return nil
+}
+
+// mergeFiles merges the configuration files as layers in the given order. The file names are used as level in the
+// provenance
+func mergeFiles(files []string) (config.EffectiveConfig, error) {
+	var layers []config.ConfigLayer
+	for _, f := range files {
+		content, err := os.ReadFile(f)
+		if err != nil {
+			return config.EffectiveConfig{}, fmt.Errorf("could not read configuration: %w", err)
+		}
+		layers = append(layers, config.ConfigLayer{Level: f, Content: content})
+	}
+	return config.MergeLayers(layers)
+}
+
+// triggeredEvent is a git-promotion.triggered event read from a file
+type triggeredEvent struct {
+	event  cloudevents.Event
+	data   keptnv2.EventData
+	fields map[string]string
+	values map[string]interface{}
+}
+
+func readEvent(file string) (e triggeredEvent, err error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return e, fmt.Errorf("could not read event: %w", err)
+	}
+	if err := json.Unmarshal(content, &e.event); err != nil {
+		return e, fmt.Errorf("could not parse event %s: %w", file, err)
+	}
+	if err := e.event.DataAs(&e.data); err != nil {
+		return e, fmt.Errorf("could not parse data of event %s: %w", file, err)
+	}
+	if e.fields, e.values, err = replacer.ConvertToMap(e.event); err != nil {
+		return e, fmt.Errorf("could not read data of event %s: %w", file, err)
+	}
+	return e, nil
+}
+
+func (e triggeredEvent) resolver(nextStage string) placeholder.Resolver {
+	return placeholder.NewResolver(config.Builtins(e.data.GetProject(), e.data.GetStage(), nextStage, e.data.GetService()), e.fields)
+}
@@ -0,0 +1,149 @@
+package cli
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testConfig = `apiVersion: keptn.sh/v2
+kind: GitPromotionConfig
+metadata:
+  name: ${project}
+spec:
+  strategy: flat-pr
+  nextStages: [staging]
+  target:
+    repo: https://github.com/test/repo
+    secret: gke-${project}
+    provider: github
+  paths:
+    - source: ${stage}
+      target: ${nextstage}
+`
+
+const testEvent = `{"specversion":"1.0","id":"1","source":"test","type":"sh.keptn.event.git-promotion.triggered",
+"shkeptncontext":"ctx","datacontenttype":"application/json","data":{"project":"prj","stage":"dev","service":"svc","image":{"tag":"2.0"}}}`
+
+func writeFiles(t *testing.T, files map[string]string) string {
+	dir := t.TempDir()
+	for file, content := range files {
+		if err := os.MkdirAll(filepath.Join(dir, filepath.Dir(file)), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, file), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestRun(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"git-promotion.yaml":           testConfig,
+		"invalid.yaml":                 "spec:\n  strategy: flat-pr\n",
+		"event.json":                   testEvent,
+		"repo/dev/values.yaml":         "image: 1.0 # {\"keptn.git-promotion.replacewith\":\"data.image.tag\"}\nreplicas: 1\n",
+		"repo/staging/values.yaml":     "image: 0.9 # {\"keptn.git-promotion.replacewith\":\"data.image.tag\"}\nreplicas: 1\n",
+		"repo/staging/old.yaml":        "old: true\n",
+		"secrets/gke-prj/access-token": "token",
+	})
+	config, event, repo := filepath.Join(dir, "git-promotion.yaml"), filepath.Join(dir, "event.json"), filepath.Join(dir, "repo")
+	tests := []struct {
+		name       string
+		args       []string
+		env        map[string]string
+		wantCode   int
+		wantStdout string
+	}{
+		{
+			name:       "validate without event",
+			args:       []string{"validate", config},
+			wantCode:   exitOK,
+			wantStdout: "configuration is valid\n",
+		},
+		{
+			name:       "validate invalid configuration",
+			args:       []string{"validate", "-o", "json", filepath.Join(dir, "invalid.yaml")},
+			wantCode:   exitFindings,
+			wantStdout: `"path": "spec.target.repo"`,
+		},
+		{
+			name:     "validate missing file",
+			args:     []string{"validate", filepath.Join(dir, "missing.yaml")},
+			wantCode: exitUsage,
+		},
+		{
+			name:     "render without repo",
+			args:     []string{"render", "--event", event, "--config", config},
+			wantCode: exitUsage,
+		},
+		{
+			name:       "render",
+			args:       []string{"render", "--event", event, "--repo", repo, "--config", config},
+			wantCode:   exitOK,
+			wantStdout: "==> staging/old.yaml (deleted) <==\n==> staging/values.yaml <==\nimage: 2.0 # {\"keptn.git-promotion.replacewith\":\"data.image.tag\"}\nreplicas: 1\n",
+		},
+		{
+			name:     "diff",
+			args:     []string{"diff", "--event", event, "--repo", repo, "--config", config, "--exit-code"},
+			wantCode: exitFindings,
+			wantStdout: `--- a/staging/old.yaml
++++ /dev/null
+@@ -1 +0,0 @@
+-old: true
+--- a/staging/values.yaml
++++ b/staging/values.yaml
+@@ -1,2 +1,2 @@
+-image: 0.9 # {"keptn.git-promotion.replacewith":"data.image.tag"}
++image: 2.0 # {"keptn.git-promotion.replacewith":"data.image.tag"}
+ replicas: 1
+`,
+		},
+		{
+			name:     "diff to unknown stage without shipyard",
+			args:     []string{"diff", "--event", event, "--repo", repo, "--config", filepath.Join(dir, "invalid.yaml")},
+			wantCode: exitUsage,
+		},
+		{
+			name:     "replay without configuration",
+			args:     []string{"replay", "--event", event, "--repo", repo, "--keptn-api-url", ""},
+			wantCode: exitUsage,
+		},
+		{
+			name:       "replay",
+			args:       []string{"replay", "--event", event, "--repo", repo, "--config", config},
+			env:        map[string]string{"GIT_PROMOTION_SECRET_GKE_PRJ__access-token": "token"},
+			wantCode:   exitOK,
+			wantStdout: "repository: CreatePullRequest(promote/dev_staging-ctx, main, \"keptn: Promote to stage staging (ctx: ctx)\") => #1 memory://pull/1\n",
+		},
+		{
+			name:       "replay with secret directory",
+			args:       []string{"replay", "--event", event, "--repo", repo, "--config", config, "--secret-dir", filepath.Join(dir, "secrets")},
+			wantCode:   exitOK,
+			wantStdout: "repository: CreatePullRequest(promote/dev_staging-ctx, main, \"keptn: Promote to stage staging (ctx: ctx)\") => #1 memory://pull/1\n",
+		},
+		{
+			name:       "replay without secret",
+			args:       []string{"replay", "--event", event, "--repo", repo, "--config", config},
+			wantCode:   exitFindings,
+			wantStdout: "event sh.keptn.event.git-promotion.finished:",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			var stdout, stderr bytes.Buffer
+			if code := Run(tt.args, &stdout, &stderr); code != tt.wantCode {
+				t.Errorf("Run() = %v, want %v, stderr: %s", code, tt.wantCode, stderr.String())
+			}
+			if !strings.Contains(stdout.String(), tt.wantStdout) {
+				t.Errorf("Run() stdout = %v, want %v", stdout.String(), tt.wantStdout)
+			}
+		})
+	}
+}
@@ -0,0 +1,142 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"keptn/git-promotion-service/pkg/handler"
+	"keptn/git-promotion-service/pkg/repoaccess"
+)
+
+// recordingSender prints the events sent by the handler instead of sending them
+type recordingSender struct {
+	w      io.Writer
+	events []cloudevents.Event
+}
+
+func (s *recordingSender) SendEvent(event cloudevents.Event) error {
+	return s.Send(context.Background(), event)
+}
+
+func (s *recordingSender) Send(_ context.Context, event cloudevents.Event) error {
+	s.events = append(s.events, event)
+	content, err := json.MarshalIndent(event, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(s.w, "event %s:\n%s\n", event.Type(), content)
+	return nil
+}
+
+// recordingRepository prints every operation on the repository with its result
+type recordingRepository struct {
+	next handler.RepositoryClient
+	w    io.Writer
+}
+
+func (r recordingRepository) record(err error, operation string, result interface{}) {
+	if err != nil {
+		fmt.Fprintf(r.w, "repository: %s => error: %v\n", operation, err)
+	} else if result != nil {
+		fmt.Fprintf(r.w, "repository: %s => %v\n", operation, result)
+	} else {
+		fmt.Fprintf(r.w, "repository: %s\n", operation)
+	}
+}
+
+func (r recordingRepository) BranchExists(branchName string) (exists bool, err error) {
+	exists, err = r.next.BranchExists(branchName)
+	r.record(err, fmt.Sprintf("BranchExists(%s)", branchName), exists)
+	return exists, err
+}
+
+func (r recordingRepository) CreateBranch(sourceBranch, targetBranch string) (err error) {
+	err = r.next.CreateBranch(sourceBranch, targetBranch)
+	r.record(err, fmt.Sprintf("CreateBranch(%s, %s)", sourceBranch, targetBranch), nil)
+	return err
+}
+
+func (r recordingRepository) DeleteBranch(branch string) (err error) {
+	err = r.next.DeleteBranch(branch)
+	r.record(err, fmt.Sprintf("DeleteBranch(%s)", branch), nil)
+	return err
+}
+
+func (r recordingRepository) GetFilesForBranch(branch, path string) (files []repoaccess.RepositoryFile, err error) {
+	files, err = r.next.GetFilesForBranch(branch, path)
+	r.record(err, fmt.Sprintf("GetFilesForBranch(%s, %s)", branch, path), filePaths(files))
+	return files, err
+}
+
+func (r recordingRepository) SyncFilesWithBranch(branch, message string, currentTargetFiles, newTargetFiles []repoaccess.RepositoryFile) (changes int, err error) {
+	changes, err = r.next.SyncFilesWithBranch(branch, message, currentTargetFiles, newTargetFiles)
+	r.record(err, fmt.Sprintf("SyncFilesWithBranch(%s, %q, current %v, new %v)", branch, message, filePaths(currentTargetFiles), filePaths(newTargetFiles)), fmt.Sprintf("%d changes", changes))
+	return changes, err
+}
+
+func (r recordingRepository) CheckForNewCommits(toBranch, fromBranch string) (newCommits bool, err error) {
+	newCommits, err = r.next.CheckForNewCommits(toBranch, fromBranch)
+	r.record(err, fmt.Sprintf("CheckForNewCommits(%s, %s)", toBranch, fromBranch), newCommits)
+	return newCommits, err
+}
+
+func (r recordingRepository) CompareBranches(toBranch, fromBranch string) (files []repoaccess.ChangedFile, err error) {
+	files, err = r.next.CompareBranches(toBranch, fromBranch)
+	paths := make([]string, 0, len(files))
+	for _, f := range files {
+		paths = append(paths, f.Path)
+	}
+	r.record(err, fmt.Sprintf("CompareBranches(%s, %s)", toBranch, fromBranch), "["+strings.Join(paths, " ")+"]")
+	return files, err
+}
+
+func (r recordingRepository) GetOpenPullRequest(fromBranch, toBranch string) (pr *repoaccess.PullRequest, err error) {
+	pr, err = r.next.GetOpenPullRequest(fromBranch, toBranch)
+	r.record(err, fmt.Sprintf("GetOpenPullRequest(%s, %s)", fromBranch, toBranch), pullRequestString(pr))
+	return pr, err
+}
+
+func (r recordingRepository) EditPullRequest(pr *repoaccess.PullRequest, title, body string) error {
+	err := r.next.EditPullRequest(pr, title, body)
+	r.record(err, fmt.Sprintf("EditPullRequest(%s, %q)", pullRequestString(pr), title), nil)
+	return err
+}
+
+func (r recordingRepository) CreatePullRequest(fromBranch, toBranch, title, body string) (pr *repoaccess.PullRequest, err error) {
+	pr, err = r.next.CreatePullRequest(fromBranch, toBranch, title, body)
+	r.record(err, fmt.Sprintf("CreatePullRequest(%s, %s, %q)", fromBranch, toBranch, title), pullRequestString(pr))
+	return pr, err
+}
+
+func (r recordingRepository) AddLabels(pr *repoaccess.PullRequest, labels []string) error {
+	err := r.next.AddLabels(pr, labels)
+	r.record(err, fmt.Sprintf("AddLabels(%s, %v)", pullRequestString(pr), labels), nil)
+	return err
+}
+
+// Close closes the repository if it is an io.Closer (e.g. a repository accessed over SSH)
+func (r recordingRepository) Close() error {
+	if closer, ok := r.next.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+func filePaths(files []repoaccess.RepositoryFile) string {
+	paths := make([]string, 0, len(files))
+	for _, f := range files {
+		paths = append(paths, f.Path)
+	}
+	return "[" + strings.Join(paths, " ") + "]"
+}
+
+func pullRequestString(pr *repoaccess.PullRequest) string {
+	if pr == nil {
+		return "none"
+	}
+	return fmt.Sprintf("#%d %s", pr.Number, pr.URL)
+}
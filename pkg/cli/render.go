@@ -0,0 +1,218 @@
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/keptn/go-utils/pkg/api/models"
+	"keptn/git-promotion-service/pkg/config"
+	"keptn/git-promotion-service/pkg/handler"
+	"keptn/git-promotion-service/pkg/model"
+	"keptn/git-promotion-service/pkg/promoter"
+	"keptn/git-promotion-service/pkg/replacer"
+	"keptn/git-promotion-service/pkg/repoaccess"
+)
+
+// sourceBranch is the branch the flat-pr strategy reads the files from (ignored by the local repository)
+const sourceBranch = "main"
+
+// planOptions are the flags shared by render and diff
+type planOptions struct {
+	eventFile   string
+	repo        string
+	configFiles stringList
+	nextStage   string
+	shipyard    string
+}
+
+func (o *planOptions) register(flags *flag.FlagSet) {
+	flags.StringVar(&o.eventFile, "event", "", "git-promotion.triggered CloudEvent (JSON) (required)")
+	flags.StringVar(&o.repo, "repo", "", "local checkout of the target repository (required)")
+	flags.Var(&o.configFiles, "config", "configuration file, can be given multiple times to merge project, stage and service layers (default git-promotion.yaml)")
+	flags.StringVar(&o.nextStage, "next-stage", "", "stage to promote to, overrides the stages of the configuration and the shipyard")
+	flags.StringVar(&o.shipyard, "shipyard", "", "shipyard.yaml used to determine the next stages")
+}
+
+// stagePlan are the files the flat-pr strategy writes for a next stage
+type stagePlan struct {
+	stage string
+	files []promoter.FileChange
+}
+
+func runRender(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("render", flag.ContinueOnError)
+	var opts planOptions
+	opts.register(flags)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "usage: git-promotion-service render --event event.json --repo <local checkout> [flags]")
+		fmt.Fprintln(stderr, "Prints the files of the target paths as the flat-pr strategy would write them.")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	plans, code := plan(opts, flags, stderr)
+	if code != exitOK {
+		return code
+	}
+	for _, p := range plans {
+		for _, f := range p.files {
+			if f.New == nil {
+				fmt.Fprintf(stdout, "==> %s (deleted) <==\n", fileHeader(plans, p.stage, f.Path))
+				continue
+			}
+			fmt.Fprintf(stdout, "==> %s <==\n%s", fileHeader(plans, p.stage, f.Path), *f.New)
+			if len(*f.New) > 0 && (*f.New)[len(*f.New)-1] != '\n' {
+				fmt.Fprintln(stdout)
+			}
+		}
+	}
+	return exitOK
+}
+
+func runDiff(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("diff", flag.ContinueOnError)
+	var opts planOptions
+	opts.register(flags)
+	exitCode := flags.Bool("exit-code", false, "exit with 1 if there are changes")
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "usage: git-promotion-service diff --event event.json --repo <local checkout> [flags]")
+		fmt.Fprintln(stderr, "Prints the unified diff of the changes the flat-pr strategy would commit.")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	plans, code := plan(opts, flags, stderr)
+	if code != exitOK {
+		return code
+	}
+	changed := false
+	for _, p := range plans {
+		prefix := ""
+		if len(plans) > 1 {
+			prefix = p.stage + "/"
+		}
+		diff, err := promoter.UnifiedDiff(p.files, prefix)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return exitUsage
+		}
+		fmt.Fprint(stdout, diff)
+		changed = changed || diff != ""
+	}
+	if changed && *exitCode {
+		return exitFindings
+	}
+	return exitOK
+}
+
+// fileHeader returns the path of the file prefixed with the stage if files are rendered for multiple stages
+func fileHeader(plans []stagePlan, stage, path string) string {
+	if len(plans) > 1 {
+		return stage + ": " + path
+	}
+	return path
+}
+
+// plan reads the event and the configuration and plans the flat-pr promotion to every next stage using the local
+// checkout. The findings are written to stderr
+func plan(opts planOptions, flags *flag.FlagSet, stderr io.Writer) ([]stagePlan, int) {
+	if opts.eventFile == "" || opts.repo == "" || flags.NArg() > 0 {
+		flags.Usage()
+		return nil, exitUsage
+	}
+	if len(opts.configFiles) == 0 {
+		opts.configFiles = stringList{"git-promotion.yaml"}
+	}
+	event, err := readEvent(opts.eventFile)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return nil, exitUsage
+	}
+	effective, err := mergeFiles(opts.configFiles)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return nil, exitUsage
+	}
+	for _, f := range effective.Findings {
+		fmt.Fprintf(stderr, "%s: %s (%s)\n", f.Severity, f.String(), f.Code)
+	}
+	if len(model.Errors(effective.Findings)) > 0 {
+		return nil, exitFindings
+	}
+	nextStages, err := opts.nextStages(effective.Config.Spec, event.data.GetStage())
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return nil, exitUsage
+	}
+	if len(effective.Config.Spec.Enrichment.Events) > 0 {
+		fmt.Fprintln(stderr, "warning: spec.enrichment.events are not read offline")
+	}
+	if len(effective.Config.Spec.Replacement.Digests) > 0 {
+		fmt.Fprintln(stderr, "warning: spec.replacement.digests are not resolved offline")
+	}
+
+	var plans []stagePlan
+	failed := false
+	for _, nextStage := range nextStages {
+		resolved, findings := config.ResolveAndValidate(effective.Config, event.resolver(nextStage))
+		for _, f := range findings {
+			fmt.Fprintf(stderr, "%s: %s: %s (%s)\n", nextStage, f.Severity, f.String(), f.Code)
+		}
+		if len(model.Errors(findings)) > 0 {
+			failed = true
+			continue
+		}
+		if *resolved.Spec.Strategy != model.StrategyFlatPR {
+			fmt.Fprintf(stderr, "%s: strategy %s does not write files, only %s can be rendered\n", nextStage, *resolved.Spec.Strategy, model.StrategyFlatPR)
+			failed = true
+			continue
+		}
+		p := promoter.NewFlatPrPromoter(repoaccess.NewLocalRepository(opts.repo))
+		p.Values = event.values
+		p.ReportFinding = func(f model.Finding) {
+			fmt.Fprintf(stderr, "%s: %s: %s (%s)\n", nextStage, f.Severity, f.String(), f.Code)
+		}
+		files, report, err := p.Plan(replacer.CopyFields(event.fields), sourceBranch, resolved.Spec.Paths, resolved.Spec.Replacement)
+		if len(report.Annotations) > 0 || report.HasFindings() {
+			fmt.Fprintf(stderr, "%s: replacements: %s\n", nextStage, report.String())
+		}
+		if err != nil {
+			fmt.Fprintf(stderr, "%s: %v\n", nextStage, err)
+			failed = true
+			continue
+		}
+		plans = append(plans, stagePlan{stage: nextStage, files: files})
+	}
+	if failed {
+		return nil, exitFindings
+	}
+	return plans, exitOK
+}
+
+// nextStages returns the stage given with --next-stage or the next stages of the configuration or the shipyard file
+func (o planOptions) nextStages(spec model.PromotionConfigSpec, stage string) ([]string, error) {
+	if o.nextStage != "" {
+		return []string{o.nextStage}, nil
+	}
+	nextStages, err := handler.NextStages(spec, stage, func() (*models.Resource, error) {
+		if o.shipyard == "" {
+			return nil, errors.New("the configuration does not contain the next stage, use --next-stage or --shipyard")
+		}
+		content, err := os.ReadFile(o.shipyard)
+		if err != nil {
+			return nil, err
+		}
+		return &models.Resource{ResourceContent: string(content)}, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not determine next stage: %w", err)
+	}
+	return nextStages, nil
+}
@@ -0,0 +1,290 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/keptn/go-utils/pkg/api/models"
+	api "github.com/keptn/go-utils/pkg/api/utils/v2"
+	keptncommon "github.com/keptn/go-utils/pkg/lib/keptn"
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+	"keptn/git-promotion-service/pkg/config"
+	"keptn/git-promotion-service/pkg/handler"
+	"keptn/git-promotion-service/pkg/keptn"
+	"keptn/git-promotion-service/pkg/repoaccess"
+	"keptn/git-promotion-service/pkg/secrets"
+)
+
+const (
+	providerMemory = "memory"
+	providerBare   = "bare"
+	providerGithub = "github"
+
+	shipyardResource = "shipyard.yaml"
+)
+
+type replayOptions struct {
+	eventFile     string
+	projectConfig string
+	stageConfig   string
+	serviceConfig string
+	shipyard      string
+	eventsFile    string
+	keptnAPIURL   string
+	keptnAPIToken string
+	provider      string
+	repo          string
+	secretDir     string
+}
+
+func runReplay(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("replay", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "usage: git-promotion-service replay --event event.json [flags]")
+		fmt.Fprintln(stderr, "Handles the git-promotion.triggered event and prints the sent events and the repository operations.")
+		flags.PrintDefaults()
+	}
+	var opts replayOptions
+	flags.StringVar(&opts.eventFile, "event", "", "git-promotion.triggered CloudEvent (JSON) (required)")
+	flags.StringVar(&opts.projectConfig, "config", "", "project configuration file. Without configuration files the configuration and the shipyard are read from the keptn API")
+	flags.StringVar(&opts.stageConfig, "stage-config", "", "stage configuration file (optional)")
+	flags.StringVar(&opts.serviceConfig, "service-config", "", "service configuration file (optional)")
+	flags.StringVar(&opts.shipyard, "shipyard", "", "shipyard.yaml used with configuration files (optional)")
+	flags.StringVar(&opts.eventsFile, "events", "", "JSON list of earlier events of the sequence used with configuration files (optional)")
+	flags.StringVar(&opts.keptnAPIURL, "keptn-api-url", os.Getenv("KEPTN_API_URL"), "URL of the keptn API")
+	flags.StringVar(&opts.keptnAPIToken, "keptn-api-token", os.Getenv("KEPTN_API_TOKEN"), "token of the keptn API")
+	flags.StringVar(&opts.provider, "provider", providerMemory, "repository provider: memory (files of --repo in branch main), bare (bare git repository --repo) or github")
+	flags.StringVar(&opts.repo, "repo", "", "local checkout (memory) or bare repository (bare)")
+	flags.StringVar(&opts.secretDir, "secret-dir", "", "directory with the secrets as files <secret>/<key>. Without directory the secrets are read from the environment variables "+secrets.DefaultEnvPrefix+"<SECRET>__<key>")
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if opts.eventFile == "" || flags.NArg() > 0 || (opts.provider != providerGithub && opts.repo == "") {
+		flags.Usage()
+		return exitUsage
+	}
+
+	e, err := readEvent(opts.eventFile)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitUsage
+	}
+	if _, err := e.event.Context.GetExtension("shkeptncontext"); err != nil {
+		e.event.SetExtension("shkeptncontext", uuid.New().String())
+	}
+	dependencies, err := opts.dependencies(stdout)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitUsage
+	}
+	sender := &recordingSender{w: stdout}
+	keptnHandler, err := keptnv2.NewKeptn(&e.event, keptncommon.KeptnOpts{EventSender: sender})
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitUsage
+	}
+	h := handler.NewGitPromotionTriggeredEventHandlerWithDependencies(keptnHandler, dependencies)
+	if !h.IsTypeHandled(e.event) {
+		fmt.Fprintf(stderr, "event type %s is not handled, must be %s\n", e.event.Type(), keptnv2.GetTriggeredEventType(handler.GitPromotionTaskName))
+		return exitUsage
+	}
+	h.Handle(e.event, keptnHandler)
+
+	for _, sent := range sender.events {
+		var data keptnv2.EventData
+		if sent.Type() == keptnv2.GetFinishedEventType(handler.GitPromotionTaskName) && sent.DataAs(&data) == nil && data.Result == keptnv2.ResultFailed {
+			return exitFindings
+		}
+	}
+	return exitOK
+}
+
+// dependencies returns the sources of the handler selected by the options. Repository operations are printed to w
+func (o replayOptions) dependencies(w io.Writer) (dependencies handler.Dependencies, err error) {
+	if o.projectConfig != "" || o.stageConfig != "" || o.serviceConfig != "" {
+		resources := fileResources{}
+		for key, file := range map[string]string{
+			config.LevelProject: o.projectConfig,
+			config.LevelStage:   o.stageConfig,
+			config.LevelService: o.serviceConfig,
+			shipyardResource:    o.shipyard,
+		} {
+			if file == "" {
+				continue
+			}
+			if resources[key], err = os.ReadFile(file); err != nil {
+				return dependencies, err
+			}
+		}
+		dependencies.Resources = resources
+		events := fileEvents{}
+		if o.eventsFile != "" {
+			content, err := os.ReadFile(o.eventsFile)
+			if err != nil {
+				return dependencies, err
+			}
+			if err := json.Unmarshal(content, &events.events); err != nil {
+				return dependencies, fmt.Errorf("could not parse events %s: %w", o.eventsFile, err)
+			}
+		}
+		dependencies.Events = events
+	} else if o.keptnAPIURL != "" {
+		apiSet, err := api.New(o.keptnAPIURL, api.WithAuthToken(o.keptnAPIToken))
+		if err != nil {
+			return dependencies, fmt.Errorf("could not create keptn API client: %w", err)
+		}
+		dependencies.Resources, dependencies.Events = apiSet.Resources(), apiSet.Events()
+	} else {
+		return dependencies, errors.New("either --config or --keptn-api-url is required")
+	}
+
+	// the secrets are not passed as arguments, which are visible to other processes
+	if o.secretDir != "" {
+		dependencies.Secrets = secrets.NewDirectory(o.secretDir)
+	} else {
+		dependencies.Secrets = secrets.NewEnv(secrets.DefaultEnvPrefix)
+	}
+	dependencies.SecretNamespaces = handler.AllowedSecretNamespaces()
+
+	var repository handler.RepositoryClient
+	switch o.provider {
+	case providerMemory:
+		memory := repoaccess.NewMemoryRepository()
+		if err := seedMemoryRepository(memory, o.repo); err != nil {
+			return dependencies, err
+		}
+		repository = memory
+	case providerBare:
+		repository = repoaccess.NewBareRepository(o.repo)
+	case providerGithub:
+	default:
+		return dependencies, fmt.Errorf("unknown provider %s, must be %s, %s or %s", o.provider, providerMemory, providerBare, providerGithub)
+	}
+	dependencies.NewRepository = func(credentials handler.RepositoryCredentials, repositoryURL string) (handler.RepositoryClient, error) {
+		if repository == nil {
+			client, err := handler.NewGithubRepository(credentials, repositoryURL)
+			if err != nil {
+				return nil, err
+			}
+			return recordingRepository{next: client, w: w}, nil
+		}
+		return recordingRepository{next: repository, w: w}, nil
+	}
+	return dependencies, nil
+}
+
+// seedMemoryRepository adds the files of the local checkout to the branch main. The .git directory is skipped
+func seedMemoryRepository(memory *repoaccess.MemoryRepository, dir string) error {
+	files, err := repoaccess.NewLocalRepository(dir).GetFilesForBranch("", "")
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("no files found in %s: %w", dir, fs.ErrNotExist)
+	}
+	for _, f := range files {
+		memory.SetFile(sourceBranch, f.Path, f.Content)
+	}
+	return nil
+}
+
+// fileResources serves the configuration layers (by level) and the shipyard read from files. Only GetResource is
+// implemented
+type fileResources map[string][]byte
+
+func (r fileResources) GetResource(_ context.Context, scope api.ResourceScope, _ api.ResourcesGetResourceOptions) (*models.Resource, error) {
+	name := strings.TrimPrefix(scope.GetResourcePath(), "/resource/")
+	for i := 0; i < 2; i++ {
+		if unescaped, err := url.QueryUnescape(name); err == nil {
+			name = unescaped
+		}
+	}
+	key := name
+	if name != shipyardResource {
+		switch {
+		case scope.GetServicePath() != "":
+			key = config.LevelService
+		case scope.GetStagePath() != "":
+			key = config.LevelStage
+		default:
+			key = config.LevelProject
+		}
+	}
+	content, ok := r[key]
+	if !ok {
+		return nil, api.ResourceNotFoundError
+	}
+	return &models.Resource{ResourceURI: &name, ResourceContent: string(content)}, nil
+}
+
+func (r fileResources) CreateResources(context.Context, string, string, string, []*models.Resource, api.ResourcesCreateResourcesOptions) (*models.EventContext, *models.Error) {
+	return nil, &models.Error{Message: stringPtr("not implemented")}
+}
+
+func (r fileResources) CreateProjectResources(context.Context, string, []*models.Resource, api.ResourcesCreateProjectResourcesOptions) (string, error) {
+	return "", errors.New("not implemented")
+}
+
+func (r fileResources) UpdateProjectResources(context.Context, string, []*models.Resource, api.ResourcesUpdateProjectResourcesOptions) (string, error) {
+	return "", errors.New("not implemented")
+}
+
+func (r fileResources) UpdateServiceResources(context.Context, string, string, string, []*models.Resource, api.ResourcesUpdateServiceResourcesOptions) (string, error) {
+	return "", errors.New("not implemented")
+}
+
+func (r fileResources) GetAllStageResources(context.Context, string, string, api.ResourcesGetAllStageResourcesOptions) ([]*models.Resource, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (r fileResources) GetAllServiceResources(context.Context, string, string, string, api.ResourcesGetAllServiceResourcesOptions) ([]*models.Resource, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (r fileResources) DeleteResource(context.Context, api.ResourceScope, api.ResourcesDeleteResourceOptions) error {
+	return errors.New("not implemented")
+}
+
+func (r fileResources) UpdateResource(context.Context, *models.Resource, api.ResourceScope, api.ResourcesUpdateResourceOptions) (string, error) {
+	return "", errors.New("not implemented")
+}
+
+func (r fileResources) CreateResource(context.Context, []*models.Resource, api.ResourceScope, api.ResourcesCreateResourceOptions) (string, error) {
+	return "", errors.New("not implemented")
+}
+
+var _ keptn.ResourcesInterface = fileResources{}
+
+// fileEvents serves the earlier events of the sequence read from a file
+type fileEvents struct {
+	events []*models.KeptnContextExtendedCE
+}
+
+func (f fileEvents) GetEvents(_ context.Context, filter *api.EventFilter, _ api.EventsGetEventsOptions) ([]*models.KeptnContextExtendedCE, *models.Error) {
+	var found []*models.KeptnContextExtendedCE
+	for _, e := range f.events {
+		if e != nil && e.Type != nil && *e.Type == filter.EventType && (filter.KeptnContext == "" || e.Shkeptncontext == filter.KeptnContext) {
+			found = append(found, e)
+		}
+	}
+	return found, nil
+}
+
+func (f fileEvents) GetEventsWithRetry(_ context.Context, _ *api.EventFilter, _ int, _ time.Duration, _ api.EventsGetEventsWithRetryOptions) ([]*models.KeptnContextExtendedCE, error) {
+	return nil, errors.New("not implemented")
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
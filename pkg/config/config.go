@@ -1,53 +1,94 @@
 package config
 
 import (
-	"gopkg.in/yaml.v2"
-)
-
-type PromotionConfigValidator interface {
-	Validate(config PromotionConfig) (validationErrors []string)
-}
+	"fmt"
+	"regexp"
+	"strings"
 
-const (
-	StrategyBranch string = "branch"
-	StrategyFlatPR        = "flat-pr"
+	"gopkg.in/yaml.v2"
+	"keptn/git-promotion-service/pkg/model"
 )
 
-type PromotionConfig struct {
-	APIVersion *string             `yaml:"apiVersion"`
-	Kind       *string             `yaml:"kind"`
-	Spec       PromotionConfigSpec `yaml:"spec"`
-}
-
-type Metadata struct {
-	Name string `yaml:"name"`
+// header contains the fields to select the version of the configuration
+type header struct {
+	APIVersion *string `yaml:"apiVersion"`
+	Kind       *string `yaml:"kind"`
 }
 
-type PromotionConfigSpec struct {
-	Strategy *string `yaml:"strategy"`
-	Target   Target  `yaml:"target"`
-	Paths    []Path  `yaml:"paths"`
+// v2Fields are the fields (by the keptn.sh/v1 type and the yaml name) only supported in keptn.sh/v2 with their path.
+// They are errors in keptn.sh/v1 because ignoring them changes the behavior of the promotion (e.g. spec.dryRun)
+var v2Fields = map[string]string{
+	"PromotionConfigSpecV1.nextStages": "spec.nextStages",
+	"PromotionConfigSpecV1.dryRun":     "spec.dryRun",
+	"TargetV1.secretKey":               "spec.target.secretKey",
+	"TargetV1.secretNamespace":         "spec.target.secretNamespace",
 }
 
-type Target struct {
-	Repo     *string `yaml:"repo"`
-	Secret   *string `yaml:"secret"`
-	Provider *string `yaml:"provider"`
-}
+// unknownFieldPattern matches the errors of yaml.UnmarshalStrict for unknown fields
+var unknownFieldPattern = regexp.MustCompile(`^line (\d+): field (\S+) not found in type (\S+)$`)
 
-type Path struct {
-	Source *string `yaml:"source"`
-	Target *string `yaml:"target"`
-}
-
-func NewConfig(yamlContent []byte) (*PromotionConfig, error) {
-
-	promotionConfig := PromotionConfig{}
-	err := yaml.UnmarshalStrict(yamlContent, &promotionConfig)
-
-	if err != nil {
-		return nil, err
+// NewConfig parses the configuration and converts it to the latest version (keptn.sh/v2). Configurations without
+// apiVersion are parsed as keptn.sh/v1. Unknown versions and kinds are rejected. Unknown fields are rejected in
+// keptn.sh/v2 and returned as warnings in keptn.sh/v1, so existing configurations keep working. The fields only
+// supported in keptn.sh/v2 (see v2Fields) are errors in keptn.sh/v1
+func NewConfig(yamlContent []byte) (*model.PromotionConfig, []model.Finding, error) {
+	var h header
+	if err := yaml.Unmarshal(yamlContent, &h); err != nil {
+		return nil, nil, err
+	}
+	if h.Kind != nil && *h.Kind != model.KindGitPromotionConfig {
+		return nil, nil, fmt.Errorf("kind %s not supported, must be %s", *h.Kind, model.KindGitPromotionConfig)
+	}
+	apiVersion := model.APIVersionV1
+	if h.APIVersion != nil {
+		apiVersion = *h.APIVersion
 	}
 
-	return &promotionConfig, nil
+	switch apiVersion {
+	case model.APIVersionV1:
+		promotionConfig := model.PromotionConfigV1{}
+		err := yaml.UnmarshalStrict(yamlContent, &promotionConfig)
+		typeErr, ok := err.(*yaml.TypeError)
+		if err != nil && !ok {
+			return nil, nil, err
+		}
+		var findings []model.Finding
+		if ok {
+			var errs []string
+			for _, e := range typeErr.Errors {
+				m := unknownFieldPattern.FindStringSubmatch(e)
+				var v2Field string
+				if m != nil {
+					v2Field = v2Fields[m[3][strings.LastIndex(m[3], ".")+1:]+"."+m[2]]
+				}
+				switch {
+				case m == nil:
+					errs = append(errs, e)
+				case v2Field == "spec.nextStages":
+					findings = append(findings, model.NewError(model.FindingUnsupported, v2Field, "is only supported in %s, use spec.nextStage in %s", model.APIVersionV2, model.APIVersionV1))
+				case v2Field != "":
+					findings = append(findings, model.NewError(model.FindingUnsupported, v2Field, "is only supported in %s", model.APIVersionV2))
+				default:
+					findings = append(findings, model.NewWarning(model.FindingUnknownField, "", "unknown field %s in line %s is ignored (not supported in %s)", m[2], m[1], model.APIVersionV1))
+				}
+			}
+			if len(errs) > 0 {
+				return nil, nil, &yaml.TypeError{Errors: errs}
+			}
+			promotionConfig = model.PromotionConfigV1{}
+			if err := yaml.Unmarshal(yamlContent, &promotionConfig); err != nil {
+				return nil, nil, err
+			}
+		}
+		converted := promotionConfig.ConvertToV2()
+		return &converted, findings, nil
+	case model.APIVersionV2:
+		promotionConfig := model.PromotionConfig{}
+		if err := yaml.UnmarshalStrict(yamlContent, &promotionConfig); err != nil {
+			return nil, nil, err
+		}
+		return &promotionConfig, nil, nil
+	default:
+		return nil, nil, fmt.Errorf("apiVersion %s not supported, must be %s or %s", apiVersion, model.APIVersionV1, model.APIVersionV2)
+	}
 }
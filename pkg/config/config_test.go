@@ -0,0 +1,172 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+
+	"keptn/git-promotion-service/pkg/model"
+)
+
+func TestNewConfig(t *testing.T) {
+	tests := []struct {
+		name         string
+		content      string
+		want         *model.PromotionConfig
+		wantFindings []model.Finding
+		wantErr      bool
+	}{
+		{
+			name: "v1 with next stage",
+			content: `
+apiVersion: keptn.sh/v1
+kind: GitPromotionConfig
+metadata:
+  name: test
+spec:
+  strategy: branch
+  nextStage: production
+`,
+			want: &model.PromotionConfig{
+				APIVersion: stradr(model.APIVersionV2),
+				Kind:       stradr(model.KindGitPromotionConfig),
+				Metadata:   model.Metadata{Name: "test"},
+				Spec:       model.PromotionConfigSpec{Strategy: stradr("branch"), NextStages: []string{"production"}},
+			},
+		},
+		{
+			name:    "without version",
+			content: "spec:\n  strategy: branch\n",
+			want: &model.PromotionConfig{
+				APIVersion: stradr(model.APIVersionV2),
+				Kind:       stradr(model.KindGitPromotionConfig),
+				Spec:       model.PromotionConfigSpec{Strategy: stradr("branch")},
+			},
+		},
+		{
+			name:    "v2",
+			content: "apiVersion: keptn.sh/v2\nkind: GitPromotionConfig\nspec:\n  nextStages: [production]\n",
+			want: &model.PromotionConfig{
+				APIVersion: stradr(model.APIVersionV2),
+				Kind:       stradr(model.KindGitPromotionConfig),
+				Spec:       model.PromotionConfigSpec{NextStages: []string{"production"}},
+			},
+		},
+		{
+			name:    "v2 without next stage",
+			content: "apiVersion: keptn.sh/v2\nkind: GitPromotionConfig\nspec:\n  nextStage: production\n",
+			wantErr: true,
+		},
+		{
+			name:    "unknown field in v1",
+			content: "apiVersion: keptn.sh/v1\nspec:\n  strategi: branch\n  nextStage: production\n",
+			want: &model.PromotionConfig{
+				APIVersion: stradr(model.APIVersionV2),
+				Kind:       stradr(model.KindGitPromotionConfig),
+				Spec:       model.PromotionConfigSpec{NextStages: []string{"production"}},
+			},
+			wantFindings: []model.Finding{
+				model.NewWarning(model.FindingUnknownField, "", "unknown field strategi in line 3 is ignored (not supported in keptn.sh/v1)"),
+			},
+		},
+		{
+			name:    "v2 field in v1",
+			content: "spec:\n  dryRun: true\n  target:\n    secretKey: token\n    secretNamespace: secrets\n",
+			want: &model.PromotionConfig{
+				APIVersion: stradr(model.APIVersionV2),
+				Kind:       stradr(model.KindGitPromotionConfig),
+			},
+			wantFindings: []model.Finding{
+				model.NewError(model.FindingUnsupported, "spec.dryRun", "is only supported in keptn.sh/v2"),
+				model.NewError(model.FindingUnsupported, "spec.target.secretKey", "is only supported in keptn.sh/v2"),
+				model.NewError(model.FindingUnsupported, "spec.target.secretNamespace", "is only supported in keptn.sh/v2"),
+			},
+		},
+		{
+			name:    "next stages in v1",
+			content: "apiVersion: keptn.sh/v1\nspec:\n  nextStage: production\n  nextStages: [prod-eu, prod-us]\n",
+			want: &model.PromotionConfig{
+				APIVersion: stradr(model.APIVersionV2),
+				Kind:       stradr(model.KindGitPromotionConfig),
+				Spec:       model.PromotionConfigSpec{NextStages: []string{"production"}},
+			},
+			wantFindings: []model.Finding{
+				model.NewError(model.FindingUnsupported, "spec.nextStages", "is only supported in keptn.sh/v2, use spec.nextStage in keptn.sh/v1"),
+			},
+		},
+		{
+			name:    "type error in v1",
+			content: "apiVersion: keptn.sh/v1\nspec:\n  paths: path\n",
+			wantErr: true,
+		},
+		{
+			name:    "unknown field in v2",
+			content: "apiVersion: keptn.sh/v2\nspec:\n  strategi: branch\n",
+			wantErr: true,
+		},
+		{
+			name:    "unknown kind",
+			content: "apiVersion: keptn.sh/v1\nkind: JobConfig\n",
+			wantErr: true,
+		},
+		{
+			name:    "unknown version",
+			content: "apiVersion: v1\nkind: GitPromotionConfig\n",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, findings, err := NewConfig([]byte(tt.content))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("NewConfig() = %+v, want %+v", got, tt.want)
+			}
+			if !reflect.DeepEqual(findings, tt.wantFindings) {
+				t.Errorf("NewConfig() findings = %v, want %v", findings, tt.wantFindings)
+			}
+		})
+	}
+}
+
+func TestConvertToV1(t *testing.T) {
+	config := model.PromotionConfig{Spec: model.PromotionConfigSpec{
+		Strategy:   stradr("branch"),
+		NextStages: []string{"production"},
+		Target:     model.Target{Repo: stradr("https://github.com/test/test")},
+		Paths: []model.Path{{
+			Source: stradr("dev"), Target: stradr("prod"),
+			Images: []model.KustomizeImage{{Name: stradr("app")}},
+			Chart:  &model.Chart{Bump: stradr(model.BumpPatch)},
+		}},
+		Replacement: model.Replacement{
+			Rules:       []model.ReplacementRule{{Path: stradr("image"), Selector: model.Selector{Kind: stradr("Deployment")}}},
+			Constraints: []model.Constraint{{Key: stradr("tag")}},
+			Digests:     []model.Digest{{Key: stradr("tag")}},
+		},
+	}}
+	converted, lost := model.ConvertToV1(config)
+	if *converted.APIVersion != model.APIVersionV1 || converted.Spec.NextStage == nil || *converted.Spec.NextStage != "production" || lost != nil {
+		t.Errorf("ConvertToV1() = %+v, %v", converted, lost)
+	}
+	if back := converted.ConvertToV2(); !reflect.DeepEqual(back.Spec, config.Spec) {
+		t.Errorf("ConvertToV2() = %+v, want %+v", back.Spec, config.Spec)
+	}
+}
+
+func TestConvertToV1_lost(t *testing.T) {
+	dryRun := true
+	config := model.PromotionConfig{Spec: model.PromotionConfigSpec{
+		NextStages: []string{"prod-eu", "prod-us"},
+		DryRun:     &dryRun,
+		Target:     model.Target{SecretKey: stradr("token"), SecretNamespace: stradr("git")},
+	}}
+	converted, lost := model.ConvertToV1(config)
+	if converted.Spec.NextStage != nil {
+		t.Errorf("ConvertToV1() nextStage = %v", *converted.Spec.NextStage)
+	}
+	if want := []string{"spec.nextStages", "spec.dryRun", "spec.target.secretKey", "spec.target.secretNamespace"}; !reflect.DeepEqual(lost, want) {
+		t.Errorf("ConvertToV1() lost = %v, want %v", lost, want)
+	}
+}
@@ -0,0 +1,241 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"keptn/git-promotion-service/pkg/model"
+)
+
+const specPrefix = "spec."
+
+// defaultMergeModes contains the lists and maps (relative to spec) that are replaced instead of appended by default
+var defaultMergeModes = map[string]string{
+	"nextStages": model.MergeReplace,
+}
+
+// EffectiveConfig is the configuration merged from all layers
+type EffectiveConfig struct {
+	Config model.PromotionConfig `yaml:"config"`
+	// Provenance maps the path of every value set by a layer (e.g. spec.target.repo, spec.paths[0] or
+	// spec.nextStageMap.dev) to the level of the layer
+	Provenance map[string]string `yaml:"provenance"`
+	// Hash is the hash of the configuration layers
+	Hash string `yaml:"hash"`
+	// Findings are the findings of parsing and merging the layers (e.g. ignored unknown fields of keptn.sh/v1 layers),
+	// the message starts with the level of the layer
+	Findings []model.Finding `yaml:"findings,omitempty"`
+}
+
+// MergeLayers converts the configuration layers to the latest version and merges them in the given order (project,
+// stage, service). A later layer
+//   - overrides every scalar value it sets
+//   - adds the entries of maps, replacing entries with the same key
+//   - appends the entries of lists. Entries with an id replace the earlier entry with the same id, entries with
+//     $patch: delete remove the earlier entry with the same id (an error finding without id, a warning if there is
+//     no such entry)
+//
+// The lists and maps listed in spec.merge of a layer with mode replace are replaced by the values of the layer
+// (also if the layer does not contain any value). spec.nextStages is replaced by default. A layer which can not be
+// parsed fails the merge instead of being skipped
+func MergeLayers(layers []ConfigLayer) (effective EffectiveConfig, err error) {
+	effective.Provenance = make(map[string]string)
+	for _, l := range layers {
+		layerConfig, findings, err := NewConfig(l.Content)
+		if err != nil {
+			return effective, fmt.Errorf("could not parse %s configuration: %w", l.Level, err)
+		}
+		for _, f := range findings {
+			f.Message = l.Level + " configuration: " + f.Message
+			effective.Findings = append(effective.Findings, f)
+		}
+		// the version of the layer is not part of the effective configuration
+		layerConfig.APIVersion, layerConfig.Kind = nil, nil
+		m := merger{level: l.Level, modes: layerConfig.Spec.Merge, provenance: effective.Provenance, findings: &effective.Findings}
+		m.mergeValue("", reflect.ValueOf(&effective.Config).Elem(), reflect.ValueOf(*layerConfig))
+	}
+	apiVersion, kind := model.APIVersionV2, model.KindGitPromotionConfig
+	effective.Config.APIVersion, effective.Config.Kind = &apiVersion, &kind
+	return effective, nil
+}
+
+// IsMergeableField returns true if the path (relative to spec, e.g. paths or replacement.rules) is a list or map
+// which can be used in spec.merge
+func IsMergeableField(path string) bool {
+	t := reflect.TypeOf(model.PromotionConfigSpec{})
+	for _, name := range strings.Split(path, ".") {
+		if t.Kind() != reflect.Struct {
+			return false
+		}
+		found := false
+		for i := 0; i < t.NumField(); i++ {
+			if yamlName(t.Field(i)) == name {
+				t, found = t.Field(i).Type, true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return path != "merge" && (t.Kind() == reflect.Slice || t.Kind() == reflect.Map)
+}
+
+type merger struct {
+	level      string
+	modes      map[string]string
+	provenance map[string]string
+	findings   *[]model.Finding
+}
+
+func (m merger) mergeValue(path string, target, src reflect.Value) {
+	switch src.Kind() {
+	case reflect.Ptr:
+		if !src.IsNil() {
+			target.Set(src)
+			m.provenance[path] = m.level
+		}
+	case reflect.Struct:
+		for i := 0; i < src.NumField(); i++ {
+			field := src.Type().Field(i)
+			if field.PkgPath != "" {
+				continue
+			}
+			fieldPath := yamlName(field)
+			if path != "" {
+				fieldPath = path + "." + fieldPath
+			}
+			m.mergeValue(fieldPath, target.Field(i), src.Field(i))
+		}
+	case reflect.Map:
+		m.mergeMap(path, target, src)
+	case reflect.Slice:
+		m.mergeSlice(path, target, src)
+	default:
+		if !src.IsZero() {
+			target.Set(src)
+			m.provenance[path] = m.level
+		}
+	}
+}
+
+// replace returns if the list or map at path is replaced and if the layer replaces it also without values
+func (m merger) replace(path string) (replace bool, explicit bool) {
+	key := strings.TrimPrefix(path, specPrefix)
+	if mode, ok := m.modes[key]; ok {
+		return mode == model.MergeReplace, mode == model.MergeReplace
+	}
+	return defaultMergeModes[key] == model.MergeReplace, false
+}
+
+func (m merger) mergeMap(path string, target, src reflect.Value) {
+	replace, explicit := m.replace(path)
+	if src.IsNil() && !explicit {
+		return
+	}
+	merged := reflect.MakeMap(target.Type())
+	if replace {
+		for p := range m.provenance {
+			if strings.HasPrefix(p, path+".") {
+				delete(m.provenance, p)
+			}
+		}
+	} else {
+		iter := target.MapRange()
+		for iter.Next() {
+			merged.SetMapIndex(iter.Key(), iter.Value())
+		}
+	}
+	iter := src.MapRange()
+	for iter.Next() {
+		merged.SetMapIndex(iter.Key(), iter.Value())
+		m.provenance[fmt.Sprintf("%s.%v", path, iter.Key().Interface())] = m.level
+	}
+	if merged.Len() == 0 {
+		merged = reflect.Zero(target.Type())
+	}
+	target.Set(merged)
+}
+
+func (m merger) mergeSlice(path string, target, src reflect.Value) {
+	replace, explicit := m.replace(path)
+	if src.IsNil() && !explicit {
+		return
+	}
+	var elems []reflect.Value
+	var levels []string
+	for i := 0; i < target.Len(); i++ {
+		elemPath := fmt.Sprintf("%s[%d]", path, i)
+		if !replace {
+			elems = append(elems, target.Index(i))
+			levels = append(levels, m.provenance[elemPath])
+		}
+		delete(m.provenance, elemPath)
+	}
+	for i := 0; i < src.Len(); i++ {
+		elem := src.Index(i)
+		id, patch := entryDirectives(elem)
+		existing := -1
+		for d := range elems {
+			if existingID, _ := entryDirectives(elems[d]); id != "" && existingID == id {
+				existing = d
+				break
+			}
+		}
+		switch {
+		case patch == model.PatchDelete && id == "":
+			*m.findings = append(*m.findings, model.NewError(model.FindingMissing, fmt.Sprintf("%s[%d].id", path, i), "%s configuration: is needed to delete an entry of an earlier layer with $patch: delete", m.level))
+		case patch == model.PatchDelete && existing >= 0:
+			elems = append(elems[:existing], elems[existing+1:]...)
+			levels = append(levels[:existing], levels[existing+1:]...)
+		case patch == model.PatchDelete:
+			*m.findings = append(*m.findings, model.NewWarning(model.FindingMissing, fmt.Sprintf("%s[%d].id", path, i), "%s configuration: no entry with id %s in an earlier layer to delete", m.level, id))
+		case existing >= 0:
+			elems[existing], levels[existing] = elem, m.level
+		default:
+			elems, levels = append(elems, elem), append(levels, m.level)
+		}
+	}
+	if len(elems) == 0 {
+		target.Set(reflect.Zero(target.Type()))
+		return
+	}
+	merged := reflect.MakeSlice(target.Type(), len(elems), len(elems))
+	for i, elem := range elems {
+		merged.Index(i).Set(elem)
+		m.provenance[fmt.Sprintf("%s[%d]", path, i)] = levels[i]
+	}
+	target.Set(merged)
+}
+
+// entryDirectives returns the id and the $patch directive of a list entry
+func entryDirectives(elem reflect.Value) (id, patch string) {
+	if elem.Kind() != reflect.Struct {
+		return "", ""
+	}
+	for name, value := range map[string]*string{"ID": &id, "Patch": &patch} {
+		if f := elem.FieldByName(name); f.IsValid() && f.Kind() == reflect.Ptr && !f.IsNil() {
+			*value = f.Elem().String()
+		}
+	}
+	return id, patch
+}
+
+// ProvenancePaths returns the paths of the provenance sorted by name
+func (e EffectiveConfig) ProvenancePaths() []string {
+	paths := make([]string, 0, len(e.Provenance))
+	for p := range e.Provenance {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func yamlName(field reflect.StructField) string {
+	if name := strings.Split(field.Tag.Get("yaml"), ",")[0]; name != "" {
+		return name
+	}
+	return strings.ToLower(field.Name)
+}
@@ -0,0 +1,244 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+
+	"keptn/git-promotion-service/pkg/model"
+)
+
+func TestMergeLayers(t *testing.T) {
+	tests := []struct {
+		name           string
+		layers         []ConfigLayer
+		want           model.PromotionConfig
+		wantProvenance map[string]string
+		wantFindings   []model.Finding
+		wantErr        bool
+	}{
+		{
+			name: "single layer",
+			layers: []ConfigLayer{{Level: LevelProject, Content: []byte(`
+spec:
+  strategy: "mystrategy"
+  target:
+    repo: "myrepo"
+    secret: "mysecret"
+    provider: "github"
+  paths:
+    - target: /hallo
+      source: /test
+`)}},
+			want: model.PromotionConfig{
+				APIVersion: stradr(model.APIVersionV2),
+				Kind:       stradr(model.KindGitPromotionConfig),
+				Spec: model.PromotionConfigSpec{
+					Strategy: stradr("mystrategy"),
+					Target: model.Target{
+						Repo:     stradr("myrepo"),
+						Secret:   stradr("mysecret"),
+						Provider: stradr("github"),
+					},
+					Paths: []model.Path{{Target: stradr("/hallo"), Source: stradr("/test")}},
+				},
+			},
+			wantProvenance: map[string]string{
+				"spec.strategy":        LevelProject,
+				"spec.target.repo":     LevelProject,
+				"spec.target.secret":   LevelProject,
+				"spec.target.provider": LevelProject,
+				"spec.paths[0]":        LevelProject,
+			},
+		},
+		{
+			name: "overrides, ids and deletes",
+			layers: []ConfigLayer{
+				{Level: LevelProject, Content: []byte(`
+apiVersion: keptn.sh/v2
+spec:
+  strategy: flat-pr
+  target:
+    repo: myrepo
+  nextStages: [prod-eu, prod-us]
+  nextStageMap:
+    dev: staging
+  paths:
+    - id: app
+      target: app
+    - id: db
+      target: db
+    - target: common
+`)},
+				{Level: LevelStage, Content: []byte(`
+apiVersion: keptn.sh/v1
+kind: GitPromotionConfig
+spec:
+  nextStage: prod-eu
+  nextStageMap:
+    staging: prod
+  paths:
+    - id: db
+      $patch: delete
+    - id: unknown
+      $patch: delete
+`)},
+				{Level: LevelService, Content: []byte(`
+apiVersion: keptn.sh/v2
+kind: GitPromotionConfig
+spec:
+  target:
+    repo: servicerepo
+  paths:
+    - id: app
+      target: app/service
+      mode: template
+    - target: extra
+`)},
+			},
+			want: model.PromotionConfig{
+				APIVersion: stradr(model.APIVersionV2),
+				Kind:       stradr(model.KindGitPromotionConfig),
+				Spec: model.PromotionConfigSpec{
+					Strategy:     stradr("flat-pr"),
+					Target:       model.Target{Repo: stradr("servicerepo")},
+					NextStages:   []string{"prod-eu"},
+					NextStageMap: map[string]string{"dev": "staging", "staging": "prod"},
+					Paths: []model.Path{
+						{ID: stradr("app"), Target: stradr("app/service"), Mode: stradr("template")},
+						{Target: stradr("common")},
+						{Target: stradr("extra")},
+					},
+				},
+			},
+			wantProvenance: map[string]string{
+				"spec.strategy":             LevelProject,
+				"spec.target.repo":          LevelService,
+				"spec.nextStages[0]":        LevelStage,
+				"spec.nextStageMap.dev":     LevelProject,
+				"spec.nextStageMap.staging": LevelStage,
+				"spec.paths[0]":             LevelService,
+				"spec.paths[1]":             LevelProject,
+				"spec.paths[2]":             LevelService,
+			},
+			wantFindings: []model.Finding{
+				model.NewWarning(model.FindingMissing, "spec.paths[1].id", "stage configuration: no entry with id unknown in an earlier layer to delete"),
+			},
+		},
+		{
+			name: "delete without id",
+			layers: []ConfigLayer{
+				{Level: LevelProject, Content: []byte("spec:\n  paths:\n    - target: app\n")},
+				{Level: LevelService, Content: []byte("spec:\n  paths:\n    - target: app\n      $patch: delete\n")},
+			},
+			want: model.PromotionConfig{
+				APIVersion: stradr(model.APIVersionV2),
+				Kind:       stradr(model.KindGitPromotionConfig),
+				Spec:       model.PromotionConfigSpec{Paths: []model.Path{{Target: stradr("app")}}},
+			},
+			wantProvenance: map[string]string{"spec.paths[0]": LevelProject},
+			wantFindings: []model.Finding{
+				model.NewError(model.FindingMissing, "spec.paths[0].id", "service configuration: is needed to delete an entry of an earlier layer with $patch: delete"),
+			},
+		},
+		{
+			name: "replace directive",
+			layers: []ConfigLayer{
+				{Level: LevelProject, Content: []byte(`
+spec:
+  nextStageMap:
+    dev: staging
+  paths:
+    - target: app
+  pullRequest:
+    labels: [promotion]
+`)},
+				{Level: LevelService, Content: []byte(`
+spec:
+  merge:
+    paths: replace
+    nextStageMap: replace
+  paths:
+    - target: service
+  pullRequest:
+    labels: [service]
+`)},
+			},
+			want: model.PromotionConfig{
+				APIVersion: stradr(model.APIVersionV2),
+				Kind:       stradr(model.KindGitPromotionConfig),
+				Spec: model.PromotionConfigSpec{
+					Paths:       []model.Path{{Target: stradr("service")}},
+					PullRequest: model.PullRequest{Labels: []string{"promotion", "service"}},
+					Merge:       map[string]string{"paths": "replace", "nextStageMap": "replace"},
+				},
+			},
+			wantProvenance: map[string]string{
+				"spec.paths[0]":              LevelService,
+				"spec.pullRequest.labels[0]": LevelProject,
+				"spec.pullRequest.labels[1]": LevelService,
+				"spec.merge.paths":           LevelService,
+				"spec.merge.nextStageMap":    LevelService,
+			},
+		},
+		{
+			name:   "unknown field in v1 layer",
+			layers: []ConfigLayer{{Level: LevelStage, Content: []byte("spec:\n  strategy: branch\n  timeout: 5\n")}},
+			want: model.PromotionConfig{
+				APIVersion: stradr(model.APIVersionV2),
+				Kind:       stradr(model.KindGitPromotionConfig),
+				Spec:       model.PromotionConfigSpec{Strategy: stradr("branch")},
+			},
+			wantProvenance: map[string]string{"spec.strategy": LevelStage},
+			wantFindings: []model.Finding{
+				model.NewWarning(model.FindingUnknownField, "", "stage configuration: unknown field timeout in line 3 is ignored (not supported in keptn.sh/v1)"),
+			},
+		},
+		{
+			name:    "unsupported version",
+			layers:  []ConfigLayer{{Level: LevelStage, Content: []byte("apiVersion: keptn.sh/v3\nspec: {}")}},
+			wantErr: true,
+		},
+		{
+			name:    "invalid layer",
+			layers:  []ConfigLayer{{Level: LevelStage, Content: []byte("spec: [")}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := MergeLayers(tt.layers)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("MergeLayers() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(got.Config, tt.want) {
+				t.Errorf("MergeLayers() = %+v, want %+v", got.Config, tt.want)
+			}
+			if !reflect.DeepEqual(got.Provenance, tt.wantProvenance) {
+				t.Errorf("MergeLayers() provenance = %v, want %v", got.Provenance, tt.wantProvenance)
+			}
+			if !reflect.DeepEqual(got.Findings, tt.wantFindings) {
+				t.Errorf("MergeLayers() findings = %v, want %v", got.Findings, tt.wantFindings)
+			}
+		})
+	}
+}
+
+func TestIsMergeableField(t *testing.T) {
+	for path, want := range map[string]bool{
+		"paths":              true,
+		"replacement.rules":  true,
+		"nextStageMap":       true,
+		"pullRequest.labels": true,
+		"target.repo":        false,
+		"merge":              false,
+		"unknown":            false,
+		"paths.target":       false,
+	} {
+		if got := IsMergeableField(path); got != want {
+			t.Errorf("IsMergeableField(%s) = %v, want %v", path, got, want)
+		}
+	}
+}
@@ -1,10 +1,13 @@
 package config
 
 import (
+	"errors"
 	"fmt"
 	"log"
 
+	api "github.com/keptn/go-utils/pkg/api/utils/v2"
 	"golang.org/x/crypto/sha3"
+	"keptn/git-promotion-service/pkg/model"
 )
 
 // Needs to be escaped manually when sending it to the api-gateway-nginx
@@ -53,11 +56,65 @@ func (jcr *GitPromotionConfigReader) FindGitPromotionConfigResource(gitCommitID
 	return nil, fmt.Errorf("unable to find job configuration")
 }
 
+// Levels of the configuration layers
+const (
+	LevelProject = "project"
+	LevelStage   = "stage"
+	LevelService = "service"
+)
+
+// ConfigLayer is the git promotion configuration resource of one level
+type ConfigLayer struct {
+	Level   string
+	Content []byte
+}
+
+// GetConfigLayers retrieves the git promotion configuration resources of the project, stage and service (in this
+// order). The stage and service resources are pinned to gitCommitID. Levels without configuration are skipped. Additionally, the SHA3 hash of the
+// retrieved layers is returned. Errors other than a missing resource are returned
+func (jcr *GitPromotionConfigReader) GetConfigLayers(gitCommitID string) (layers []ConfigLayer, hash string, err error) {
+	hasher := sha3.New224()
+	for _, l := range []struct {
+		level       string
+		getResource func(resource string, gitCommitID string) ([]byte, error)
+		gitCommitID string
+	}{
+		// NOTE: Since the resource service uses different branches, the commitID may not be in the main
+		//       branch and therefore it's not possible to query the project configuration with it!
+		{level: LevelProject, getResource: jcr.Keptn.GetProjectResource},
+		{level: LevelStage, getResource: jcr.Keptn.GetStageResource, gitCommitID: gitCommitID},
+		{level: LevelService, getResource: jcr.Keptn.GetServiceResource, gitCommitID: gitCommitID},
+	} {
+		content, err := l.getResource(gitPromotionConfigResourceName, l.gitCommitID)
+		if errors.Is(err, api.ResourceNotFoundError) {
+			continue
+		} else if err != nil {
+			return nil, "", fmt.Errorf("error retrieving %s configuration: %w", l.level, err)
+		}
+		hasher.Write([]byte(l.level + "\n"))
+		hasher.Write(content)
+		layers = append(layers, ConfigLayer{Level: l.level, Content: content})
+	}
+	return layers, fmt.Sprintf("%x", hasher.Sum(nil)), nil
+}
+
+// GetEffectiveConfig retrieves the configuration layers for gitCommitID (see GetConfigLayers) and merges them
+// (see MergeLayers)
+func (jcr *GitPromotionConfigReader) GetEffectiveConfig(gitCommitID string) (EffectiveConfig, error) {
+	layers, hash, err := jcr.GetConfigLayers(gitCommitID)
+	if err != nil {
+		return EffectiveConfig{}, err
+	}
+	effective, err := MergeLayers(layers)
+	effective.Hash = hash
+	return effective, err
+}
+
 // GetJobConfig retrieves job/config.yaml resource from keptn and parses it into a Config struct.
 // Additionally, also the SHA1 hash of the retrieved configuration will be returned.
 // In case of error retrieving the resource or parsing the yaml it will return (nil,
 // error) with the original error correctly wrapped in the local one
-func (jcr *GitPromotionConfigReader) GetJobConfig(gitCommitID string) (*PromotionConfig, string, error) {
+func (jcr *GitPromotionConfigReader) GetJobConfig(gitCommitID string) (*model.PromotionConfig, string, error) {
 
 	resource, err := jcr.FindGitPromotionConfigResource(gitCommitID)
 	if err != nil {
@@ -69,7 +126,15 @@ func (jcr *GitPromotionConfigReader) GetJobConfig(gitCommitID string) (*Promotio
 	resourceHashBytes := hasher.Sum(nil)
 	resourceHash := fmt.Sprintf("%x", resourceHashBytes)
 
-	configuration, err := NewConfig(resource)
+	configuration, findings, err := NewConfig(resource)
+	if errs := model.Errors(findings); err == nil && len(errs) > 0 {
+		err = errors.New(errs[0].String())
+	}
+	for _, f := range findings {
+		if f.Severity == model.SeverityWarning {
+			log.Printf("Warning: %s", f.String())
+		}
+	}
 	if err != nil {
 		log.Printf("Could not parse config: %s", err)
 		log.Printf("The config was: %s", string(resource))
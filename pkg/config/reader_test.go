@@ -0,0 +1,81 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	api "github.com/keptn/go-utils/pkg/api/utils/v2"
+)
+
+// fakeResourceService returns the resources by level and records the requested commit ids
+type fakeResourceService struct {
+	resources map[string][]byte
+	err       error
+	commitIDs map[string]string
+}
+
+func (f *fakeResourceService) get(level, gitCommitID string) ([]byte, error) {
+	f.commitIDs[level] = gitCommitID
+	if f.err != nil {
+		return nil, f.err
+	}
+	if content, ok := f.resources[level]; ok {
+		return content, nil
+	}
+	return nil, fmt.Errorf("unable to get resouce from keptn: %w", api.ResourceNotFoundError)
+}
+
+func (f *fakeResourceService) GetServiceResource(_ string, gitCommitID string) ([]byte, error) {
+	return f.get(LevelService, gitCommitID)
+}
+
+func (f *fakeResourceService) GetProjectResource(_ string, gitCommitID string) ([]byte, error) {
+	return f.get(LevelProject, gitCommitID)
+}
+
+func (f *fakeResourceService) GetStageResource(_ string, gitCommitID string) ([]byte, error) {
+	return f.get(LevelStage, gitCommitID)
+}
+
+func (f *fakeResourceService) GetAllKeptnResources(_ string) (map[string][]byte, error) {
+	return nil, errors.New("not implemented")
+}
+
+func TestGitPromotionConfigReader_GetConfigLayers(t *testing.T) {
+	keptn := &fakeResourceService{
+		resources: map[string][]byte{
+			LevelProject: []byte("spec:\n  strategy: flat-pr\n"),
+			LevelService: []byte("spec:\n  strategy: branch\n"),
+		},
+		commitIDs: make(map[string]string),
+	}
+	reader := GitPromotionConfigReader{Keptn: keptn}
+	layers, hash, err := reader.GetConfigLayers("abc123")
+	if err != nil {
+		t.Fatalf("GetConfigLayers() error = %v", err)
+	}
+	wantLayers := []ConfigLayer{
+		{Level: LevelProject, Content: keptn.resources[LevelProject]},
+		{Level: LevelService, Content: keptn.resources[LevelService]},
+	}
+	if !reflect.DeepEqual(layers, wantLayers) {
+		t.Errorf("GetConfigLayers() = %v, want %v", layers, wantLayers)
+	}
+	wantCommitIDs := map[string]string{LevelProject: "", LevelStage: "abc123", LevelService: "abc123"}
+	if !reflect.DeepEqual(keptn.commitIDs, wantCommitIDs) {
+		t.Errorf("GetConfigLayers() requested commit ids %v, want %v", keptn.commitIDs, wantCommitIDs)
+	}
+
+	keptn.resources[LevelService] = []byte("spec:\n  strategy: flat-pr\n")
+	_, changedHash, _ := reader.GetConfigLayers("abc123")
+	if hash == "" || changedHash == hash {
+		t.Errorf("GetConfigLayers() hash %s should change with the content (%s)", hash, changedHash)
+	}
+
+	keptn.err = errors.New("connection refused")
+	if _, _, err := reader.GetConfigLayers("abc123"); err == nil {
+		t.Errorf("GetConfigLayers() expected error")
+	}
+}
@@ -0,0 +1,26 @@
+package config
+
+import (
+	"keptn/git-promotion-service/pkg/model"
+	"keptn/git-promotion-service/pkg/placeholder"
+)
+
+// Builtins returns the values of the builtin placeholders
+func Builtins(project, stage, nextStage, service string) map[string]string {
+	return map[string]string{
+		"project":   project,
+		"stage":     stage,
+		"nextstage": nextStage,
+		"service":   service,
+	}
+}
+
+// ResolveAndValidate resolves the placeholders of the spec with resolver and validates the resolved configuration.
+// Unknown placeholders are returned as findings with code unknown-placeholder
+func ResolveAndValidate(config model.PromotionConfig, resolver placeholder.Resolver) (model.PromotionConfig, []model.Finding) {
+	var findings []model.Finding
+	for _, u := range resolver.ReplaceAll("spec", &config.Spec) {
+		findings = append(findings, model.NewError(model.FindingUnknownPlaceholder, u.Path, "contains unknown placeholder %s", u.Expression))
+	}
+	return config, append(findings, NewValidator().Validate(config)...)
+}
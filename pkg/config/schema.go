@@ -0,0 +1,83 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"keptn/git-promotion-service/pkg/model"
+)
+
+//go:generate go run ../../hack/schemagen ../../schema
+
+const jsonSchemaDraft = "http://json-schema.org/draft-07/schema#"
+
+// schemaTypes contains the go type of every supported apiVersion
+var schemaTypes = map[string]reflect.Type{
+	model.APIVersionV1: reflect.TypeOf(model.PromotionConfigV1{}),
+	model.APIVersionV2: reflect.TypeOf(model.PromotionConfig{}),
+}
+
+// SchemaVersions returns the apiVersions a JSON schema can be generated for
+func SchemaVersions() []string {
+	return []string{model.APIVersionV1, model.APIVersionV2}
+}
+
+// SchemaFileName returns the name of the JSON schema file of the apiVersion (e.g. git-promotion.v1.schema.json)
+func SchemaFileName(apiVersion string) string {
+	return fmt.Sprintf("git-promotion.%s.schema.json", apiVersion[strings.LastIndex(apiVersion, "/")+1:])
+}
+
+// JSONSchema generates the JSON schema of git-promotion.yaml for the apiVersion from the go types. The properties
+// are named by the yaml tags, the allowed values are taken from the jsonschema:"enum=a|b" tags
+func JSONSchema(apiVersion string) ([]byte, error) {
+	t, ok := schemaTypes[apiVersion]
+	if !ok {
+		return nil, fmt.Errorf("apiVersion %s not supported", apiVersion)
+	}
+	schema := typeSchema(t)
+	schema["$schema"] = jsonSchemaDraft
+	schema["title"] = fmt.Sprintf("%s %s", model.KindGitPromotionConfig, apiVersion)
+	return json.MarshalIndent(schema, "", "  ")
+}
+
+func typeSchema(t reflect.Type) map[string]interface{} {
+	switch t.Kind() {
+	case reflect.Ptr:
+		return typeSchema(t.Elem())
+	case reflect.Struct:
+		properties := make(map[string]interface{})
+		addProperties(t, properties)
+		return map[string]interface{}{"type": "object", "properties": properties, "additionalProperties": false}
+	case reflect.Slice:
+		return map[string]interface{}{"type": "array", "items": typeSchema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": typeSchema(t.Elem())}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		return map[string]interface{}{"type": "integer"}
+	default:
+		return map[string]interface{}{"type": "string"}
+	}
+}
+
+func addProperties(t reflect.Type, properties map[string]interface{}) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Anonymous && strings.Contains(field.Tag.Get("yaml"), ",inline") {
+			addProperties(field.Type, properties)
+			continue
+		}
+		schema := typeSchema(field.Type)
+		if enum := strings.TrimPrefix(field.Tag.Get("jsonschema"), "enum="); enum != "" {
+			values := schema
+			if field.Type.Kind() == reflect.Map {
+				values = schema["additionalProperties"].(map[string]interface{})
+			}
+			values["enum"] = strings.Split(enum, "|")
+		}
+		properties[yamlName(field)] = schema
+	}
+}
@@ -0,0 +1,30 @@
+package config
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestJSONSchemaUpToDate(t *testing.T) {
+	for _, apiVersion := range SchemaVersions() {
+		schema, err := JSONSchema(apiVersion)
+		if err != nil {
+			t.Fatalf("JSONSchema(%s) error = %v", apiVersion, err)
+		}
+		if !json.Valid(schema) {
+			t.Errorf("JSONSchema(%s) is not valid json", apiVersion)
+		}
+		committed, err := os.ReadFile(filepath.Join("..", "..", "schema", SchemaFileName(apiVersion)))
+		if err != nil {
+			t.Fatalf("could not read schema of %s: %v", apiVersion, err)
+		}
+		if string(committed) != string(schema)+"\n" {
+			t.Errorf("schema of %s is outdated, run go generate ./pkg/config", apiVersion)
+		}
+	}
+	if _, err := JSONSchema("keptn.sh/v3"); err == nil {
+		t.Errorf("JSONSchema() expected error for unknown version")
+	}
+}
@@ -2,14 +2,18 @@ package config
 
 import (
 	"fmt"
+	"github.com/Masterminds/semver/v3"
 	logger "github.com/sirupsen/logrus"
 	"keptn/git-promotion-service/pkg/model"
-	"net/url"
+	"keptn/git-promotion-service/pkg/replacer"
+	"keptn/git-promotion-service/pkg/repoaccess"
 	"regexp"
+	"sort"
 	"strings"
 )
 
-const githubPathRegexp = "^/[a-zA-Z0-9-]+/[a-zA-Z-_.]+$"
+const githubPathRegexp = `^[a-zA-Z0-9-]+/[a-zA-Z0-9_.-]+$`
+const enrichmentEventRegexp = `^[a-z0-9-]+\.(triggered|started|finished)$`
 
 type validator struct {
 }
@@ -18,56 +22,134 @@ func NewValidator() model.PromotionConfigValidator {
 	return validator{}
 }
 
-func (v validator) Validate(config model.PromotionConfig) (validationErrrors []string) {
-	if config.Spec.Strategy == nil || *config.Spec.Strategy == "" {
-		validationErrrors = append(validationErrrors, `"spec.strategy" missing`)
-	} else if *config.Spec.Strategy != model.StrategyBranch && *config.Spec.Strategy != model.StrategyFlatPR {
-		validationErrrors = append(validationErrrors, fmt.Sprintf(`"spec.strategy" %s invalid`, *config.Spec.Strategy))
+func (v validator) Validate(config model.PromotionConfig) (findings []model.Finding) {
+	spec := config.Spec
+	if spec.Strategy == nil || *spec.Strategy == "" {
+		findings = append(findings, model.NewError(model.FindingMissing, "spec.strategy", "is missing"))
+	} else if *spec.Strategy != model.StrategyBranch && *spec.Strategy != model.StrategyFlatPR {
+		findings = append(findings, model.NewError(model.FindingInvalid, "spec.strategy", "%s is invalid", *spec.Strategy))
 	}
-	if config.Spec.Target.Secret == nil || *config.Spec.Target.Secret == "" {
-		validationErrrors = append(validationErrrors, `"target.secret" missing`)
+	if spec.Target.Secret == nil || *spec.Target.Secret == "" {
+		findings = append(findings, model.NewError(model.FindingMissing, "spec.target.secret", "is missing"))
 	}
-	if config.Spec.Target.Provider == nil || *config.Spec.Target.Provider == "" {
-		validationErrrors = append(validationErrrors, `"target.platform" missing`)
-	} else if *config.Spec.Target.Provider != "github" {
-		validationErrrors = append(validationErrrors, `target.platform not supported`)
+	if spec.Target.Provider == nil || *spec.Target.Provider == "" {
+		findings = append(findings, model.NewError(model.FindingMissing, "spec.target.provider", "is missing"))
+	} else if *spec.Target.Provider != "github" {
+		findings = append(findings, model.NewError(model.FindingUnsupported, "spec.target.provider", "%s is not supported", *spec.Target.Provider))
 	}
-	if config.Spec.Target.Repo == nil || *config.Spec.Target.Repo == "" {
-		validationErrrors = append(validationErrrors, `"target.repository" missing`)
-	} else {
-		u, err := url.Parse(*config.Spec.Target.Repo)
-		if err != nil {
-			validationErrrors = append(validationErrrors, `"target.repository" is not a valid URL`)
-		} else {
-			if u.Scheme != "https" || u.Host != "github.com" {
-				validationErrrors = append(validationErrrors, `"target.repository" must be a "https" url to a repository on github.com`)
-			} else if matched, err := regexp.MatchString(githubPathRegexp, u.Path); err != nil || !matched {
-				validationErrrors = append(validationErrrors, `"target.repository" must be a "https" url to a repository on github.com`)
-			}
-		}
+	if spec.Target.Repo == nil || *spec.Target.Repo == "" {
+		findings = append(findings, model.NewError(model.FindingMissing, "spec.target.repo", "is missing"))
+	} else if locator, err := repoaccess.ParseLocator(*spec.Target.Repo); err != nil {
+		findings = append(findings, model.NewError(model.FindingInvalid, "spec.target.repo", "is not a valid URL"))
+	} else if matched, err := regexp.MatchString(githubPathRegexp, locator.Path()); err != nil || !matched || locator.Host != "github.com" ||
+		locator.Port != "" || (locator.Protocol != repoaccess.ProtocolHTTPS && !locator.IsSSH()) {
+		findings = append(findings, model.NewError(model.FindingUnsupported, "spec.target.repo", `must be a "https" or SSH url to a repository on github.com`))
 	}
-	if config.Spec.Strategy != nil && *config.Spec.Strategy == model.StrategyBranch && len(config.Spec.Paths) > 0 {
-		validationErrrors = append(validationErrrors, `no "paths" supported for branch strategy`)
+	if spec.Strategy != nil && *spec.Strategy == model.StrategyBranch {
+		if len(spec.Paths) > 0 {
+			findings = append(findings, model.NewError(model.FindingUnsupported, "spec.paths", "are not supported for strategy branch"))
+		}
+		if spec.PullRequest.Branch != nil {
+			findings = append(findings, model.NewWarning(model.FindingUnsupported, "spec.pullRequest.branch", "is ignored for strategy branch"))
+		}
+		if spec.PullRequest.CommitMessage != nil {
+			findings = append(findings, model.NewWarning(model.FindingUnsupported, "spec.pullRequest.commitMessage", "is ignored for strategy branch"))
+		}
 	}
-	if config.Spec.Strategy != nil && *config.Spec.Strategy == model.StrategyFlatPR && len(config.Spec.Paths) == 0 {
-		validationErrrors = append(validationErrrors, `at least one path is necessary for strategy flat-pr`)
+	if spec.Strategy != nil && *spec.Strategy == model.StrategyFlatPR && len(spec.Paths) == 0 {
+		findings = append(findings, model.NewError(model.FindingMissing, "spec.paths", "needs at least one path for strategy flat-pr"))
 	}
-	for i, p := range config.Spec.Paths {
+	for i, p := range spec.Paths {
+		path := fmt.Sprintf("spec.paths[%d]", i)
+		if p.Patch != nil {
+			findings = append(findings, model.NewError(model.FindingInvalid, path+".$patch", "%s is invalid", *p.Patch))
+		}
 		if p.Target == nil || *p.Target == "" {
-			validationErrrors = append(validationErrrors, fmt.Sprintf(`"paths[%d].target" is missing`, i))
+			findings = append(findings, model.NewError(model.FindingMissing, path+".target", "is missing"))
 		} else {
 			//check for targets containing each other (e.g. one target /dev/hello and another /dev/hello/Chart.yaml
 			// => this would lead to multiple copy/template operations and errors and is anywayys an inconsistent defininion
-			for d, p2 := range config.Spec.Paths {
+			for d, p2 := range spec.Paths {
 				if p2.Target != nil && i != d && strings.HasPrefix(*p.Target, *p2.Target) {
-					validationErrrors = append(validationErrrors, fmt.Sprintf("paths[%d].target is already included in paths[%d].target", i, d))
+					findings = append(findings, model.NewError(model.FindingConflict, path+".target", "is already included in spec.paths[%d].target", d))
 				}
 			}
 		}
-		if p.Source != nil && *p.Source == *p.Target {
-			validationErrrors = append(validationErrrors, fmt.Sprintf(`"paths[%d].source" is same as target`, i))
+		if p.Source != nil && p.Target != nil && *p.Source == *p.Target {
+			findings = append(findings, model.NewError(model.FindingConflict, path+".source", "is same as target"))
+		}
+		if p.Mode != nil && *p.Mode != "" {
+			if *p.Mode != model.PathModeReplace && *p.Mode != model.PathModeTemplate && *p.Mode != model.PathModeKustomize {
+				findings = append(findings, model.NewError(model.FindingInvalid, path+".mode", "%s is invalid", *p.Mode))
+			} else if *p.Mode == model.PathModeTemplate && (p.Source == nil || *p.Source == "") {
+				findings = append(findings, model.NewError(model.FindingMissing, path+".source", "is necessary for mode template"))
+			} else if *p.Mode == model.PathModeKustomize && len(p.Images) == 0 {
+				findings = append(findings, model.NewError(model.FindingMissing, path+".images", "needs at least one image for mode kustomize"))
+			}
+		}
+		if len(p.Images) > 0 && (p.Mode == nil || *p.Mode != model.PathModeKustomize) {
+			findings = append(findings, model.NewError(model.FindingUnsupported, path+".images", "are only supported for mode kustomize"))
+		}
+		if p.Chart != nil && p.Chart.Bump != nil && *p.Chart.Bump != model.BumpPatch && *p.Chart.Bump != model.BumpMinor && *p.Chart.Bump != model.BumpMajor {
+			findings = append(findings, model.NewError(model.FindingInvalid, path+".chart.bump", "%s is invalid", *p.Chart.Bump))
+		}
+		for d, image := range p.Images {
+			imagePath := fmt.Sprintf("%s.images[%d]", path, d)
+			if image.Name == nil || *image.Name == "" {
+				findings = append(findings, model.NewError(model.FindingMissing, imagePath+".name", "is missing"))
+			}
+			if image.NewName == nil && image.NewTag == nil && image.Digest == nil {
+				findings = append(findings, model.NewError(model.FindingMissing, imagePath, "needs at least one of newName, newTag or digest"))
+			}
+		}
+	}
+	for i, r := range spec.Replacement.Rules {
+		path := fmt.Sprintf("spec.replacement.rules[%d]", i)
+		if r.Path == nil || *r.Path == "" {
+			findings = append(findings, model.NewError(model.FindingMissing, path+".path", "is missing"))
+		}
+		if r.ReplaceWith == nil || *r.ReplaceWith == "" {
+			findings = append(findings, model.NewError(model.FindingMissing, path+".replaceWith", "is missing"))
+		}
+	}
+	for i, c := range spec.Replacement.Constraints {
+		path := fmt.Sprintf("spec.replacement.constraints[%d]", i)
+		if c.Key == nil || *c.Key == "" {
+			findings = append(findings, model.NewError(model.FindingMissing, path+".key", "is missing"))
+		}
+		if c.Policy == nil || *c.Policy == "" {
+			findings = append(findings, model.NewError(model.FindingMissing, path+".policy", "is missing"))
+		} else if *c.Policy != replacer.PolicySemverIncreaseOnly {
+			if _, err := semver.NewConstraint(*c.Policy); err != nil {
+				findings = append(findings, model.NewError(model.FindingInvalid, path+".policy", "%s is invalid", *c.Policy))
+			}
+		}
+	}
+	for i, d := range spec.Replacement.Digests {
+		if d.Key == nil || *d.Key == "" {
+			findings = append(findings, model.NewError(model.FindingMissing, fmt.Sprintf("spec.replacement.digests[%d].key", i), "is missing"))
+		}
+	}
+	if v := spec.Replacement.OnViolation; v != nil && *v != "" && *v != model.ViolationFail && *v != model.ViolationWarn {
+		findings = append(findings, model.NewError(model.FindingInvalid, "spec.replacement.onViolation", "%s is invalid", *v))
+	}
+	for i, e := range spec.Enrichment.Events {
+		if matched, err := regexp.MatchString(enrichmentEventRegexp, e); err != nil || !matched {
+			findings = append(findings, model.NewError(model.FindingInvalid, fmt.Sprintf("spec.enrichment.events[%d]", i), "%s must be formatted as <task>.<triggered|started|finished>", e))
+		}
+	}
+	mergeKeys := make([]string, 0, len(spec.Merge))
+	for k := range spec.Merge {
+		mergeKeys = append(mergeKeys, k)
+	}
+	sort.Strings(mergeKeys)
+	for _, k := range mergeKeys {
+		if !IsMergeableField(k) {
+			findings = append(findings, model.NewError(model.FindingUnsupported, "spec.merge."+k, "is not a list or map"))
+		} else if mode := spec.Merge[k]; mode != model.MergeAppend && mode != model.MergeReplace {
+			findings = append(findings, model.NewError(model.FindingInvalid, "spec.merge."+k, "%s is invalid", mode))
 		}
 	}
-	logger.WithField("func", "validateInputEvent").Infof("validation finished with %d validation errors", len(validationErrrors))
-	return validationErrrors
+	logger.WithField("func", "validateInputEvent").Infof("validation finished with %d findings", len(findings))
+	return findings
 }
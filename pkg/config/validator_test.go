@@ -11,9 +11,9 @@ func Test_Validate(t *testing.T) {
 		config model.PromotionConfig
 	}
 	tests := []struct {
-		name                  string
-		args                  args
-		wantValidationErrrors []string
+		name         string
+		args         args
+		wantFindings []model.Finding
 	}{
 		{
 			name: "valid branch config",
@@ -71,8 +71,8 @@ func Test_Validate(t *testing.T) {
 					},
 				},
 			},
-			wantValidationErrrors: []string{
-				"at least one path is necessary for strategy flat-pr",
+			wantFindings: []model.Finding{
+				model.NewError(model.FindingMissing, "spec.paths", "needs at least one path for strategy flat-pr"),
 			},
 		},
 		{
@@ -101,16 +101,186 @@ func Test_Validate(t *testing.T) {
 					},
 				},
 			},
-			wantValidationErrrors: []string{
-				"paths[1].target is already included in paths[0].target",
+			wantFindings: []model.Finding{
+				model.NewError(model.FindingConflict, "spec.paths[1].target", "is already included in spec.paths[0].target"),
+			},
+		},
+		{
+			name: "flat-pr config with template mode without source",
+			args: args{
+				config: model.PromotionConfig{
+					APIVersion: stradr("keptn.sh/v1"),
+					Kind:       stradr("GitPromotionConfig"),
+					Spec: model.PromotionConfigSpec{
+						Strategy: stradr("flat-pr"),
+						Target: model.Target{
+							Repo:     stradr("https://github.com/test/test"),
+							Secret:   stradr("hallosecret"),
+							Provider: stradr("github"),
+						},
+						Paths: []model.Path{
+							{
+								Target: stradr("testtarget"),
+								Mode:   stradr("template"),
+							},
+							{
+								Source: stradr("othersource"),
+								Target: stradr("othertarget"),
+								Mode:   stradr("unknown"),
+							},
+						},
+					},
+				},
+			},
+			wantFindings: []model.Finding{
+				model.NewError(model.FindingMissing, "spec.paths[0].source", "is necessary for mode template"),
+				model.NewError(model.FindingInvalid, "spec.paths[1].mode", "unknown is invalid"),
+			},
+		},
+		{
+			name: "flat-pr config with kustomize mode",
+			args: args{
+				config: model.PromotionConfig{
+					APIVersion: stradr("keptn.sh/v1"),
+					Kind:       stradr("GitPromotionConfig"),
+					Spec: model.PromotionConfigSpec{
+						Strategy: stradr("flat-pr"),
+						Target: model.Target{
+							Repo:     stradr("https://github.com/test/test"),
+							Secret:   stradr("hallosecret"),
+							Provider: stradr("github"),
+						},
+						Paths: []model.Path{
+							{
+								Target: stradr("overlays/dev"),
+								Mode:   stradr("kustomize"),
+								Images: []model.KustomizeImage{
+									{Name: stradr("app"), NewTag: stradr("data.image.tag")},
+									{Name: stradr("other")},
+								},
+							},
+							{
+								Target: stradr("overlays/prod"),
+								Mode:   stradr("kustomize"),
+							},
+						},
+					},
+				},
+			},
+			wantFindings: []model.Finding{
+				model.NewError(model.FindingMissing, "spec.paths[0].images[1]", "needs at least one of newName, newTag or digest"),
+				model.NewError(model.FindingMissing, "spec.paths[1].images", "needs at least one image for mode kustomize"),
+			},
+		},
+		{
+			name: "branch config with unsupported provider and ignored fields",
+			args: args{
+				config: model.PromotionConfig{
+					Spec: model.PromotionConfigSpec{
+						Strategy: stradr("branch"),
+						Target: model.Target{
+							Repo:     stradr("https://github.com/test/test-repo2"),
+							Secret:   stradr("hallosecret"),
+							Provider: stradr("gitlab"),
+						},
+						PullRequest: model.PullRequest{Branch: stradr("promote")},
+					},
+				},
+			},
+			wantFindings: []model.Finding{
+				{Code: model.FindingUnsupported, Path: "spec.target.provider", Severity: model.SeverityError, Message: "gitlab is not supported"},
+				{Code: model.FindingUnsupported, Path: "spec.pullRequest.branch", Severity: model.SeverityWarning, Message: "is ignored for strategy branch"},
+			},
+		},
+		{
+			name: "branch config with ssh url",
+			args: args{
+				config: model.PromotionConfig{
+					Spec: model.PromotionConfigSpec{
+						Strategy: stradr("branch"),
+						Target: model.Target{
+							Repo:     stradr("git@github.com:test/test.git"),
+							Secret:   stradr("deploykey"),
+							Provider: stradr("github"),
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "branch config with ssh url to other host",
+			args: args{
+				config: model.PromotionConfig{
+					Spec: model.PromotionConfigSpec{
+						Strategy: stradr("branch"),
+						Target: model.Target{
+							Repo:     stradr("ssh://git@gitlab.com/test/test.git"),
+							Secret:   stradr("deploykey"),
+							Provider: stradr("github"),
+						},
+					},
+				},
+			},
+			wantFindings: []model.Finding{
+				model.NewError(model.FindingUnsupported, "spec.target.repo", `must be a "https" or SSH url to a repository on github.com`),
+			},
+		},
+		{
+			name: "branch config with repository url without name",
+			args: args{
+				config: model.PromotionConfig{
+					Spec: model.PromotionConfigSpec{
+						Strategy: stradr("branch"),
+						Target: model.Target{
+							Repo:     stradr("https://github.com/test/"),
+							Secret:   stradr("hallosecret"),
+							Provider: stradr("github"),
+						},
+					},
+				},
+			},
+			wantFindings: []model.Finding{
+				model.NewError(model.FindingInvalid, "spec.target.repo", "is not a valid URL"),
+			},
+		},
+		{
+			name: "invalid merge directives",
+			args: args{
+				config: model.PromotionConfig{
+					Spec: model.PromotionConfigSpec{
+						Strategy: stradr("flat-pr"),
+						Target: model.Target{
+							Repo:     stradr("https://github.com/test/test"),
+							Secret:   stradr("hallosecret"),
+							Provider: stradr("github"),
+						},
+						Paths: []model.Path{
+							{
+								ID:     stradr("app"),
+								Patch:  stradr("replace"),
+								Target: stradr("app"),
+							},
+						},
+						Merge: map[string]string{
+							"paths":             "replace",
+							"replacement.rules": "merge",
+							"target.repo":       "replace",
+						},
+					},
+				},
+			},
+			wantFindings: []model.Finding{
+				model.NewError(model.FindingInvalid, "spec.paths[0].$patch", "replace is invalid"),
+				model.NewError(model.FindingInvalid, "spec.merge.replacement.rules", "merge is invalid"),
+				model.NewError(model.FindingUnsupported, "spec.merge.target.repo", "is not a list or map"),
 			},
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			validator := NewValidator()
-			if gotValidationErrrors := validator.Validate(tt.args.config); !reflect.DeepEqual(gotValidationErrrors, tt.wantValidationErrrors) {
-				t.Errorf("validateConfig() = %v, want %v", gotValidationErrrors, tt.wantValidationErrrors)
+			if gotFindings := validator.Validate(tt.args.config); !reflect.DeepEqual(gotFindings, tt.wantFindings) {
+				t.Errorf("validateConfig() = %v, want %v", gotFindings, tt.wantFindings)
 			}
 		})
 	}
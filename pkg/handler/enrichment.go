@@ -0,0 +1,61 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"keptn/git-promotion-service/pkg/replacer"
+
+	"github.com/keptn/go-utils/pkg/api/models"
+	api "github.com/keptn/go-utils/pkg/api/utils/v2"
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+	logger "github.com/sirupsen/logrus"
+)
+
+const eventsKeyPrefix = "events."
+const keptnEventTypePrefix = "sh.keptn.event."
+
+// enrichFields adds the values of earlier events of the sequence to fields and values. For every configured event type
+// (e.g. deployment.finished) the latest event of the stage is flattened with the prefix events.<type>.
+// (e.g. events.deployment.finished.data.result). Event types without an event are skipped
+func enrichFields(events api.EventsInterface, inputEvent GitPromotionTriggeredEventData, shkeptncontext string, eventTypes []string,
+	fields map[string]string, values map[string]interface{}) error {
+	for _, eventType := range eventTypes {
+		found, errObj := events.GetEvents(context.Background(), &api.EventFilter{
+			Project:      inputEvent.Project,
+			Stage:        inputEvent.Stage,
+			Service:      inputEvent.Service,
+			EventType:    keptnEventTypePrefix + eventType,
+			KeptnContext: shkeptncontext,
+		}, api.EventsGetEventsOptions{})
+		if errObj != nil {
+			return fmt.Errorf("could not read %s events of sequence %s: %s", eventType, shkeptncontext, errObj.GetMessage())
+		}
+		latest := latestEvent(found)
+		if latest == nil {
+			logger.WithField("func", "enrichFields").Infof("no %s event found in sequence %s => skipping", eventType, shkeptncontext)
+			continue
+		}
+		eventFields, eventValues, err := replacer.ConvertToMap(keptnv2.ToCloudEvent(*latest))
+		if err != nil {
+			return fmt.Errorf("could not read %s event %s: %w", eventType, latest.ID, err)
+		}
+		prefix := eventsKeyPrefix + eventType + "."
+		for k, v := range eventFields {
+			fields[prefix+k] = v
+		}
+		for k, v := range eventValues {
+			values[prefix+k] = v
+		}
+		logger.WithField("func", "enrichFields").Infof("added %d values of %s event %s", len(eventFields), eventType, latest.ID)
+	}
+	return nil
+}
+
+func latestEvent(events []*models.KeptnContextExtendedCE) (latest *models.KeptnContextExtendedCE) {
+	for _, e := range events {
+		if e != nil && e.Type != nil && e.Source != nil && (latest == nil || e.Time.After(latest.Time)) {
+			latest = e
+		}
+	}
+	return latest
+}
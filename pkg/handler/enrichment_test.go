@@ -0,0 +1,100 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/keptn/go-utils/pkg/api/models"
+	api "github.com/keptn/go-utils/pkg/api/utils/v2"
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+)
+
+// fakeEvents returns the events by event type and records the filters
+type fakeEvents struct {
+	events  map[string][]*models.KeptnContextExtendedCE
+	filters []api.EventFilter
+	err     *models.Error
+}
+
+func (f *fakeEvents) GetEvents(_ context.Context, filter *api.EventFilter, _ api.EventsGetEventsOptions) ([]*models.KeptnContextExtendedCE, *models.Error) {
+	f.filters = append(f.filters, *filter)
+	if f.err != nil {
+		return nil, f.err
+	}
+	return f.events[filter.EventType], nil
+}
+
+func (f *fakeEvents) GetEventsWithRetry(_ context.Context, _ *api.EventFilter, _ int, _ time.Duration, _ api.EventsGetEventsWithRetryOptions) ([]*models.KeptnContextExtendedCE, error) {
+	return nil, errors.New("not implemented")
+}
+
+func newTestEvent(eventType string, at time.Time, data interface{}) *models.KeptnContextExtendedCE {
+	source := "test"
+	return &models.KeptnContextExtendedCE{
+		ID:             eventType + at.Format(time.RFC3339),
+		Type:           &eventType,
+		Source:         &source,
+		Specversion:    "1.0",
+		Contenttype:    "application/json",
+		Shkeptncontext: "mycontext",
+		Time:           at,
+		Data:           data,
+	}
+}
+
+func Test_enrichFields(t *testing.T) {
+	now := time.Now()
+	events := &fakeEvents{events: map[string][]*models.KeptnContextExtendedCE{
+		"sh.keptn.event.deployment.finished": {
+			newTestEvent("sh.keptn.event.deployment.finished", now.Add(-time.Hour), map[string]interface{}{
+				"deployment": map[string]interface{}{"image": "ghcr.io/test/app:1.0.0"},
+			}),
+			newTestEvent("sh.keptn.event.deployment.finished", now, map[string]interface{}{
+				"deployment": map[string]interface{}{"image": "ghcr.io/test/app:1.1.0@sha256:1234"},
+			}),
+		},
+		"sh.keptn.event.evaluation.finished": {
+			newTestEvent("sh.keptn.event.evaluation.finished", now, map[string]interface{}{
+				"evaluation": map[string]interface{}{"score": 95},
+			}),
+		},
+	}}
+	inputEvent := GitPromotionTriggeredEventData{EventData: keptnv2.EventData{Project: "prj", Stage: "dev", Service: "svc"}}
+	fields := map[string]string{"data.project": "prj"}
+	values := map[string]interface{}{"data.project": "prj"}
+
+	err := enrichFields(events, inputEvent, "mycontext", []string{"deployment.finished", "evaluation.finished", "release.finished"}, fields, values)
+	if err != nil {
+		t.Fatalf("enrichFields() error = %v", err)
+	}
+	for k, want := range map[string]string{
+		"data.project": "prj",
+		"events.deployment.finished.data.deployment.image": "ghcr.io/test/app:1.1.0@sha256:1234",
+		"events.evaluation.finished.data.evaluation.score": "95",
+		"events.evaluation.finished.shkeptncontext":        "mycontext",
+	} {
+		if fields[k] != want {
+			t.Errorf("enrichFields() %s = %v, want %v", k, fields[k], want)
+		}
+	}
+	if values["events.evaluation.finished.data.evaluation.score"] != int64(95) {
+		t.Errorf("enrichFields() typed score = %#v", values["events.evaluation.finished.data.evaluation.score"])
+	}
+	if len(events.filters) != 3 {
+		t.Fatalf("enrichFields() requested %d event types, want 3", len(events.filters))
+	}
+	if f := events.filters[0]; f.KeptnContext != "mycontext" || f.Project != "prj" || f.Stage != "dev" || f.Service != "svc" {
+		t.Errorf("enrichFields() unexpected filter %+v", f)
+	}
+}
+
+func Test_enrichFields_apiError(t *testing.T) {
+	events := &fakeEvents{err: &models.Error{Code: 500, Message: github.String("internal error")}}
+	err := enrichFields(events, GitPromotionTriggeredEventData{}, "mycontext", []string{"deployment.finished"}, map[string]string{}, map[string]interface{}{})
+	if err == nil {
+		t.Errorf("enrichFields() expected error")
+	}
+}
@@ -2,44 +2,180 @@ package handler
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	promotionconfig "keptn/git-promotion-service/pkg/config"
+	"keptn/git-promotion-service/pkg/keptn"
 	"keptn/git-promotion-service/pkg/model"
+	"keptn/git-promotion-service/pkg/placeholder"
 	"keptn/git-promotion-service/pkg/promoter"
+	"keptn/git-promotion-service/pkg/registry"
 	"keptn/git-promotion-service/pkg/replacer"
 	"keptn/git-promotion-service/pkg/repoaccess"
+	"keptn/git-promotion-service/pkg/secrets"
+	"net/http"
 	"os"
+	"strconv"
 	"strings"
-
-	keptn_interface "keptn-contrib/git-promotion-service/pkg/keptn"
+	"time"
+	"unicode/utf8"
 
 	cloudevents "github.com/cloudevents/sdk-go/v2"
 	"github.com/keptn/go-utils/pkg/api/models"
 	api "github.com/keptn/go-utils/pkg/api/utils/v2"
 	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
 	logger "github.com/sirupsen/logrus"
-	"gopkg.in/yaml.v3"
-	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/client-go/kubernetes"
 )
 
 const GitPromotionTaskName = "git-promotion"
 const keptnPullRequestTitlePrefix = "keptn:"
-const configurationResource = GitPromotionTaskName + ".yaml"
+const registryTimeout = 30 * time.Second
+const shipyardResource = "shipyard.yaml"
+const gitCommitIDExtension = "gitcommitid"
+const configHashLabel = "gitpromotion.confighash"
+const dryRunLabel = "dryrun"
+
+// pullRequestLabel is the label of the finished event with the pull request link, with more than one next stage it
+// is suffixed with the stage (e.g. pullrequest.prod-eu)
+const pullRequestLabel = "pullrequest"
+const defaultSecretKey = "access-token"
+const sshPrivateKeyKey = "ssh-privatekey"
+const knownHostsKey = "known_hosts"
+
+// SecretNamespaceAllowListVariable is the environment variable with the comma separated namespaces allowed in
+// spec.target.secretNamespace
+const SecretNamespaceAllowListVariable = "SECRET_NAMESPACE_ALLOWLIST"
+
+// maxDryRunDiffSize limits the size of the diff of a stage in the finished event
+const maxDryRunDiffSize = 256 * 1024
+
+// errLastStage is returned by NextStages if there is no stage to promote to
+var errLastStage = errors.New("no stage after the last stage")
 
 type GitPromotionTriggeredEventHandler struct {
-	keptn      *keptnv2.Keptn
-	api        *api.APISet
-	kubeClient *kubernetes.Clientset
+	keptn *keptnv2.Keptn
+	Dependencies
+}
+
+// Dependencies are the systems the handler reads from and writes to
+type Dependencies struct {
+	// Resources reads the configuration and the shipyard
+	Resources keptn.ResourcesInterface
+	// Events reads the earlier events of the sequence
+	Events api.EventsInterface
+	// Secrets reads the target and registry secrets
+	Secrets secrets.Source
+	// SecretNamespaces are the namespaces allowed in spec.target.secretNamespace
+	SecretNamespaces []string
+	// NewRepository returns the client of the target repository
+	NewRepository RepositoryFactory
+}
+
+// RepositoryClient is the access to the target repository used by the strategies
+type RepositoryClient interface {
+	promoter.Repository
+	promoter.BranchRepository
+}
+
+// RepositoryCredentials are read from the target secret. PrivateKey and KnownHosts are only read for SSH URLs
+type RepositoryCredentials struct {
+	AccessToken string
+	PrivateKey  []byte
+	KnownHosts  []byte
+}
+
+// RepositoryFactory returns the client of the repository with the url using the credentials of the target secret. A
+// client implementing io.Closer is closed after the promotion
+type RepositoryFactory func(credentials RepositoryCredentials, repositoryURL string) (RepositoryClient, error)
+
+// NewGithubRepository returns the client of a github repository. Repositories with SSH URLs are cloned with the
+// private key, pull requests are only created with an access token
+func NewGithubRepository(credentials RepositoryCredentials, repositoryURL string) (RepositoryClient, error) {
+	locator, err := repoaccess.ParseLocator(repositoryURL)
+	if err != nil {
+		return nil, err
+	}
+	if locator.IsSSH() {
+		repository, err := repoaccess.NewSSHRepository(locator.String(), credentials.PrivateKey, credentials.KnownHosts)
+		if err != nil {
+			return nil, err
+		}
+		if credentials.AccessToken != "" {
+			client, err := repoaccess.NewClient(credentials.AccessToken, locator.HTTPSURL())
+			if err != nil {
+				repository.Close()
+				return nil, err
+			}
+			repository.PullRequests = &client
+		}
+		return repository, nil
+	}
+	client, err := repoaccess.NewClient(credentials.AccessToken, repositoryURL)
+	if err != nil {
+		return nil, err
+	}
+	return &client, nil
 }
 
 type GitPromotionTriggeredEventData struct {
 	keptnv2.EventData
 }
 
-// NewGitPromotionTriggeredEventHandler returns a new GitPromotionTriggeredEventHandler
-func NewGitPromotionTriggeredEventHandler(keptn *keptnv2.Keptn, api *api.APISet, kubeClient *kubernetes.Clientset) *GitPromotionTriggeredEventHandler {
-	return &GitPromotionTriggeredEventHandler{keptn: keptn, api: api, kubeClient: kubeClient}
+// GitPromotionFinishedEventData is the data of the finished event
+type GitPromotionFinishedEventData struct {
+	keptnv2.EventData
+	GitPromotion *GitPromotionFinishedData `json:"gitPromotion,omitempty"`
+}
+
+// GitPromotionFinishedData contains the details of the promotion
+type GitPromotionFinishedData struct {
+	Findings []StageFinding `json:"findings,omitempty"`
+	// DryRun is true if the changes were computed without creating branches, commits and pull requests
+	DryRun bool `json:"dryRun,omitempty"`
+	// Changes are the changes of the dry run by stage
+	Changes []StageChanges `json:"changes,omitempty"`
+}
+
+// StageChanges are the changes the promotion to the stage would commit
+type StageChanges struct {
+	Stage string   `json:"stage"`
+	Files []string `json:"files"`
+	Diff  string   `json:"diff"`
+	// DiffTruncated is true if the diff was cut at 256 KiB
+	DiffTruncated bool `json:"diffTruncated,omitempty"`
+}
+
+// StageFinding is a finding of the validation or the promotion to the stage. Stage is empty for findings of reading
+// the configuration, which apply to all stages
+type StageFinding struct {
+	Stage string `json:"stage,omitempty"`
+	model.Finding
+}
+
+func stageFindings(stage string, findings []model.Finding) (stageFindings []StageFinding) {
+	for _, f := range findings {
+		stageFindings = append(stageFindings, StageFinding{Stage: stage, Finding: f})
+	}
+	return stageFindings
+}
+
+// NewGitPromotionTriggeredEventHandler returns a new GitPromotionTriggeredEventHandler reading from the keptn API and
+// the secrets of secretSource and promoting to github repositories
+func NewGitPromotionTriggeredEventHandler(keptn *keptnv2.Keptn, api *api.APISet, secretSource secrets.Source) *GitPromotionTriggeredEventHandler {
+	return NewGitPromotionTriggeredEventHandlerWithDependencies(keptn, Dependencies{
+		Resources:        api.Resources(),
+		Events:           api.Events(),
+		Secrets:          secretSource,
+		SecretNamespaces: AllowedSecretNamespaces(),
+		NewRepository:    NewGithubRepository,
+	})
+}
+
+// NewGitPromotionTriggeredEventHandlerWithDependencies returns a new GitPromotionTriggeredEventHandler using the given
+// dependencies (e.g. to replay an event)
+func NewGitPromotionTriggeredEventHandlerWithDependencies(keptn *keptnv2.Keptn, dependencies Dependencies) *GitPromotionTriggeredEventHandler {
+	return &GitPromotionTriggeredEventHandler{keptn: keptn, Dependencies: dependencies}
 }
 
 // IsTypeHandled godoc
@@ -63,67 +199,329 @@ func (a *GitPromotionTriggeredEventHandler) handleGitPromotionTriggeredEvent(eve
 	logger.WithField("func", "handleGitPromotionTriggeredEvent").Infof("start promoting service %s in project %s from stage %s", inputEvent.Stage, inputEvent.Service, inputEvent.Project)
 	if err := a.keptn.SendCloudEvent(*a.getGitPromotionStartedEvent(inputEvent, triggeredID, shkeptncontext)); err != nil {
 		logger.WithField("func", "handleGitPromotionTriggeredEvent").WithError(err).Errorf("sending started event failed")
-		return []cloudevents.Event{*a.getGitPromotionFinishedEvent(inputEvent, keptnv2.StatusErrored, keptnv2.ResultFailed, "sending starting event failed", triggeredID, shkeptncontext, nil)}
+		return []cloudevents.Event{*a.getGitPromotionFinishedEvent(inputEvent, keptnv2.StatusErrored, keptnv2.ResultFailed, "sending starting event failed", triggeredID, shkeptncontext, nil, nil)}
 	}
 	outgoingEvents := make([]cloudevents.Event, 0)
-	var nextStage string
-	if nextStageTemp, err := a.getNextStage(inputEvent.Project, inputEvent.Stage); err != nil {
+	var gitCommitID string
+	_ = event.ExtensionAs(gitCommitIDExtension, &gitCommitID)
+	config, configHash, configFindings, err := a.getMergedConfiguration(inputEvent, gitCommitID)
+	if err != nil {
+		logger.WithField("func", "handleGitPromotionTriggeredEvent").WithError(err).Errorf("error while reading configuration for commit %s", gitCommitID)
+		return []cloudevents.Event{*a.getGitPromotionFinishedEvent(inputEvent, keptnv2.StatusErrored, keptnv2.ResultFailed, "error while reading configuration: "+err.Error(), triggeredID, shkeptncontext, nil, nil)}
+	}
+	logger.WithField("func", "handleGitPromotionTriggeredEvent").Infof("read configuration with hash %s for commit %s", configHash, gitCommitID)
+	configLabels := map[string]string{configHashLabel: configHash}
+	for _, f := range configFindings {
+		if f.Severity == model.SeverityWarning {
+			logger.WithField("func", "handleGitPromotionTriggeredEvent").Warnf("configuration warning: %s", f.String())
+		}
+	}
+	if errs := model.Errors(configFindings); len(errs) > 0 {
+		logger.WithField("func", "handleGitPromotionTriggeredEvent").Errorf("validation of configuration failed: %s", joinFindings(errs))
+		return []cloudevents.Event{*a.getGitPromotionFinishedEvent(inputEvent, keptnv2.StatusErrored, keptnv2.ResultFailed, "validation error: "+joinFindings(errs), triggeredID, shkeptncontext, configLabels, &GitPromotionFinishedData{Findings: stageFindings("", configFindings)})}
+	}
+	nextStages, err := NextStages(config.Spec, inputEvent.Stage, func() (*models.Resource, error) {
+		return a.Resources.GetResource(context.Background(), *api.NewResourceScope().Project(inputEvent.Project).Resource(shipyardResource), api.ResourcesGetResourceOptions{})
+	})
+	if errors.Is(err, errLastStage) {
+		logger.WithField("func", "handleGitPromotionTriggeredEvent").Infof("stage %s is the last stage of project %s => nothing to promote", inputEvent.Stage, inputEvent.Project)
+		return []cloudevents.Event{*a.getGitPromotionFinishedEvent(inputEvent, keptnv2.StatusSucceeded, keptnv2.ResultPass, fmt.Sprintf("stage %s is the last stage => nothing to promote", inputEvent.Stage), triggeredID, shkeptncontext, configLabels, nil)}
+	} else if err != nil {
 		logger.WithField("func", "handleGitPromotionTriggeredEvent").WithError(err).Error("handleGitPromotionTriggeredEvent: error while reading nextStage")
-		return []cloudevents.Event{*a.getGitPromotionFinishedEvent(inputEvent, keptnv2.StatusErrored, keptnv2.ResultFailed, "error while reading nextStage", triggeredID, shkeptncontext, nil)}
-	} else {
-		nextStage = nextStageTemp
-	}
-	config := a.getMergedConfiguration(inputEvent.GetProject(), inputEvent.GetStage(), nextStage, inputEvent.GetService())
-	logger.WithField("func", "handleGitPromotionTriggeredEvent").Infof("using git promotion config: strategy: %s, repository: %s, secret: %s", toString(config.Spec.Strategy), toString(config.Spec.Target.Repo), toString(config.Spec.Target.Secret))
-	var status keptnv2.StatusType
-	var result keptnv2.ResultType
-	var message string
-	var prLink *string
-	if vs := promotionconfig.NewValidator().Validate(config); len(vs) > 0 {
-		logger.WithField("func", "handleGitPromotionTriggeredEvent").Errorf("validation of configuration failed: %s", strings.Join(vs, ","))
-		status = keptnv2.StatusErrored
-		result = keptnv2.ResultFailed
-		message = "validation error: " + strings.Join(vs, ",")
-	} else if accessToken, err := a.getAccessToken(*config.Spec.Target.Secret); err != nil {
-		logger.WithField("func", "handleGitPromotionTriggeredEvent").WithError(err).Errorf("handleGitPromotionTriggeredEvent: error while reading secret with name %s", *config.Spec.Target.Secret)
-		status = keptnv2.StatusErrored
-		result = keptnv2.ResultFailed
-		message = "error while reading secret"
-	} else if client, err := repoaccess.NewClient(accessToken, *config.Spec.Target.Repo); err != nil {
-		logger.WithField("func", "handleGitPromotionTriggeredEvent").WithError(err).Errorf("handleGitPromotionTriggeredEvent: error while creating client for repo")
-		status = keptnv2.StatusErrored
-		result = keptnv2.ResultFailed
-		message = "error while reading secret"
-	} else if *config.Spec.Strategy == model.StrategyBranch {
-		status, result, message, prLink = handleBranchStrategy(client, inputEvent, config, shkeptncontext, nextStage)
-	} else if *config.Spec.Strategy == model.StrategyFlatPR {
-		status, result, message, prLink = handleFlatPRStrategy(client, event, inputEvent, config, shkeptncontext, nextStage)
-	} else {
-		status = keptnv2.StatusErrored
-		result = keptnv2.ResultFailed
-		message = "unimplemented strategy"
+		return []cloudevents.Event{*a.getGitPromotionFinishedEvent(inputEvent, keptnv2.StatusErrored, keptnv2.ResultFailed, "error while reading nextStage: "+err.Error(), triggeredID, shkeptncontext, configLabels, nil)}
+	}
+	logger.WithField("func", "handleGitPromotionTriggeredEvent").Infof("promoting from stage %s to stages %s", inputEvent.Stage, strings.Join(nextStages, ", "))
+	fields, values, err := replacer.ConvertToMap(event)
+	if err != nil {
+		logger.WithField("func", "handleGitPromotionTriggeredEvent").WithError(err).Error("error while reading event data")
+		return []cloudevents.Event{*a.getGitPromotionFinishedEvent(inputEvent, keptnv2.StatusErrored, keptnv2.ResultFailed, "error while reading event data: "+err.Error(), triggeredID, shkeptncontext, configLabels, nil)}
+	}
+	if len(config.Spec.Enrichment.Events) > 0 {
+		if err := enrichFields(a.Events, inputEvent, shkeptncontext, config.Spec.Enrichment.Events, fields, values); err != nil {
+			logger.WithField("func", "handleGitPromotionTriggeredEvent").WithError(err).Error("error while reading events of sequence")
+			return []cloudevents.Event{*a.getGitPromotionFinishedEvent(inputEvent, keptnv2.StatusErrored, keptnv2.ResultFailed, fmt.Sprintf("error while reading events of sequence: %v", err), triggeredID, shkeptncontext, configLabels, nil)}
+		}
+	}
+	dryRun, dryRunFinding := isDryRun(config.Spec, inputEvent.Labels)
+	if dryRunFinding != nil {
+		logger.WithField("func", "handleGitPromotionTriggeredEvent").Errorf("validation of labels failed: %s", dryRunFinding.String())
+		return []cloudevents.Event{*a.getGitPromotionFinishedEvent(inputEvent, keptnv2.StatusErrored, keptnv2.ResultFailed, "validation error: "+dryRunFinding.String(), triggeredID, shkeptncontext, configLabels, &GitPromotionFinishedData{Findings: stageFindings("", append(configFindings, *dryRunFinding))})}
 	}
-	finishedEvent := a.getGitPromotionFinishedEvent(inputEvent, status, result, message, triggeredID, shkeptncontext, prLink)
+	if dryRun {
+		logger.WithField("func", "handleGitPromotionTriggeredEvent").Info("dry run => no branches, commits and pull requests are created")
+	}
+	if branchFindings := checkBranchNames(inputEvent, config, fields, nextStages); len(branchFindings) > 0 {
+		logger.WithField("func", "handleGitPromotionTriggeredEvent").Errorf("validation of branch names failed: %s", joinFindings(branchFindings))
+		return []cloudevents.Event{*a.getGitPromotionFinishedEvent(inputEvent, keptnv2.StatusErrored, keptnv2.ResultFailed, "validation error: "+joinFindings(branchFindings), triggeredID, shkeptncontext, configLabels, &GitPromotionFinishedData{Findings: stageFindings("", append(configFindings, branchFindings...))})}
+	}
+	var results []stageResult
+	for _, nextStage := range nextStages {
+		results = append(results, a.promoteToStage(inputEvent, config, replacer.CopyFields(fields), values, shkeptncontext, nextStage, dryRun))
+	}
+	status, result, message, prLinks, findings := aggregateResults(results)
+	findings = append(stageFindings("", configFindings), findings...)
+	labels := pullRequestLabels(prLinks)
+	labels[configHashLabel] = configHash
+	var details *GitPromotionFinishedData
+	if len(findings) > 0 || dryRun {
+		details = &GitPromotionFinishedData{Findings: findings, DryRun: dryRun, Changes: dryRunChanges(results)}
+	}
+	finishedEvent := a.getGitPromotionFinishedEvent(inputEvent, status, result, message, triggeredID, shkeptncontext, labels, details)
 	outgoingEvents = append(outgoingEvents, *finishedEvent)
 	return outgoingEvents
 }
 
-func handleFlatPRStrategy(client repoaccess.Client, event cloudevents.Event, inputEvent GitPromotionTriggeredEventData, config model.PromotionConfig, shkeptncontext, nextStage string) (status keptnv2.StatusType, result keptnv2.ResultType, message string, prLink *string) {
+// stageResult is the result of the promotion to one of the next stages
+type stageResult struct {
+	stage    string
+	status   keptnv2.StatusType
+	result   keptnv2.ResultType
+	message  string
+	prLink   *string
+	findings []model.Finding
+	// changes are the changes computed by a dry run
+	changes *promoter.DryRunResult
+}
+
+// promoteToStage runs the configured strategy for nextStage. The placeholders of config are resolved for nextStage.
+// With dryRun the changes are only computed
+func (a *GitPromotionTriggeredEventHandler) promoteToStage(inputEvent GitPromotionTriggeredEventData, config model.PromotionConfig, fields map[string]string, values map[string]interface{}, shkeptncontext, nextStage string, dryRun bool) (res stageResult) {
+	res.stage = nextStage
+	resolver := placeholder.NewResolver(promotionconfig.Builtins(inputEvent.GetProject(), inputEvent.GetStage(), nextStage, inputEvent.GetService()), fields)
+	config, res.findings = promotionconfig.ResolveAndValidate(config, resolver)
+	logger.WithField("func", "promoteToStage").Infof("using git promotion config for stage %s: strategy: %s, repository: %s, secret: %s", nextStage, toString(config.Spec.Strategy), toString(config.Spec.Target.Repo), toString(config.Spec.Target.Secret))
+	for _, f := range res.findings {
+		if f.Severity == model.SeverityWarning {
+			logger.WithField("func", "promoteToStage").Warnf("validation warning: %s", f.String())
+		}
+	}
+	if errs := model.Errors(res.findings); len(errs) > 0 {
+		logger.WithField("func", "promoteToStage").Errorf("validation of configuration failed: %s", joinFindings(errs))
+		res.status = keptnv2.StatusErrored
+		res.result = keptnv2.ResultFailed
+		res.message = "validation error: " + joinFindings(errs)
+	} else if credentials, finding, err := a.getCredentials(config.Spec.Target); err != nil {
+		logger.WithField("func", "promoteToStage").WithError(err).Errorf("error while reading secret with name %s", *config.Spec.Target.Secret)
+		res.status = keptnv2.StatusErrored
+		res.result = keptnv2.ResultFailed
+		res.message = "error while reading secret"
+		if finding != nil {
+			res.findings = append(res.findings, *finding)
+			res.message += ": " + finding.String()
+		}
+	} else if client, err := a.NewRepository(credentials, *config.Spec.Target.Repo); err != nil {
+		logger.WithField("func", "promoteToStage").WithError(err).Errorf("error while creating client for repo")
+		res.status = keptnv2.StatusErrored
+		res.result = keptnv2.ResultFailed
+		res.message = "error while accessing repository: " + err.Error()
+	} else {
+		// repositories accessed over SSH remove their local clone
+		if closer, ok := client.(io.Closer); ok {
+			defer closer.Close()
+		}
+		switch {
+		case *config.Spec.Strategy == model.StrategyBranch:
+			reportFinding := func(finding model.Finding) {
+				logger.WithField("func", "promoteToStage").Warnf("promotion warning: %s", finding.String())
+				res.findings = append(res.findings, finding)
+			}
+			var verify promoter.Verifier
+			if config.Spec.Registry.VerifyImages != nil && *config.Spec.Registry.VerifyImages {
+				registryClient, err := a.getRegistryClient(config.Spec.Registry, reportFinding)
+				if err != nil {
+					logger.WithField("func", "promoteToStage").WithError(err).Errorf("error while creating registry client")
+					res.status, res.result, res.message = keptnv2.StatusErrored, keptnv2.ResultFailed, "error while reading registry secret"
+					break
+				}
+				verify = imageVerifier(registryClient)
+			}
+			if dryRun {
+				res.status, res.result, res.message, res.changes = dryRunBranchStrategy(client, inputEvent, config, nextStage, verify)
+			} else {
+				res.status, res.result, res.message, res.prLink = handleBranchStrategy(client, inputEvent, config, shkeptncontext, nextStage, verify, reportFinding)
+			}
+		case *config.Spec.Strategy == model.StrategyFlatPR:
+			var findings []model.Finding
+			res.status, res.result, res.message, res.prLink, res.changes, findings = a.handleFlatPRStrategy(client, fields, values, inputEvent, config, shkeptncontext, nextStage, dryRun)
+			res.findings = append(res.findings, findings...)
+		default:
+			res.status = keptnv2.StatusErrored
+			res.result = keptnv2.ResultFailed
+			res.message = "unimplemented strategy"
+		}
+	}
+	return res
+}
+
+// aggregateResults combines the results of all next stages. The promotion fails if one of the stages failed. With more
+// than one stage the messages are prefixed with the stage
+func aggregateResults(results []stageResult) (status keptnv2.StatusType, result keptnv2.ResultType, message string, prLinks map[string]string, findings []StageFinding) {
+	status = keptnv2.StatusSucceeded
+	result = keptnv2.ResultPass
+	prLinks = make(map[string]string)
+	var messages []string
+	for _, r := range results {
+		if r.result == keptnv2.ResultFailed {
+			status = r.status
+			result = r.result
+		}
+		if r.prLink != nil {
+			prLinks[r.stage] = *r.prLink
+		}
+		findings = append(findings, stageFindings(r.stage, r.findings)...)
+		if len(results) == 1 {
+			messages = append(messages, r.message)
+		} else {
+			messages = append(messages, r.stage+": "+r.message)
+		}
+	}
+	return status, result, strings.Join(messages, "; "), prLinks, findings
+}
+
+// isDryRun returns true if spec.dryRun is set or the triggered event has the label dryrun without value or with a true
+// value (as parsed by strconv.ParseBool). Other values of the label are returned as error finding
+func isDryRun(spec model.PromotionConfigSpec, labels map[string]string) (dryRun bool, finding *model.Finding) {
+	value, ok := labels[dryRunLabel]
+	if ok && value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			f := model.NewError(model.FindingInvalid, "labels."+dryRunLabel, "value %s is not a boolean", value)
+			return false, &f
+		}
+		dryRun = parsed
+	} else if ok {
+		dryRun = true
+	}
+	return dryRun || (spec.DryRun != nil && *spec.DryRun), nil
+}
+
+// dryRunChanges returns the changes of all stages computed by a dry run. Diffs exceeding maxDryRunDiffSize are truncated
+func dryRunChanges(results []stageResult) (changes []StageChanges) {
+	for _, r := range results {
+		if r.changes == nil {
+			continue
+		}
+		c := StageChanges{Stage: r.stage, Files: r.changes.Files, Diff: r.changes.Diff}
+		if c.Files == nil {
+			c.Files = []string{}
+		}
+		if len(c.Diff) > maxDryRunDiffSize {
+			c.Diff, c.DiffTruncated = truncateDiff(c.Diff, maxDryRunDiffSize), true
+		}
+		changes = append(changes, c)
+	}
+	return changes
+}
+
+// truncateDiff returns the complete lines of diff fitting into size bytes. A first line longer than size is cut at
+// the last complete UTF-8 character
+func truncateDiff(diff string, size int) string {
+	if len(diff) <= size {
+		return diff
+	}
+	if i := strings.LastIndexByte(diff[:size], '\n'); i >= 0 {
+		return diff[:i+1]
+	}
+	for size > 0 && !utf8.RuneStart(diff[size]) {
+		size--
+	}
+	return diff[:size]
+}
+
+func joinFindings(findings []model.Finding) string {
+	messages := make([]string, 0, len(findings))
+	for _, f := range findings {
+		messages = append(messages, f.String())
+	}
+	return strings.Join(messages, ",")
+}
+
+// pullRequestLabels returns the pullRequestLabel for a single pull request or the label suffixed with the stage for every
+// pull request of multiple stages
+func pullRequestLabels(prLinks map[string]string) map[string]string {
+	labels := make(map[string]string)
+	for stage, prLink := range prLinks {
+		if len(prLinks) == 1 {
+			labels[pullRequestLabel] = prLink
+		} else {
+			labels[pullRequestLabel+"."+stage] = prLink
+		}
+	}
+	return labels
+}
+
+func (a *GitPromotionTriggeredEventHandler) handleFlatPRStrategy(client RepositoryClient, fields map[string]string, values map[string]interface{}, inputEvent GitPromotionTriggeredEventData, config model.PromotionConfig, shkeptncontext, nextStage string, dryRun bool) (status keptnv2.StatusType, result keptnv2.ResultType, message string, prLink *string, changes *promoter.DryRunResult, findings []model.Finding) {
 	p := promoter.NewFlatPrPromoter(client)
-	if msg, prlink, err := p.Promote(*config.Spec.Target.Repo, replacer.ConvertToMap(event), "main",
-		buildBranchName(inputEvent.Stage, nextStage, shkeptncontext),
-		buildTitle(shkeptncontext, nextStage),
-		buildBody(shkeptncontext, inputEvent.Project, inputEvent.Service, inputEvent.Stage), config.Spec.Paths); err != nil {
+	p.Values = values
+	p.ReportFinding = func(finding model.Finding) {
+		logger.WithField("func", "handleFlatPRStrategy").Warnf("promotion warning: %s", finding.String())
+		findings = append(findings, finding)
+	}
+	verifyImages := config.Spec.Registry.VerifyImages != nil && *config.Spec.Registry.VerifyImages
+	if len(config.Spec.Replacement.Digests) > 0 || verifyImages {
+		registryClient, err := a.getRegistryClient(config.Spec.Registry, p.ReportFinding)
+		if err != nil {
+			logger.WithField("func", "handleFlatPRStrategy").WithError(err).Errorf("error while creating registry client")
+			return keptnv2.StatusErrored, keptnv2.ResultFailed, "error while reading registry secret", nil, nil, findings
+		}
+		if err := registryClient.ResolveDigests(fields, toRegistryDigests(config.Spec.Replacement.Digests)); err != nil {
+			logger.WithField("func", "handleFlatPRStrategy").WithError(err).Errorf("error while resolving image digests")
+			return keptnv2.StatusErrored, keptnv2.ResultFailed, "error while resolving image digests: " + err.Error(), nil, nil, findings
+		}
+		if verifyImages {
+			p.Verify = imageVerifier(registryClient)
+		}
+	}
+	p.CommitMessage = stringOrDefault(config.Spec.PullRequest.CommitMessage, "")
+	p.Labels = config.Spec.PullRequest.Labels
+	branch := stringOrDefault(config.Spec.PullRequest.Branch, buildBranchName(inputEvent.Stage, nextStage, shkeptncontext))
+	var msg string
+	var prlink *string
+	var report replacer.Report
+	var err error
+	if dryRun {
+		var dryRunResult promoter.DryRunResult
+		dryRunResult, report, err = p.DryRun(fields, "main", branch, config.Spec.Paths, config.Spec.Replacement)
+		changes = &dryRunResult
+		if len(dryRunResult.Files) == 0 {
+			msg = "dry run: no changes detected"
+		} else {
+			msg = fmt.Sprintf("dry run: %d files would be changed in branch %s", len(dryRunResult.Files), branch)
+		}
+	} else {
+		msg, prlink, report, err = p.Promote(*config.Spec.Target.Repo, fields, "main", branch,
+			stringOrDefault(config.Spec.PullRequest.Title, buildTitle(shkeptncontext, nextStage)),
+			stringOrDefault(config.Spec.PullRequest.Body, buildBody(shkeptncontext, inputEvent.Project, inputEvent.Service, inputEvent.Stage)),
+			config.Spec.Paths, config.Spec.Replacement)
+	}
+	if errors.Is(err, promoter.ErrReplacementFindings) {
+		logger.WithField("func", "handleFlatPRStrategy").WithError(err).Errorf("flat pr strategy failed in strict replacement mode on repository %s", *config.Spec.Target.Repo)
+		return keptnv2.StatusErrored, keptnv2.ResultFailed, "strict replacement check failed (" + report.String() + ")", nil, nil, findings
+	} else if errors.Is(err, promoter.ErrVerification) {
+		logger.WithField("func", "handleFlatPRStrategy").WithError(err).Errorf("flat pr strategy failed because of missing images on repository %s", *config.Spec.Target.Repo)
+		return keptnv2.StatusErrored, keptnv2.ResultFailed, err.Error(), nil, nil, findings
+	} else if errors.Is(err, promoter.ErrBlockedUpdates) {
+		logger.WithField("func", "handleFlatPRStrategy").WithError(err).Errorf("flat pr strategy failed because of replacement constraints on repository %s", *config.Spec.Target.Repo)
+		return keptnv2.StatusErrored, keptnv2.ResultFailed, "replacement constraints blocked updates (" + report.String() + ")", nil, nil, findings
+	} else if err != nil {
 		logger.WithField("func", "handleFlatPRStrategy").WithError(err).Errorf("flat pr strategy failed on repository %s", *config.Spec.Target.Repo)
-		return keptnv2.StatusErrored, keptnv2.ResultFailed, "error while opening pull request", nil
+		return keptnv2.StatusErrored, keptnv2.ResultFailed, "error while opening pull request", nil, nil, findings
 	} else {
-		return keptnv2.StatusSucceeded, keptnv2.ResultPass, msg, prlink
+		return keptnv2.StatusSucceeded, keptnv2.ResultPass, msg + " (replacements: " + report.String() + ")", prlink, changes, findings
 	}
 }
 
-func handleBranchStrategy(client repoaccess.Client, inputEvent GitPromotionTriggeredEventData, config model.PromotionConfig, shkeptncontext, nextStage string) (status keptnv2.StatusType, result keptnv2.ResultType, message string, prLink *string) {
+func handleBranchStrategy(client RepositoryClient, inputEvent GitPromotionTriggeredEventData, config model.PromotionConfig, shkeptncontext, nextStage string, verify promoter.Verifier, reportFinding func(finding model.Finding)) (status keptnv2.StatusType, result keptnv2.ResultType, message string, prLink *string) {
 	p := promoter.NewBranchPromoter(client, keptnPullRequestTitlePrefix)
-	if msg, prLink, err := p.Promote(*config.Spec.Target.Repo, inputEvent.Stage, nextStage, buildTitle(shkeptncontext, nextStage), buildBody(shkeptncontext, inputEvent.Project, inputEvent.Service, inputEvent.Stage)); err != nil {
+	p.Labels = config.Spec.PullRequest.Labels
+	p.Verify = verify
+	p.ReportFinding = reportFinding
+	if msg, prLink, err := p.Promote(*config.Spec.Target.Repo, inputEvent.Stage, nextStage,
+		stringOrDefault(config.Spec.PullRequest.Title, buildTitle(shkeptncontext, nextStage)),
+		stringOrDefault(config.Spec.PullRequest.Body, buildBody(shkeptncontext, inputEvent.Project, inputEvent.Service, inputEvent.Stage))); errors.Is(err, promoter.ErrVerification) {
+		logger.WithField("func", "handleBranchStrategy").WithError(err).Errorf("branch strategy failed because of missing images on repository %s", *config.Spec.Target.Repo)
+		return keptnv2.StatusErrored, keptnv2.ResultFailed, err.Error(), nil
+	} else if err != nil {
 		logger.WithField("func", "handleBranchStrategy").WithError(err).Errorf("branch strategy failed on repository %s", *config.Spec.Target.Repo)
 		return keptnv2.StatusErrored, keptnv2.ResultFailed, "error while opening pull request", nil
 	} else {
@@ -131,6 +529,27 @@ func handleBranchStrategy(client repoaccess.Client, inputEvent GitPromotionTrigg
 	}
 }
 
+// dryRunBranchStrategy returns the changes the pull request from the stage branch to the nextStage branch would promote
+func dryRunBranchStrategy(client RepositoryClient, inputEvent GitPromotionTriggeredEventData, config model.PromotionConfig, nextStage string, verify promoter.Verifier) (status keptnv2.StatusType, result keptnv2.ResultType, message string, changes *promoter.DryRunResult) {
+	p := promoter.NewBranchPromoter(client, keptnPullRequestTitlePrefix)
+	p.Verify = verify
+	dryRunResult, err := p.DryRun(inputEvent.Stage, nextStage)
+	if errors.Is(err, promoter.ErrVerification) {
+		logger.WithField("func", "dryRunBranchStrategy").WithError(err).Errorf("branch strategy dry run failed because of missing images on repository %s", *config.Spec.Target.Repo)
+		return keptnv2.StatusErrored, keptnv2.ResultFailed, err.Error(), nil
+	} else if err != nil {
+		logger.WithField("func", "dryRunBranchStrategy").WithError(err).Errorf("branch strategy dry run failed on repository %s", *config.Spec.Target.Repo)
+		return keptnv2.StatusErrored, keptnv2.ResultFailed, "error while comparing branches", nil
+	}
+	if len(dryRunResult.Files) == 0 {
+		return keptnv2.StatusSucceeded, keptnv2.ResultPass, fmt.Sprintf("dry run: no difference between branches %s and %s found", inputEvent.Stage, nextStage), &dryRunResult
+	}
+	if dryRunResult.Note != "" {
+		return keptnv2.StatusSucceeded, keptnv2.ResultPass, fmt.Sprintf("dry run: %d files changed in branch %s, but %s", len(dryRunResult.Files), inputEvent.Stage, dryRunResult.Note), &dryRunResult
+	}
+	return keptnv2.StatusSucceeded, keptnv2.ResultPass, fmt.Sprintf("dry run: %d files would be changed by a pull request from branch %s to %s", len(dryRunResult.Files), inputEvent.Stage, nextStage), &dryRunResult
+}
+
 func buildTitle(keptncontext, nextStage string) string {
 	return fmt.Sprintf("%s Promote to stage %s (ctx: %s)", keptnPullRequestTitlePrefix, nextStage, keptncontext)
 }
@@ -143,6 +562,25 @@ Service: *%s*
 Stage: *%s*`, keptncontext, os.Getenv("EXTERNAL_URL"), projectName, keptncontext, stage, projectName, serviceName, stage)
 }
 
+// checkBranchNames returns an error finding if spec.pullRequest.branch of the flat-pr strategy resolves to the same
+// branch for more than one next stage (e.g. without ${nextstage}), the stages would overwrite each other's branch
+func checkBranchNames(inputEvent GitPromotionTriggeredEventData, config model.PromotionConfig, fields map[string]string, nextStages []string) (findings []model.Finding) {
+	if config.Spec.PullRequest.Branch == nil || config.Spec.Strategy == nil || *config.Spec.Strategy != model.StrategyFlatPR {
+		return nil
+	}
+	stages := make(map[string]string)
+	for _, nextStage := range nextStages {
+		resolver := placeholder.NewResolver(promotionconfig.Builtins(inputEvent.GetProject(), inputEvent.GetStage(), nextStage, inputEvent.GetService()), fields)
+		branch, _ := resolver.Resolve(*config.Spec.PullRequest.Branch)
+		if stage, exists := stages[branch]; exists {
+			findings = append(findings, model.NewError(model.FindingConflict, "spec.pullRequest.branch", "resolves to branch %s for stages %s and %s, use ${nextstage} for a branch per stage", branch, stage, nextStage))
+			continue
+		}
+		stages[branch] = nextStage
+	}
+	return findings
+}
+
 func buildBranchName(stage string, nextStage string, shkeptncontext string) string {
 	return fmt.Sprintf("promote/%s_%s-%s", stage, nextStage, shkeptncontext)
 }
@@ -159,135 +597,239 @@ func (a *GitPromotionTriggeredEventHandler) getGitPromotionStartedEvent(inputEve
 	return getCloudEvent(gitPromotionStartedEvent, keptnv2.GetStartedEventType(GitPromotionTaskName), shkeptncontext, triggeredID)
 }
 
+// getGitPromotionFinishedEvent returns the finished event with the labels of the triggered event and the additional labels
 func (a *GitPromotionTriggeredEventHandler) getGitPromotionFinishedEvent(inputEvent GitPromotionTriggeredEventData,
-	status keptnv2.StatusType, result keptnv2.ResultType, message string, triggeredID, shkeptncontext string, prLink *string) *cloudevents.Event {
-	labels := inputEvent.Labels
-	if prLink != nil {
-		labels["pullrequest"] = *prLink
+	status keptnv2.StatusType, result keptnv2.ResultType, message string, triggeredID, shkeptncontext string, additionalLabels map[string]string, details *GitPromotionFinishedData) *cloudevents.Event {
+	labels := make(map[string]string)
+	for _, m := range []map[string]string{inputEvent.Labels, additionalLabels} {
+		for k, v := range m {
+			labels[k] = v
+		}
 	}
-	gitPromotionFinishedEvent := keptnv2.EventData{
-		Project: inputEvent.Project,
-		Stage:   inputEvent.Stage,
-		Service: inputEvent.Service,
-		Labels:  labels,
-		Status:  status,
-		Result:  result,
-		Message: message,
+	gitPromotionFinishedEvent := GitPromotionFinishedEventData{
+		EventData: keptnv2.EventData{
+			Project: inputEvent.Project,
+			Stage:   inputEvent.Stage,
+			Service: inputEvent.Service,
+			Labels:  labels,
+			Status:  status,
+			Result:  result,
+			Message: message,
+		},
+		GitPromotion: details,
 	}
 	return getCloudEvent(gitPromotionFinishedEvent, keptnv2.GetFinishedEventType(GitPromotionTaskName), shkeptncontext, triggeredID)
 }
 
-func (a *GitPromotionTriggeredEventHandler) getAccessToken(secretName string) (accessToken string, err error) {
-	if secret, err := a.kubeClient.CoreV1().Secrets(os.Getenv("K8S_NAMESPACE")).Get(context.Background(), secretName, v1.GetOptions{}); err != nil {
-		return accessToken, err
-	} else {
-		logger.WithField("func", "getAccessToken").Infof("found access-token with length %d in secret %s", len(secret.Data["access-token"]), secret.Name)
-		return string(secret.Data["access-token"]), nil
-	}
-}
-
-func (a *GitPromotionTriggeredEventHandler) getNextStage(project string, stage string) (nextStage string, err error) {
-	// stages, err := a.api.Stages().GetAllStages(ctx, project)
-	// if err != nil {
-	// 	logger.WithField("func", "getNextStage").WithError(err).Errorf("could not get all stages for project %s with stage %s", project, stage)
-	// 	return nextStage, err
-	// }
-	// for i, s := range stages {
-	// 	if s.StageName == stage {
-	// 		if len(stages) <= (i + 1) {
-	// 			err = errors.New(fmt.Sprintf("no stage defined after stage %s", stage))
-	// 			logger.WithField("func", "getNextStage").WithError(err).Errorf("no next stage found for project %s with stage %s", project, stage)
-	// 			return nextStage, err
-	// 		}
-	// 		logger.WithField("func", "getNextStage").Infof("next stage %s found for project %s and stage %s", stages[i+1].StageName, project, stage)
-	// 		return stages[i+1].StageName, nil
-	// 	}
-	// }
-	// err = errors.New(fmt.Sprintf("stage %s not found", stage))
-	// logger.WithField("func", "getNextStage").WithError(err).Errorf("stage %s not found for project %s", stage, project)
-	// return nextStage, err
-	return "production", err
-}
-
-func (a *GitPromotionTriggeredEventHandler) getMergedConfiguration(project string, stage, nextstage string, service string) (config model.PromotionConfig) {
-	data := &keptnv2.EventData{}
-	if err := keptnv2.Decode(event.Data, data); err != nil {
-		keptnHandle.Logger().Errorf("Could not parse event: %s", err.Error())
-		return false
-	}
-
-	jcr := &config.JobConfigReader{
-		Keptn: keptn_interface.NewV1ResourceHandler(*data, keptnHandle.APIV2().Resources()),
-	}
-
-	// Check if the job configuration can be found
-	configuration, _, err := jcr.GetJobConfig(event.GitCommitID)
-
-	config = readAndMergeResource(config, func() (resource *models.Resource, err error) {
-		return a.api.ResourcesV1().GetProjectResource(project, configurationResource)
-	})
-	config = readAndMergeResource(config, func() (resource *models.Resource, err error) {
-		return a.api.ResourcesV1().GetStageResource(project, stage, configurationResource)
-	})
-	config = readAndMergeResource(config, func() (resource *models.Resource, err error) {
-		return a.api.ResourcesV1().GetServiceResource(project, stage, service, configurationResource)
-	})
+// getCredentials returns the credentials of the target secret. The access token is the value of the key
+// spec.target.secretKey (default access-token). For SSH URLs the keys ssh-privatekey and known_hosts are needed and the
+// access token is optional unless spec.target.secretKey is set. A missing secret or key and a namespace not allowed
+// are returned as finding and error
+func (a *GitPromotionTriggeredEventHandler) getCredentials(target model.Target) (credentials RepositoryCredentials, finding *model.Finding, err error) {
+	secretName, key, namespace := *target.Secret, defaultSecretKey, ""
+	keySet := target.SecretKey != nil && *target.SecretKey != ""
+	if keySet {
+		key = *target.SecretKey
+	}
+	if target.SecretNamespace != nil {
+		namespace = *target.SecretNamespace
+	}
+	if namespace != "" && !contains(a.SecretNamespaces, namespace) {
+		f := model.NewError(model.FindingNotAllowed, "spec.target.secretNamespace", "namespace %s is not allowed, allowed namespaces: %s", namespace, strings.Join(a.SecretNamespaces, ", "))
+		return credentials, &f, errors.New(f.String())
+	}
+	if locator, err := repoaccess.ParseLocator(toString(target.Repo)); err == nil && locator.IsSSH() {
+		if credentials.PrivateKey, finding, err = a.secretValue(namespace, secretName, sshPrivateKeyKey, "spec.target.secret"); err != nil {
+			return credentials, finding, err
+		}
+		if credentials.KnownHosts, finding, err = a.secretValue(namespace, secretName, knownHostsKey, "spec.target.secret"); err != nil {
+			return credentials, finding, err
+		}
+	}
+	token, finding, err := a.secretValue(namespace, secretName, key, "spec.target.secretKey")
+	if len(credentials.PrivateKey) > 0 && !keySet && errors.Is(err, secrets.ErrKeyNotFound) {
+		logger.WithField("func", "getCredentials").Infof("no %s in secret %s, pull requests are not created", key, secretName)
+		return credentials, nil, nil
+	} else if err != nil {
+		return credentials, finding, err
+	}
+	logger.WithField("func", "getCredentials").Infof("found %s with length %d in secret %s", key, len(token), secretName)
+	credentials.AccessToken = string(token)
+	return credentials, nil, nil
+}
 
-	placeholders := map[string]string{
-		"project":   project,
-		"stage":     stage,
-		"nextstage": nextstage,
-		"service":   service,
+// secretValue returns the value of the key of the secret. A missing secret or key is returned as finding with the
+// path keyPath
+func (a *GitPromotionTriggeredEventHandler) secretValue(namespace, secretName, key, keyPath string) ([]byte, *model.Finding, error) {
+	value, err := secrets.Value(a.Secrets, namespace, secretName, key)
+	if errors.Is(err, secrets.ErrNotFound) {
+		f := model.NewError(model.FindingSecretNotFound, "spec.target.secret", "secret %s not found", secretName)
+		return nil, &f, err
+	} else if errors.Is(err, secrets.ErrKeyNotFound) {
+		f := model.NewError(model.FindingSecretKeyNotFound, keyPath, "%v", err)
+		return nil, &f, err
 	}
+	return value, nil, err
+}
 
-	config.Spec.Target.Repo = replacePlaceHolders(placeholders, config.Spec.Target.Repo)
-	config.Spec.Target.Secret = replacePlaceHolders(placeholders, config.Spec.Target.Secret)
-	for i, p := range config.Spec.Paths {
-		p.Target = replacePlaceHolders(placeholders, p.Target)
-		p.Source = replacePlaceHolders(placeholders, p.Source)
-		config.Spec.Paths[i] = p
+// AllowedSecretNamespaces returns the namespaces of SecretNamespaceAllowListVariable
+func AllowedSecretNamespaces() []string {
+	var namespaces []string
+	for _, namespace := range strings.Split(os.Getenv(SecretNamespaceAllowListVariable), ",") {
+		if namespace = strings.TrimSpace(namespace); namespace != "" {
+			namespaces = append(namespaces, namespace)
+		}
 	}
-	return config
+	return namespaces
 }
 
-func replacePlaceHolders(placeholders map[string]string, p *string) (result *string) {
-	if p == nil {
-		return nil
+// getRegistryClient returns a client using the credentials of the registry secret. If the secret does not exist a
+// warning is reported and the registries are accessed anonymously
+func (a *GitPromotionTriggeredEventHandler) getRegistryClient(config model.Registry, reportFinding func(finding model.Finding)) (*registry.Client, error) {
+	var credentials registry.Credentials
+	if config.Secret != nil && *config.Secret != "" {
+		data, err := a.Secrets.Get("", *config.Secret)
+		if errors.Is(err, secrets.ErrNotFound) {
+			reportFinding(model.NewWarning(model.FindingSecretNotFound, "spec.registry.secret", "secret %s not found => accessing registries anonymously", *config.Secret))
+		} else if err != nil {
+			return nil, err
+		} else if credentials, err = registry.CredentialsFromSecret(data); err != nil {
+			return nil, fmt.Errorf("invalid registry secret %s: %w", *config.Secret, err)
+		}
+	}
+	client := registry.NewClient(&http.Client{Timeout: registryTimeout}, credentials)
+	client.Insecure = config.Insecure != nil && *config.Insecure
+	return client, nil
+}
+
+// imageVerifier returns the verifier checking that the image references added to the changed files exist in the
+// registry. The images of the current files are not checked again
+func imageVerifier(registryClient *registry.Client) promoter.Verifier {
+	return func(files []promoter.FileChange) error {
+		var images []string
+		for _, f := range files {
+			if f.New == nil {
+				continue
+			}
+			current := make(map[string]bool)
+			if f.Current != nil {
+				for _, image := range replacer.ImageReferences(f.Path, *f.Current) {
+					current[image] = true
+				}
+			}
+			for _, image := range replacer.ImageReferences(f.Path, *f.New) {
+				if !current[image] {
+					images = append(images, image)
+				}
+			}
+		}
+		if len(images) == 0 {
+			return nil
+		}
+		logger.WithField("func", "imageVerifier").Infof("verifying %d image references", len(images))
+		return registryClient.VerifyImages(images)
 	}
-	current := *p
-	for k, v := range placeholders {
-		current = strings.Replace(current, fmt.Sprintf("${%s}", k), v, -1)
+}
+
+func toRegistryDigests(digests []model.Digest) []registry.Digest {
+	res := make([]registry.Digest, 0, len(digests))
+	for _, d := range digests {
+		res = append(res, registry.Digest{Key: toString(d.Key), Replace: d.Replace != nil && *d.Replace})
 	}
-	return &current
+	return res
 }
 
-func readAndMergeResource(target model.PromotionConfig, getResourceFunc func() (resource *models.Resource, err error)) (ret model.PromotionConfig) {
-	ret = target
-	resource, err := getResourceFunc()
-	if err == api.ResourceNotFoundError {
-		return ret
+// NextStages returns the stages to promote to. spec.nextStages is used before the entry of spec.nextStageMap and the
+// shipyard of the project read with getShipyardFunc. In the shipyard the stages with sequences triggered by the
+// sequences of stage running the git-promotion task (e.g. staging.delivery.finished) are used. Without these
+// triggers the stage following stage is used. errLastStage is returned if there is no stage to promote to
+func NextStages(spec model.PromotionConfigSpec, stage string, getShipyardFunc func() (resource *models.Resource, err error)) (nextStages []string, err error) {
+	if len(spec.NextStages) > 0 {
+		return spec.NextStages, nil
 	}
-	var newConfig model.PromotionConfig
-	if err := yaml.Unmarshal([]byte(resource.ResourceContent), &newConfig); err != nil {
-		logger.WithField("func", "readAndMergeResource").
-			WithError(err).
-			Errorf("could not unmarshall resource file %s => ignoring", *resource.ResourceURI)
-	} else {
-		if newConfig.Spec.Strategy != nil {
-			ret.Spec.Strategy = newConfig.Spec.Strategy
+	if nextStage, ok := spec.NextStageMap[stage]; ok && nextStage != "" {
+		return []string{nextStage}, nil
+	}
+	resource, err := getShipyardFunc()
+	if err != nil {
+		return nil, fmt.Errorf("could not read %s: %w", shipyardResource, err)
+	}
+	shipyard, err := keptnv2.DecodeShipyardYAML([]byte(resource.ResourceContent))
+	if err != nil {
+		return nil, fmt.Errorf("could not parse %s: %w", shipyardResource, err)
+	}
+	for i, s := range shipyard.Spec.Stages {
+		if s.Name != stage {
+			continue
 		}
-		if newConfig.Spec.Target.Repo != nil {
-			ret.Spec.Target.Repo = newConfig.Spec.Target.Repo
+		if nextStages = triggeredStages(shipyard, s); len(nextStages) > 0 {
+			return nextStages, nil
 		}
-		if newConfig.Spec.Target.Secret != nil {
-			ret.Spec.Target.Secret = newConfig.Spec.Target.Secret
+		if len(shipyard.Spec.Stages) <= i+1 {
+			return nil, errLastStage
 		}
-		if newConfig.Spec.Target.Provider != nil {
-			ret.Spec.Target.Provider = newConfig.Spec.Target.Provider
+		return []string{shipyard.Spec.Stages[i+1].Name}, nil
+	}
+	return nil, fmt.Errorf("stage %s not found in %s", stage, shipyardResource)
+}
+
+// triggeredStages returns the stages with sequences triggered by the sequences of stage containing the git-promotion
+// task. If no sequence contains the task, all sequences of the stage are used
+func triggeredStages(shipyard *keptnv2.Shipyard, stage keptnv2.Stage) (stages []string) {
+	triggers := make(map[string]bool)
+	for _, sequence := range stage.Sequences {
+		for _, task := range sequence.Tasks {
+			if task.Name == GitPromotionTaskName {
+				triggers[fmt.Sprintf("%s.%s.finished", stage.Name, sequence.Name)] = true
+			}
+		}
+	}
+	if len(triggers) == 0 {
+		for _, sequence := range stage.Sequences {
+			triggers[fmt.Sprintf("%s.%s.finished", stage.Name, sequence.Name)] = true
 		}
-		ret.Spec.Paths = append(target.Spec.Paths, newConfig.Spec.Paths...)
 	}
-	return ret
+	for _, s := range shipyard.Spec.Stages {
+	sequences:
+		for _, sequence := range s.Sequences {
+			for _, trigger := range sequence.TriggeredOn {
+				if triggers[trigger.Event] {
+					stages = append(stages, s.Name)
+					break sequences
+				}
+			}
+		}
+	}
+	return stages
+}
+
+// getMergedConfiguration reads the configuration of the project, stage and service pinned to gitCommitID and merges
+// them in this order. The hash of the read configuration is returned
+func (a *GitPromotionTriggeredEventHandler) getMergedConfiguration(inputEvent GitPromotionTriggeredEventData, gitCommitID string) (config model.PromotionConfig, hash string, findings []model.Finding, err error) {
+	reader := promotionconfig.GitPromotionConfigReader{Keptn: keptn.V1ResourceHandler{
+		Event: keptn.EventProperties{
+			Project:     inputEvent.GetProject(),
+			Stage:       inputEvent.GetStage(),
+			Service:     inputEvent.GetService(),
+			GitCommitID: gitCommitID,
+		},
+		ResourceAPI: a.Resources,
+	}}
+	effective, err := reader.GetEffectiveConfig(gitCommitID)
+	if err != nil {
+		return config, "", nil, err
+	}
+	for _, p := range effective.ProvenancePaths() {
+		logger.WithField("func", "getMergedConfiguration").Debugf("%s set by %s configuration", p, effective.Provenance[p])
+	}
+	return effective.Config, effective.Hash, effective.Findings, nil
+}
+
+func stringOrDefault(str *string, def string) string {
+	if str == nil || *str == "" {
+		return def
+	}
+	return *str
 }
 
 func toString(str *string) string {
@@ -296,3 +838,12 @@ func toString(str *string) string {
 	}
 	return *str
 }
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -1,10 +1,18 @@
 package handler
 
 import (
+	"errors"
 	"github.com/google/go-github/github"
 	"github.com/keptn/go-utils/pkg/api/models"
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
 	"keptn/git-promotion-service/pkg/model"
+	"keptn/git-promotion-service/pkg/promoter"
+	"keptn/git-promotion-service/pkg/registry"
+	"keptn/git-promotion-service/pkg/secrets"
+	"net/http"
+	"net/http/httptest"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -44,91 +52,422 @@ Stage: *dev*`,
 	}
 }
 
-func Test_readAndMergeResource(t *testing.T) {
-	type args struct {
-		target          model.PromotionConfig
-		getResourceFunc func() (resource *models.Resource, err error)
+func Test_NextStages(t *testing.T) {
+	shipyard := func() (resource *models.Resource, err error) {
+		return &models.Resource{ResourceContent: `apiVersion: spec.keptn.sh/0.2.2
+kind: Shipyard
+metadata:
+  name: shipyard
+spec:
+  stages:
+    - name: dev
+      sequences:
+        - name: delivery
+    - name: staging
+      sequences:
+        - name: delivery
+          triggeredOn:
+            - event: dev.delivery.finished
+    - name: production
+      sequences:
+        - name: delivery
+          triggeredOn:
+            - event: staging.delivery.finished
+`}, nil
+	}
+	fanOutShipyard := func() (resource *models.Resource, err error) {
+		return &models.Resource{ResourceContent: `apiVersion: spec.keptn.sh/0.2.2
+kind: Shipyard
+metadata:
+  name: shipyard
+spec:
+  stages:
+    - name: staging
+      sequences:
+        - name: delivery
+          tasks:
+            - name: deployment
+            - name: git-promotion
+        - name: rollback
+          tasks:
+            - name: rollback
+    - name: prod-eu
+      sequences:
+        - name: delivery
+          triggeredOn:
+            - event: staging.delivery.finished
+        - name: rollback
+          triggeredOn:
+            - event: staging.rollback.finished
+    - name: prod-us
+      sequences:
+        - name: delivery
+          triggeredOn:
+            - event: staging.delivery.finished
+    - name: prod-asia
+      sequences:
+        - name: delivery
+          triggeredOn:
+            - event: staging.rollback.finished
+`}, nil
 	}
 	tests := []struct {
-		name    string
-		args    args
-		wantRet model.PromotionConfig
+		name           string
+		spec           model.PromotionConfigSpec
+		stage          string
+		getShipyard    func() (resource *models.Resource, err error)
+		wantNextStages []string
+		wantErr        error
+		wantAnyErr     bool
 	}{
 		{
-			name: "first test",
-			args: args{
-				target: model.PromotionConfig{},
-				getResourceFunc: func() (resource *models.Resource, err error) {
-					return &models.Resource{
-						ResourceContent: `
-spec:
-  strategy: "mystrategy"
-  target:
-    repo: "myrepo"
-    secret: "mysecret"
-    provider: "github"
-  paths:
-    - target: /hallo
-      source: /test
-`,
-						ResourceURI: github.String("myresourceuri"),
-					}, nil
-				},
+			name:           "first stage",
+			stage:          "dev",
+			getShipyard:    shipyard,
+			wantNextStages: []string{"staging"},
+		},
+		{
+			name:           "middle stage",
+			stage:          "staging",
+			getShipyard:    shipyard,
+			wantNextStages: []string{"production"},
+		},
+		{
+			name:        "last stage",
+			stage:       "production",
+			getShipyard: shipyard,
+			wantErr:     errLastStage,
+		},
+		{
+			name:        "unknown stage",
+			stage:       "hardening",
+			getShipyard: shipyard,
+			wantAnyErr:  true,
+		},
+		{
+			name:           "explicit next stage",
+			spec:           model.PromotionConfigSpec{NextStages: []string{"prod-eu"}},
+			stage:          "production",
+			getShipyard:    shipyard,
+			wantNextStages: []string{"prod-eu"},
+		},
+		{
+			name:           "next stage map",
+			spec:           model.PromotionConfigSpec{NextStageMap: map[string]string{"dev": "production"}},
+			stage:          "dev",
+			getShipyard:    shipyard,
+			wantNextStages: []string{"production"},
+		},
+		{
+			name:           "next stage map without entry",
+			spec:           model.PromotionConfigSpec{NextStageMap: map[string]string{"dev": "production"}},
+			stage:          "staging",
+			getShipyard:    shipyard,
+			wantNextStages: []string{"production"},
+		},
+		{
+			name:           "fan-out from shipyard triggers",
+			stage:          "staging",
+			getShipyard:    fanOutShipyard,
+			wantNextStages: []string{"prod-eu", "prod-us"},
+		},
+		{
+			name:           "explicit next stages",
+			spec:           model.PromotionConfigSpec{NextStages: []string{"prod-eu", "prod-us"}, NextStageMap: map[string]string{"staging": "production"}},
+			stage:          "staging",
+			getShipyard:    shipyard,
+			wantNextStages: []string{"prod-eu", "prod-us"},
+		},
+		{
+			name:  "shipyard not readable",
+			stage: "dev",
+			getShipyard: func() (resource *models.Resource, err error) {
+				return nil, errors.New("not found")
+			},
+			wantAnyErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotNextStages, err := NextStages(tt.spec, tt.stage, tt.getShipyard)
+			if (err != nil) != (tt.wantErr != nil || tt.wantAnyErr) || (tt.wantErr != nil && !errors.Is(err, tt.wantErr)) {
+				t.Errorf("NextStages() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(gotNextStages, tt.wantNextStages) {
+				t.Errorf("NextStages() = %v, want %v", gotNextStages, tt.wantNextStages)
+			}
+		})
+	}
+}
+
+func Test_aggregateResults(t *testing.T) {
+	tests := []struct {
+		name         string
+		results      []stageResult
+		wantStatus   keptnv2.StatusType
+		wantResult   keptnv2.ResultType
+		wantMessage  string
+		wantPRLinks  map[string]string
+		wantFindings []StageFinding
+	}{
+		{
+			name: "single stage",
+			results: []stageResult{
+				{stage: "production", status: keptnv2.StatusSucceeded, result: keptnv2.ResultPass, message: "opened pull request", prLink: github.String("https://github.com/test/repo/pull/1")},
+			},
+			wantStatus:  keptnv2.StatusSucceeded,
+			wantResult:  keptnv2.ResultPass,
+			wantMessage: "opened pull request",
+			wantPRLinks: map[string]string{"production": "https://github.com/test/repo/pull/1"},
+		},
+		{
+			name: "one of multiple stages failed",
+			results: []stageResult{
+				{stage: "prod-eu", status: keptnv2.StatusSucceeded, result: keptnv2.ResultPass, message: "opened pull request", prLink: github.String("https://github.com/test/repo/pull/1")},
+				{stage: "prod-us", status: keptnv2.StatusErrored, result: keptnv2.ResultFailed, message: "error while opening pull request",
+					findings: []model.Finding{model.NewWarning(model.FindingSourceNotFound, "spec.paths[0].source", "dev does not exist in branch main")}},
 			},
-			wantRet: model.PromotionConfig{
-				Spec: model.PromotionConfigSpec{
-					Target: model.Target{
-						Repo:     github.String("myrepo"),
-						Secret:   github.String("mysecret"),
-						Provider: github.String("github"),
-					},
-					Strategy: github.String("mystrategy"),
-					Paths: []model.Path{
-						{
-							Target: github.String("/hallo"),
-							Source: github.String("/test"),
-						},
-					},
-				},
+			wantStatus:  keptnv2.StatusErrored,
+			wantResult:  keptnv2.ResultFailed,
+			wantMessage: "prod-eu: opened pull request; prod-us: error while opening pull request",
+			wantPRLinks: map[string]string{"prod-eu": "https://github.com/test/repo/pull/1"},
+			wantFindings: []StageFinding{
+				{Stage: "prod-us", Finding: model.NewWarning(model.FindingSourceNotFound, "spec.paths[0].source", "dev does not exist in branch main")},
 			},
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if gotRet := readAndMergeResource(tt.args.target, tt.args.getResourceFunc); !reflect.DeepEqual(gotRet, tt.wantRet) {
-				t.Errorf("readAndMergeResource() = %+v, want %+v", gotRet, tt.wantRet)
+			gotStatus, gotResult, gotMessage, gotPRLinks, gotFindings := aggregateResults(tt.results)
+			if gotStatus != tt.wantStatus || gotResult != tt.wantResult || gotMessage != tt.wantMessage || !reflect.DeepEqual(gotPRLinks, tt.wantPRLinks) {
+				t.Errorf("aggregateResults() = %v, %v, %v, %v", gotStatus, gotResult, gotMessage, gotPRLinks)
+			}
+			if !reflect.DeepEqual(gotFindings, tt.wantFindings) {
+				t.Errorf("aggregateResults() findings = %v, want %v", gotFindings, tt.wantFindings)
 			}
 		})
 	}
 }
 
-func Test_replacePlaceHolders(t *testing.T) {
-	type args struct {
-		placeholders map[string]string
-		p            *string
+func Test_getGitPromotionFinishedEvent(t *testing.T) {
+	a := &GitPromotionTriggeredEventHandler{}
+	event := a.getGitPromotionFinishedEvent(GitPromotionTriggeredEventData{EventData: keptnv2.EventData{Project: "prj", Stage: "dev", Service: "svc"}},
+		keptnv2.StatusErrored, keptnv2.ResultFailed, "validation error", "triggered", "context", nil,
+		&GitPromotionFinishedData{Findings: []StageFinding{{Stage: "staging", Finding: model.NewError(model.FindingMissing, "spec.target.secret", "is missing")}}})
+	var data map[string]interface{}
+	if err := event.DataAs(&data); err != nil {
+		t.Fatalf("DataAs() error = %v", err)
+	}
+	want := []interface{}{map[string]interface{}{"stage": "staging", "code": "missing", "path": "spec.target.secret", "severity": "error", "message": "is missing"}}
+	if got := data["gitPromotion"].(map[string]interface{})["findings"]; !reflect.DeepEqual(got, want) {
+		t.Errorf("getGitPromotionFinishedEvent() findings = %v, want %v", got, want)
+	}
+	if data["message"] != "validation error" {
+		t.Errorf("getGitPromotionFinishedEvent() message = %v", data["message"])
 	}
+}
+
+func Test_isDryRun(t *testing.T) {
 	tests := []struct {
-		name       string
-		args       args
-		wantResult *string
+		name        string
+		spec        model.PromotionConfigSpec
+		labels      map[string]string
+		want        bool
+		wantFinding bool
+	}{
+		{name: "default", labels: map[string]string{"other": "true"}, want: false},
+		{name: "spec", spec: model.PromotionConfigSpec{DryRun: github.Bool(true)}, want: true},
+		{name: "spec disabled", spec: model.PromotionConfigSpec{DryRun: github.Bool(false)}, want: false},
+		{name: "label", labels: map[string]string{"dryrun": "true"}, want: true},
+		{name: "label 1", labels: map[string]string{"dryrun": "1"}, want: true},
+		{name: "label without value", labels: map[string]string{"dryrun": ""}, want: true},
+		{name: "label false", labels: map[string]string{"dryrun": "false"}, want: false},
+		{name: "label invalid", labels: map[string]string{"dryrun": "no"}, wantFinding: true},
+		{name: "label invalid with spec", spec: model.PromotionConfigSpec{DryRun: github.Bool(true)}, labels: map[string]string{"dryrun": "yes"}, wantFinding: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, finding := isDryRun(tt.spec, tt.labels)
+			if got != tt.want {
+				t.Errorf("isDryRun() = %v, want %v", got, tt.want)
+			}
+			if (finding != nil) != tt.wantFinding {
+				t.Errorf("isDryRun() finding = %v, wantFinding %v", finding, tt.wantFinding)
+			} else if finding != nil && (finding.Severity != model.SeverityError || finding.Path != "labels.dryrun") {
+				t.Errorf("isDryRun() finding = %v", finding)
+			}
+		})
+	}
+}
+
+func Test_checkBranchNames(t *testing.T) {
+	inputEvent := GitPromotionTriggeredEventData{EventData: keptnv2.EventData{Project: "prj", Stage: "staging", Service: "svc"}}
+	tests := []struct {
+		name         string
+		strategy     string
+		branch       *string
+		nextStages   []string
+		wantFindings int
+	}{
+		{name: "default branch", strategy: model.StrategyFlatPR, nextStages: []string{"prod-eu", "prod-us"}},
+		{name: "branch per stage", strategy: model.StrategyFlatPR, branch: github.String("promote/${service}-${nextstage}"), nextStages: []string{"prod-eu", "prod-us"}},
+		{name: "single stage", strategy: model.StrategyFlatPR, branch: github.String("promote/${service}"), nextStages: []string{"prod"}},
+		{name: "same branch", strategy: model.StrategyFlatPR, branch: github.String("promote/${service}"), nextStages: []string{"prod-eu", "prod-us", "prod-asia"}, wantFindings: 2},
+		{name: "branch strategy", strategy: model.StrategyBranch, branch: github.String("promote/${service}"), nextStages: []string{"prod-eu", "prod-us"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := model.PromotionConfig{Spec: model.PromotionConfigSpec{Strategy: &tt.strategy, PullRequest: model.PullRequest{Branch: tt.branch}}}
+			findings := checkBranchNames(inputEvent, config, map[string]string{}, tt.nextStages)
+			if len(findings) != tt.wantFindings {
+				t.Fatalf("checkBranchNames() = %v, want %d findings", findings, tt.wantFindings)
+			}
+			for _, f := range findings {
+				if f.Severity != model.SeverityError || f.Code != model.FindingConflict || f.Path != "spec.pullRequest.branch" {
+					t.Errorf("checkBranchNames() finding = %v", f)
+				}
+			}
+		})
+	}
+}
+
+func Test_dryRunChanges(t *testing.T) {
+	results := []stageResult{
+		{stage: "prod-eu", changes: &promoter.DryRunResult{Files: []string{"prod-eu/values.yaml"}, Diff: strings.Repeat("+", maxDryRunDiffSize+1)}},
+		{stage: "prod-us", changes: &promoter.DryRunResult{}},
+		{stage: "prod-asia", message: "validation error"},
+	}
+	want := []StageChanges{
+		{Stage: "prod-eu", Files: []string{"prod-eu/values.yaml"}, Diff: strings.Repeat("+", maxDryRunDiffSize), DiffTruncated: true},
+		{Stage: "prod-us", Files: []string{}},
+	}
+	if got := dryRunChanges(results); !reflect.DeepEqual(got, want) {
+		t.Errorf("dryRunChanges() = %v, want %v", got, want)
+	}
+}
+
+func Test_truncateDiff(t *testing.T) {
+	tests := []struct {
+		name string
+		diff string
+		size int
+		want string
+	}{
+		{name: "short", diff: "+a\n", size: 10, want: "+a\n"},
+		{name: "line boundary", diff: "+a\n+bcd\n", size: 6, want: "+a\n"},
+		{name: "exact line", diff: "+a\n+bcd\n", size: 3, want: "+a\n"},
+		{name: "long first line", diff: "+abcdef\n", size: 4, want: "+abc"},
+		{name: "rune boundary", diff: "+äöü\n", size: 4, want: "+ä"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := truncateDiff(tt.diff, tt.size); got != tt.want {
+				t.Errorf("truncateDiff() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_imageVerifier(t *testing.T) {
+	var requested []string
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = append(requested, r.URL.Path)
+		if r.URL.Path != "/v2/test/app/manifests/1.0" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "https://")
+	verify := imageVerifier(registry.NewClient(server.Client(), nil))
+	current := "image: " + host + "/test/old:0.9\n"
+	tests := []struct {
+		name          string
+		files         []promoter.FileChange
+		wantRequested []string
+		wantErr       bool
 	}{
 		{
-			args: args{
-				placeholders: map[string]string{
-					"stage":   "mystage",
-					"service": "myservice",
-					"project": "myproject",
-				},
-				p: github.String("${project}/${service}/${stage} => project: ${project} service: ${service} stage: ${stage}"),
-			},
-			wantResult: github.String("myproject/myservice/mystage => project: myproject service: myservice stage: mystage"),
+			name:          "helm values",
+			files:         []promoter.FileChange{{Path: "prod/values.yaml", Current: &current, New: github.String("image: " + host + "/test/old:0.9\napp:\n  repository: " + host + "/test/app\n  tag: \"1.0\"\n")}},
+			wantRequested: []string{"/v2/test/app/manifests/1.0"},
+		},
+		{
+			name:          "rendered template",
+			files:         []promoter.FileChange{{Path: "prod/deployment.yaml", New: github.String("spec:\n  containers:\n    - image: " + host + "/test/app:2.0\n")}},
+			wantRequested: []string{"/v2/test/app/manifests/2.0"},
+			wantErr:       true,
+		},
+		{
+			name:  "deleted file",
+			files: []promoter.FileChange{{Path: "prod/values.yaml", Current: &current}},
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if gotResult := replacePlaceHolders(tt.args.placeholders, tt.args.p); !reflect.DeepEqual(gotResult, tt.wantResult) {
-				t.Errorf("replacePlaceHolders() = %v, want %v", gotResult, tt.wantResult)
+			requested = nil
+			if err := verify(tt.files); (err != nil) != tt.wantErr {
+				t.Errorf("imageVerifier() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(requested, tt.wantRequested) {
+				t.Errorf("imageVerifier() requested %v, want %v", requested, tt.wantRequested)
 			}
 		})
 	}
 }
+
+func Test_getCredentials(t *testing.T) {
+	a := &GitPromotionTriggeredEventHandler{Dependencies: Dependencies{
+		Secrets: secrets.Static{
+			"github":       {"access-token": []byte("token"), "pat": []byte("pat")},
+			"other/github": {"access-token": []byte("other")},
+			"deploy-key":   {"ssh-privatekey": []byte("key"), "known_hosts": []byte("hosts")},
+		},
+		SecretNamespaces: []string{"other"},
+	}}
+	tests := []struct {
+		name        string
+		target      model.Target
+		want        string
+		wantFinding string
+	}{
+		{name: "default key", target: model.Target{Secret: github.String("github")}, want: "token"},
+		{name: "secret key", target: model.Target{Secret: github.String("github"), SecretKey: github.String("pat")}, want: "pat"},
+		{name: "secret namespace", target: model.Target{Secret: github.String("github"), SecretNamespace: github.String("other")}, want: "other"},
+		{name: "namespace not allowed", target: model.Target{Secret: github.String("github"), SecretNamespace: github.String("kube-system")}, wantFinding: model.FindingNotAllowed},
+		{name: "missing secret", target: model.Target{Secret: github.String("gitlab")}, wantFinding: model.FindingSecretNotFound},
+		{name: "missing key", target: model.Target{Secret: github.String("github"), SecretKey: github.String("token")}, wantFinding: model.FindingSecretKeyNotFound},
+		{name: "ssh without token", target: model.Target{Repo: github.String("git@github.com:test/repo.git"), Secret: github.String("deploy-key")}, want: ""},
+		{name: "ssh with token", target: model.Target{Repo: github.String("git@github.com:test/repo.git"), Secret: github.String("github"), SecretKey: github.String("pat")}, wantFinding: model.FindingSecretKeyNotFound},
+		{name: "ssh with missing token", target: model.Target{Repo: github.String("git@github.com:test/repo.git"), Secret: github.String("deploy-key"), SecretKey: github.String("pat")}, wantFinding: model.FindingSecretKeyNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, finding, err := a.getCredentials(tt.target)
+			if got.AccessToken != tt.want {
+				t.Errorf("getCredentials() = %v, want %v", got.AccessToken, tt.want)
+			}
+			if tt.wantFinding == "" && (err != nil || finding != nil) {
+				t.Errorf("getCredentials() error = %v, finding = %v", err, finding)
+			}
+			if tt.wantFinding != "" && (err == nil || finding == nil || finding.Code != tt.wantFinding) {
+				t.Errorf("getCredentials() error = %v, finding = %v, want %v", err, finding, tt.wantFinding)
+			}
+		})
+	}
+}
+
+func Test_getCredentials_envSource(t *testing.T) {
+	t.Setenv("GIT_PROMOTION_TEST_SECRET_DEPLOY_KEY__ssh-privatekey", "key")
+	t.Setenv("GIT_PROMOTION_TEST_SECRET_DEPLOY_KEY__known_hosts", "hosts")
+	t.Setenv("GIT_PROMOTION_TEST_SECRET_DEPLOY_KEY__access-token", "token")
+	a := &GitPromotionTriggeredEventHandler{Dependencies: Dependencies{Secrets: secrets.NewEnv("GIT_PROMOTION_TEST_SECRET_")}}
+	got, finding, err := a.getCredentials(model.Target{Repo: github.String("git@github.com:test/repo.git"), Secret: github.String("deploy-key")})
+	if err != nil || finding != nil {
+		t.Fatalf("getCredentials() error = %v, finding = %v", err, finding)
+	}
+	want := RepositoryCredentials{AccessToken: "token", PrivateKey: []byte("key"), KnownHosts: []byte("hosts")}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("getCredentials() = %v, want %v", got, want)
+	}
+}
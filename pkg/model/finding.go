@@ -0,0 +1,57 @@
+package model
+
+import "fmt"
+
+const (
+	SeverityError   string = "error"
+	SeverityWarning        = "warning"
+)
+
+// Codes of the findings
+const (
+	FindingMissing            string = "missing"
+	FindingInvalid                   = "invalid"
+	FindingUnsupported               = "unsupported"
+	FindingConflict                  = "conflict"
+	FindingUnknownPlaceholder        = "unknown-placeholder"
+	FindingSecretNotFound            = "secret-not-found"
+	FindingSecretKeyNotFound         = "secret-key-not-found"
+	FindingNotAllowed                = "not-allowed"
+	FindingSourceNotFound            = "source-not-found"
+	FindingUnknownField              = "unknown-field"
+	FindingUnmatchedSelector         = "unmatched-selector"
+	FindingLabelsNotAdded            = "labels-not-added"
+)
+
+// Finding is a result of the validation of the configuration or of the checks during the promotion
+type Finding struct {
+	Code     string `json:"code"`
+	Path     string `json:"path,omitempty"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+}
+
+func NewError(code, path, format string, args ...interface{}) Finding {
+	return Finding{Code: code, Path: path, Severity: SeverityError, Message: fmt.Sprintf(format, args...)}
+}
+
+func NewWarning(code, path, format string, args ...interface{}) Finding {
+	return Finding{Code: code, Path: path, Severity: SeverityWarning, Message: fmt.Sprintf(format, args...)}
+}
+
+func (f Finding) String() string {
+	if f.Path == "" {
+		return f.Message
+	}
+	return fmt.Sprintf(`"%s" %s`, f.Path, f.Message)
+}
+
+// Errors returns the findings with severity error
+func Errors(findings []Finding) (errors []Finding) {
+	for _, f := range findings {
+		if f.Severity == SeverityError {
+			errors = append(errors, f)
+		}
+	}
+	return errors
+}
@@ -1,17 +1,48 @@
 package model
 
 type PromotionConfigValidator interface {
-	Validate(config PromotionConfig) (validationErrors []string)
+	Validate(config PromotionConfig) (findings []Finding)
 }
 
+const (
+	APIVersionV1           string = "keptn.sh/v1"
+	APIVersionV2                  = "keptn.sh/v2"
+	KindGitPromotionConfig        = "GitPromotionConfig"
+)
+
 const (
 	StrategyBranch string = "branch"
 	StrategyFlatPR        = "flat-pr"
 )
 
+const (
+	PathModeReplace   string = "replace"
+	PathModeTemplate         = "template"
+	PathModeKustomize        = "kustomize"
+)
+
+const (
+	BumpPatch string = "patch"
+	BumpMinor        = "minor"
+	BumpMajor        = "major"
+)
+
+const (
+	ViolationFail string = "fail"
+	ViolationWarn        = "warn"
+)
+
+const (
+	MergeAppend  string = "append"
+	MergeReplace        = "replace"
+	PatchDelete         = "delete"
+)
+
+// PromotionConfig is the keptn.sh/v2 version of the configuration. All other versions are converted to it
 type PromotionConfig struct {
-	APIVersion *string             `yaml:"apiVersion"`
-	Kind       *string             `yaml:"kind"`
+	APIVersion *string             `yaml:"apiVersion" jsonschema:"enum=keptn.sh/v2"`
+	Kind       *string             `yaml:"kind" jsonschema:"enum=GitPromotionConfig"`
+	Metadata   Metadata            `yaml:"metadata"`
 	Spec       PromotionConfigSpec `yaml:"spec"`
 }
 
@@ -20,18 +51,92 @@ type Metadata struct {
 }
 
 type PromotionConfigSpec struct {
-	Strategy *string `yaml:"strategy"`
-	Target   Target  `yaml:"target"`
-	Paths    []Path  `yaml:"paths"`
+	Strategy     *string           `yaml:"strategy" jsonschema:"enum=branch|flat-pr"`
+	NextStages   []string          `yaml:"nextStages"`
+	NextStageMap map[string]string `yaml:"nextStageMap"`
+	Target       Target            `yaml:"target"`
+	Paths        []Path            `yaml:"paths"`
+	Replacement  Replacement       `yaml:"replacement"`
+	Registry     Registry          `yaml:"registry"`
+	Enrichment   Enrichment        `yaml:"enrichment"`
+	PullRequest  PullRequest       `yaml:"pullRequest"`
+	Merge        map[string]string `yaml:"merge" jsonschema:"enum=append|replace"`
+	DryRun       *bool             `yaml:"dryRun"`
+}
+
+type PullRequest struct {
+	Branch        *string  `yaml:"branch"`
+	Title         *string  `yaml:"title"`
+	Body          *string  `yaml:"body"`
+	Labels        []string `yaml:"labels"`
+	CommitMessage *string  `yaml:"commitMessage"`
+}
+
+type Enrichment struct {
+	Events []string `yaml:"events"`
+}
+
+type Registry struct {
+	Secret       *string `yaml:"secret"`
+	Insecure     *bool   `yaml:"insecure"`
+	VerifyImages *bool   `yaml:"verifyImages"`
 }
 
 type Target struct {
-	Repo     *string `yaml:"repo"`
-	Secret   *string `yaml:"secret"`
-	Provider *string `yaml:"provider"`
+	Repo            *string `yaml:"repo"`
+	Secret          *string `yaml:"secret"`
+	SecretKey       *string `yaml:"secretKey"`
+	SecretNamespace *string `yaml:"secretNamespace"`
+	Provider        *string `yaml:"provider" jsonschema:"enum=github"`
+}
+
+type Replacement struct {
+	Strict      *bool             `yaml:"strict"`
+	Rules       []ReplacementRule `yaml:"rules"`
+	Constraints []Constraint      `yaml:"constraints"`
+	OnViolation *string           `yaml:"onViolation" jsonschema:"enum=fail|warn"`
+	Digests     []Digest          `yaml:"digests"`
+}
+
+type Digest struct {
+	Key     *string `yaml:"key"`
+	Replace *bool   `yaml:"replace"`
+}
+
+type Constraint struct {
+	Key    *string `yaml:"key"`
+	Policy *string `yaml:"policy"`
+}
+
+type ReplacementRule struct {
+	Path        *string  `yaml:"path"`
+	ReplaceWith *string  `yaml:"replaceWith"`
+	Selector    Selector `yaml:"selector"`
+}
+
+type Selector struct {
+	Kind *string `yaml:"kind"`
+	Name *string `yaml:"name"`
 }
 
 type Path struct {
-	Source *string `yaml:"source"`
-	Target *string `yaml:"target"`
+	ID     *string          `yaml:"id"`
+	Patch  *string          `yaml:"$patch" jsonschema:"enum=delete"`
+	Source *string          `yaml:"source"`
+	Target *string          `yaml:"target"`
+	Mode   *string          `yaml:"mode" jsonschema:"enum=replace|template|kustomize"`
+	Images []KustomizeImage `yaml:"images"`
+	Chart  *Chart           `yaml:"chart"`
+}
+
+type Chart struct {
+	Bump       *string `yaml:"bump" jsonschema:"enum=patch|minor|major"`
+	AppVersion *string `yaml:"appVersion"`
+}
+
+type KustomizeImage struct {
+	Name    *string `yaml:"name"`
+	NewName *string `yaml:"newName"`
+	NewTag  *string `yaml:"newTag"`
+	Digest  *string `yaml:"digest"`
 }
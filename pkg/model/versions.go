@@ -0,0 +1,202 @@
+package model
+
+// PromotionConfigV1 is the keptn.sh/v1 version of the configuration. The types of keptn.sh/v1 are frozen, new fields
+// are only added to keptn.sh/v2. It contains spec.nextStage which is replaced by spec.nextStages in keptn.sh/v2
+type PromotionConfigV1 struct {
+	APIVersion *string               `yaml:"apiVersion" jsonschema:"enum=keptn.sh/v1"`
+	Kind       *string               `yaml:"kind" jsonschema:"enum=GitPromotionConfig"`
+	Metadata   MetadataV1            `yaml:"metadata"`
+	Spec       PromotionConfigSpecV1 `yaml:"spec"`
+}
+
+type MetadataV1 struct {
+	Name string `yaml:"name"`
+}
+
+type PromotionConfigSpecV1 struct {
+	Strategy     *string           `yaml:"strategy" jsonschema:"enum=branch|flat-pr"`
+	NextStage    *string           `yaml:"nextStage"`
+	NextStageMap map[string]string `yaml:"nextStageMap"`
+	Target       TargetV1          `yaml:"target"`
+	Paths        []PathV1          `yaml:"paths"`
+	Replacement  ReplacementV1     `yaml:"replacement"`
+	Registry     RegistryV1        `yaml:"registry"`
+	Enrichment   EnrichmentV1      `yaml:"enrichment"`
+	PullRequest  PullRequestV1     `yaml:"pullRequest"`
+	Merge        map[string]string `yaml:"merge" jsonschema:"enum=append|replace"`
+}
+
+type PullRequestV1 struct {
+	Branch        *string  `yaml:"branch"`
+	Title         *string  `yaml:"title"`
+	Body          *string  `yaml:"body"`
+	Labels        []string `yaml:"labels"`
+	CommitMessage *string  `yaml:"commitMessage"`
+}
+
+type EnrichmentV1 struct {
+	Events []string `yaml:"events"`
+}
+
+type RegistryV1 struct {
+	Secret       *string `yaml:"secret"`
+	Insecure     *bool   `yaml:"insecure"`
+	VerifyImages *bool   `yaml:"verifyImages"`
+}
+
+type TargetV1 struct {
+	Repo     *string `yaml:"repo"`
+	Secret   *string `yaml:"secret"`
+	Provider *string `yaml:"provider" jsonschema:"enum=github"`
+}
+
+type ReplacementV1 struct {
+	Strict      *bool               `yaml:"strict"`
+	Rules       []ReplacementRuleV1 `yaml:"rules"`
+	Constraints []ConstraintV1      `yaml:"constraints"`
+	OnViolation *string             `yaml:"onViolation" jsonschema:"enum=fail|warn"`
+	Digests     []DigestV1          `yaml:"digests"`
+}
+
+type DigestV1 struct {
+	Key     *string `yaml:"key"`
+	Replace *bool   `yaml:"replace"`
+}
+
+type ConstraintV1 struct {
+	Key    *string `yaml:"key"`
+	Policy *string `yaml:"policy"`
+}
+
+type ReplacementRuleV1 struct {
+	Path        *string    `yaml:"path"`
+	ReplaceWith *string    `yaml:"replaceWith"`
+	Selector    SelectorV1 `yaml:"selector"`
+}
+
+type SelectorV1 struct {
+	Kind *string `yaml:"kind"`
+	Name *string `yaml:"name"`
+}
+
+type PathV1 struct {
+	ID     *string            `yaml:"id"`
+	Patch  *string            `yaml:"$patch" jsonschema:"enum=delete"`
+	Source *string            `yaml:"source"`
+	Target *string            `yaml:"target"`
+	Mode   *string            `yaml:"mode" jsonschema:"enum=replace|template|kustomize"`
+	Images []KustomizeImageV1 `yaml:"images"`
+	Chart  *ChartV1           `yaml:"chart"`
+}
+
+type ChartV1 struct {
+	Bump       *string `yaml:"bump" jsonschema:"enum=patch|minor|major"`
+	AppVersion *string `yaml:"appVersion"`
+}
+
+type KustomizeImageV1 struct {
+	Name    *string `yaml:"name"`
+	NewName *string `yaml:"newName"`
+	NewTag  *string `yaml:"newTag"`
+	Digest  *string `yaml:"digest"`
+}
+
+// ConvertToV2 converts the configuration to keptn.sh/v2. spec.nextStage is converted to spec.nextStages
+func (c PromotionConfigV1) ConvertToV2() PromotionConfig {
+	apiVersion, kind := APIVersionV2, KindGitPromotionConfig
+	s := c.Spec
+	spec := PromotionConfigSpec{
+		Strategy:     s.Strategy,
+		NextStageMap: s.NextStageMap,
+		Target:       Target{Repo: s.Target.Repo, Secret: s.Target.Secret, Provider: s.Target.Provider},
+		Replacement: Replacement{
+			Strict:      s.Replacement.Strict,
+			OnViolation: s.Replacement.OnViolation,
+		},
+		Registry:    Registry(s.Registry),
+		Enrichment:  Enrichment(s.Enrichment),
+		PullRequest: PullRequest(s.PullRequest),
+		Merge:       s.Merge,
+	}
+	if s.NextStage != nil && *s.NextStage != "" {
+		spec.NextStages = []string{*s.NextStage}
+	}
+	for _, p := range s.Paths {
+		path := Path{ID: p.ID, Patch: p.Patch, Source: p.Source, Target: p.Target, Mode: p.Mode}
+		for _, i := range p.Images {
+			path.Images = append(path.Images, KustomizeImage(i))
+		}
+		if p.Chart != nil {
+			chart := Chart(*p.Chart)
+			path.Chart = &chart
+		}
+		spec.Paths = append(spec.Paths, path)
+	}
+	for _, r := range s.Replacement.Rules {
+		spec.Replacement.Rules = append(spec.Replacement.Rules, ReplacementRule{Path: r.Path, ReplaceWith: r.ReplaceWith, Selector: Selector(r.Selector)})
+	}
+	for _, constraint := range s.Replacement.Constraints {
+		spec.Replacement.Constraints = append(spec.Replacement.Constraints, Constraint(constraint))
+	}
+	for _, d := range s.Replacement.Digests {
+		spec.Replacement.Digests = append(spec.Replacement.Digests, Digest(d))
+	}
+	return PromotionConfig{APIVersion: &apiVersion, Kind: &kind, Metadata: Metadata(c.Metadata), Spec: spec}
+}
+
+// ConvertToV1 converts the configuration to keptn.sh/v1. A single next stage is written as spec.nextStage. The fields
+// added in keptn.sh/v2 (more than one next stage, spec.dryRun, spec.target.secretKey and
+// spec.target.secretNamespace) can not be converted and are returned as lost
+func ConvertToV1(c PromotionConfig) (converted PromotionConfigV1, lost []string) {
+	apiVersion, kind := APIVersionV1, KindGitPromotionConfig
+	s := c.Spec
+	spec := PromotionConfigSpecV1{
+		Strategy:     s.Strategy,
+		NextStageMap: s.NextStageMap,
+		Target:       TargetV1{Repo: s.Target.Repo, Secret: s.Target.Secret, Provider: s.Target.Provider},
+		Replacement: ReplacementV1{
+			Strict:      s.Replacement.Strict,
+			OnViolation: s.Replacement.OnViolation,
+		},
+		Registry:    RegistryV1(s.Registry),
+		Enrichment:  EnrichmentV1(s.Enrichment),
+		PullRequest: PullRequestV1(s.PullRequest),
+		Merge:       s.Merge,
+	}
+	switch {
+	case len(s.NextStages) == 1:
+		spec.NextStage = &s.NextStages[0]
+	case len(s.NextStages) > 1:
+		lost = append(lost, "spec.nextStages")
+	}
+	if s.DryRun != nil {
+		lost = append(lost, "spec.dryRun")
+	}
+	if s.Target.SecretKey != nil {
+		lost = append(lost, "spec.target.secretKey")
+	}
+	if s.Target.SecretNamespace != nil {
+		lost = append(lost, "spec.target.secretNamespace")
+	}
+	for _, p := range s.Paths {
+		path := PathV1{ID: p.ID, Patch: p.Patch, Source: p.Source, Target: p.Target, Mode: p.Mode}
+		for _, i := range p.Images {
+			path.Images = append(path.Images, KustomizeImageV1(i))
+		}
+		if p.Chart != nil {
+			chart := ChartV1(*p.Chart)
+			path.Chart = &chart
+		}
+		spec.Paths = append(spec.Paths, path)
+	}
+	for _, r := range s.Replacement.Rules {
+		spec.Replacement.Rules = append(spec.Replacement.Rules, ReplacementRuleV1{Path: r.Path, ReplaceWith: r.ReplaceWith, Selector: SelectorV1(r.Selector)})
+	}
+	for _, constraint := range s.Replacement.Constraints {
+		spec.Replacement.Constraints = append(spec.Replacement.Constraints, ConstraintV1(constraint))
+	}
+	for _, d := range s.Replacement.Digests {
+		spec.Replacement.Digests = append(spec.Replacement.Digests, DigestV1(d))
+	}
+	return PromotionConfigV1{APIVersion: &apiVersion, Kind: &kind, Metadata: MetadataV1(c.Metadata), Spec: spec}, lost
+}
@@ -0,0 +1,155 @@
+package placeholder
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+// EnvAllowListVariable is the environment variable with the comma separated names of environment variables
+// that may be referenced with ${env.<name>}
+const EnvAllowListVariable = "PLACEHOLDER_ENV_ALLOWLIST"
+
+const labelsPrefix = "labels."
+const envPrefix = "env."
+const dataPrefix = "data."
+
+// expressionRegexp matches ${name}, ${name:-default} and (to report them) expressions with other modifiers like
+// ${name:value}. A leading $ ($${name}) escapes the expression
+var expressionRegexp = regexp.MustCompile(`\$?\$\{([^}:]*)(:([^}]*))?\}`)
+
+// Resolver replaces ${...} expressions in strings. Names are resolved in the following order:
+//   - the builtin values (e.g. project, stage, nextstage, service)
+//   - labels.<name> with the label of the triggered event (data.labels.<name>)
+//   - env.<name> with the environment variable if it is on the allow-list
+//   - all other names with the flattened event values (e.g. data.image.tag, shkeptncontext, events.deployment.finished.data.result)
+//
+// ${name:-default} uses default if the value is missing or empty
+type Resolver struct {
+	builtins map[string]string
+	fields   map[string]string
+	envAllow map[string]bool
+	fallback *string
+}
+
+// NewResolver returns a new Resolver. The env allow-list is read from EnvAllowListVariable
+func NewResolver(builtins map[string]string, fields map[string]string) Resolver {
+	return NewResolverWithEnv(builtins, fields, strings.Split(os.Getenv(EnvAllowListVariable), ","))
+}
+
+// NewResolverWithEnv returns a new Resolver allowing access to the environment variables in envAllowList
+func NewResolverWithEnv(builtins map[string]string, fields map[string]string, envAllowList []string) Resolver {
+	envAllow := make(map[string]bool)
+	for _, e := range envAllowList {
+		if e = strings.TrimSpace(e); e != "" {
+			envAllow[e] = true
+		}
+	}
+	return Resolver{builtins: builtins, fields: fields, envAllow: envAllow}
+}
+
+// WithFallback returns a copy of the resolver replacing unknown expressions with value instead of reporting them
+// (e.g. to validate a configuration without event)
+func (r Resolver) WithFallback(value string) Resolver {
+	r.fallback = &value
+	return r
+}
+
+// Resolve replaces all expressions in s. Expressions without value and default are returned as unknown and left
+// untouched. Expressions with another modifier than :- (e.g. ${x:foo}) are always returned as unknown, also with a fallback
+func (r Resolver) Resolve(s string) (result string, unknown []string) {
+	result = expressionRegexp.ReplaceAllStringFunc(s, func(expression string) string {
+		if strings.HasPrefix(expression, "$$") {
+			return expression[1:]
+		}
+		m := expressionRegexp.FindStringSubmatch(expression)
+		hasDefault := strings.HasPrefix(m[3], "-")
+		if m[2] != "" && !hasDefault {
+			unknown = append(unknown, expression)
+			return expression
+		}
+		if v, ok := r.lookup(m[1]); ok && (v != "" || !hasDefault) {
+			return v
+		} else if hasDefault {
+			return m[3][1:]
+		} else if r.fallback != nil {
+			return *r.fallback
+		}
+		unknown = append(unknown, expression)
+		return expression
+	})
+	return result, unknown
+}
+
+func (r Resolver) lookup(name string) (string, bool) {
+	if v, ok := r.builtins[name]; ok {
+		return v, true
+	}
+	if strings.HasPrefix(name, labelsPrefix) {
+		v, ok := r.fields[dataPrefix+name]
+		return v, ok
+	}
+	if strings.HasPrefix(name, envPrefix) {
+		if !r.envAllow[strings.TrimPrefix(name, envPrefix)] {
+			return "", false
+		}
+		return os.LookupEnv(strings.TrimPrefix(name, envPrefix))
+	}
+	v, ok := r.fields[name]
+	return v, ok
+}
+
+// Unknown is an unknown expression in the field with the path Path
+type Unknown struct {
+	Path       string
+	Expression string
+}
+
+// ReplaceAll resolves the expressions of all string fields of the struct target points to. Nested structs, pointers
+// and slices are traversed and copied before they are changed, so values shared with other structs are left untouched.
+// All unknown expressions are returned with the path of the field (built from the yaml names with root as prefix)
+func (r Resolver) ReplaceAll(root string, target interface{}) (unknown []Unknown) {
+	return r.replaceValue(root, reflect.ValueOf(target).Elem())
+}
+
+func (r Resolver) replaceValue(path string, v reflect.Value) (unknown []Unknown) {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if !v.IsNil() {
+			elem := reflect.New(v.Type().Elem())
+			elem.Elem().Set(v.Elem())
+			unknown = r.replaceValue(path, elem.Elem())
+			v.Set(elem)
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			if field.PkgPath != "" {
+				continue
+			}
+			name := strings.Split(field.Tag.Get("yaml"), ",")[0]
+			if name == "" {
+				name = strings.ToLower(field.Name)
+			}
+			unknown = append(unknown, r.replaceValue(path+"."+name, v.Field(i))...)
+		}
+	case reflect.Slice:
+		if !v.IsNil() {
+			elems := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+			reflect.Copy(elems, v)
+			for i := 0; i < elems.Len(); i++ {
+				unknown = append(unknown, r.replaceValue(fmt.Sprintf("%s[%d]", path, i), elems.Index(i))...)
+			}
+			v.Set(elems)
+		}
+	case reflect.String:
+		result, expressions := r.Resolve(v.String())
+		for _, e := range expressions {
+			unknown = append(unknown, Unknown{Path: path, Expression: e})
+		}
+		v.SetString(result)
+	}
+	return unknown
+}
@@ -0,0 +1,128 @@
+package placeholder
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestResolver_Resolve(t *testing.T) {
+	os.Setenv("PLACEHOLDER_TEST_ALLOWED", "allowed")
+	os.Setenv("PLACEHOLDER_TEST_SECRET", "secret")
+	defer os.Unsetenv("PLACEHOLDER_TEST_ALLOWED")
+	defer os.Unsetenv("PLACEHOLDER_TEST_SECRET")
+
+	r := NewResolverWithEnv(map[string]string{
+		"stage":   "mystage",
+		"service": "myservice",
+		"project": "myproject",
+	}, map[string]string{
+		"data.image.tag":     "1.2.3",
+		"data.labels.team":   "blue",
+		"data.labels.empty":  "",
+		"data.images[0].tag": "0.1",
+		"shkeptncontext":     "mycontext",
+	}, []string{"PLACEHOLDER_TEST_ALLOWED"})
+
+	tests := []struct {
+		name        string
+		s           string
+		wantResult  string
+		wantUnknown []string
+	}{
+		{
+			name:       "builtins",
+			s:          "${project}/${service}/${stage} => project: ${project} service: ${service} stage: ${stage}",
+			wantResult: "myproject/myservice/mystage => project: myproject service: myservice stage: mystage",
+		},
+		{
+			name:       "event values and labels",
+			s:          "promote/${data.image.tag}-${labels.team}-${shkeptncontext}-${data.images[0].tag}",
+			wantResult: "promote/1.2.3-blue-mycontext-0.1",
+		},
+		{
+			name:       "defaults",
+			s:          "${labels.repo:-fallback} ${labels.empty:-empty} ${labels.team:-ignored} ${labels.none:-}",
+			wantResult: "fallback empty blue ",
+		},
+		{
+			name:        "env allow-list",
+			s:           "${env.PLACEHOLDER_TEST_ALLOWED} ${env.PLACEHOLDER_TEST_SECRET}",
+			wantResult:  "allowed ${env.PLACEHOLDER_TEST_SECRET}",
+			wantUnknown: []string{"${env.PLACEHOLDER_TEST_SECRET}"},
+		},
+		{
+			name:        "unknown modifier",
+			s:           "${x:foo} ${labels.team:+set} ${stage:}",
+			wantResult:  "${x:foo} ${labels.team:+set} ${stage:}",
+			wantUnknown: []string{"${x:foo}", "${labels.team:+set}", "${stage:}"},
+		},
+		{
+			name:        "unknown and escaped",
+			s:           "${nextstage} $${project}",
+			wantResult:  "${nextstage} ${project}",
+			wantUnknown: []string{"${nextstage}"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotResult, gotUnknown := r.Resolve(tt.s)
+			if gotResult != tt.wantResult {
+				t.Errorf("Resolve() = %v, want %v", gotResult, tt.wantResult)
+			}
+			if !reflect.DeepEqual(gotUnknown, tt.wantUnknown) {
+				t.Errorf("Resolve() unknown = %v, want %v", gotUnknown, tt.wantUnknown)
+			}
+		})
+	}
+}
+
+func TestResolver_ReplaceAll(t *testing.T) {
+	type path struct {
+		Target *string `yaml:"target"`
+	}
+	type spec struct {
+		Repo   string   `yaml:"repo"`
+		Paths  []path   `yaml:"paths"`
+		Labels []string `yaml:"labels"`
+	}
+	target := "${stage}/${unknown}"
+	original := spec{
+		Repo:   "https://github.com/test/${project}",
+		Paths:  []path{{Target: &target}},
+		Labels: []string{"team-${labels.team}"},
+	}
+	r := NewResolverWithEnv(map[string]string{"project": "myproject", "stage": "mystage"}, map[string]string{"data.labels.team": "blue"}, nil)
+
+	replaced := original
+	unknown := r.ReplaceAll("spec", &replaced)
+	want := spec{
+		Repo:   "https://github.com/test/myproject",
+		Paths:  []path{{Target: strPtr("mystage/${unknown}")}},
+		Labels: []string{"team-blue"},
+	}
+	if !reflect.DeepEqual(replaced, want) {
+		t.Errorf("ReplaceAll() = %+v, want %+v", replaced, want)
+	}
+	if !reflect.DeepEqual(unknown, []Unknown{{Path: "spec.paths[0].target", Expression: "${unknown}"}}) {
+		t.Errorf("ReplaceAll() unknown = %v", unknown)
+	}
+	if *original.Paths[0].Target != "${stage}/${unknown}" || original.Labels[0] != "team-${labels.team}" {
+		t.Errorf("ReplaceAll() changed shared values %+v", original)
+	}
+}
+
+func TestResolver_WithFallback(t *testing.T) {
+	r := NewResolverWithEnv(map[string]string{"stage": "dev"}, nil, nil).WithFallback("placeholder")
+	result, unknown := r.Resolve("https://github.com/${labels.org}/${stage}-${service:-svc}")
+	if result != "https://github.com/placeholder/dev-svc" || len(unknown) > 0 {
+		t.Errorf("Resolve() = %v, %v", result, unknown)
+	}
+	if result, unknown = r.Resolve("${labels.org:org}"); result != "${labels.org:org}" || !reflect.DeepEqual(unknown, []string{"${labels.org:org}"}) {
+		t.Errorf("Resolve() = %v, %v, want unknown modifier", result, unknown)
+	}
+}
+
+func strPtr(s string) *string {
+	return &s
+}
@@ -1,18 +1,39 @@
 package promoter
 
 import (
+	"errors"
 	"fmt"
 	logger "github.com/sirupsen/logrus"
+	"keptn/git-promotion-service/pkg/model"
 	"keptn/git-promotion-service/pkg/repoaccess"
 	"strings"
 )
 
 type BranchPromoter struct {
-	client                 repoaccess.Client
+	client                 BranchRepository
 	pullRequestTitlePrefix string
+	// Labels are added to opened and updated pull requests (optional)
+	Labels []string
+	// Verify is optional and called with the files changed by the commits of the stage branch before a pull request is
+	// opened or updated
+	Verify Verifier
+	// ReportFinding is optional and called for the warnings found during the promotion (e.g. labels which could not be
+	// added)
+	ReportFinding func(finding model.Finding)
 }
 
-func NewBranchPromoter(client repoaccess.Client, pullRequestTitlePrefix string) BranchPromoter {
+// BranchRepository is the access to the git repository used by BranchPromoter
+type BranchRepository interface {
+	CheckForNewCommits(toBranch, fromBranch string) (newCommits bool, err error)
+	CompareBranches(toBranch, fromBranch string) (files []repoaccess.ChangedFile, err error)
+	GetFilesForBranch(branch, path string) (files []repoaccess.RepositoryFile, err error)
+	GetOpenPullRequest(fromBranch, toBranch string) (pr *repoaccess.PullRequest, err error)
+	EditPullRequest(pr *repoaccess.PullRequest, title, body string) error
+	CreatePullRequest(fromBranch, toBranch, title, body string) (pr *repoaccess.PullRequest, err error)
+	AddLabels(pr *repoaccess.PullRequest, labels []string) error
+}
+
+func NewBranchPromoter(client BranchRepository, pullRequestTitlePrefix string) BranchPromoter {
 	return BranchPromoter{client: client, pullRequestTitlePrefix: pullRequestTitlePrefix}
 }
 
@@ -22,6 +43,8 @@ func (promoter BranchPromoter) Promote(repositoryUrl, fromBranch, toBranch, titl
 	} else if !newCommits {
 		logger.WithField("func", "manageBranchStrategy").Infof("no difference found in repo %s from branch %s to %s", repositoryUrl, fromBranch, toBranch)
 		return fmt.Sprintf("no difference between branches %s and %s found => nothing todo", fromBranch, toBranch), nil, nil
+	} else if err := promoter.verifyBranches(fromBranch, toBranch); err != nil {
+		return "", nil, err
 	} else if pr, err := promoter.client.GetOpenPullRequest(fromBranch, toBranch); err != nil {
 		return "", nil, err
 	} else if pr != nil {
@@ -31,16 +54,94 @@ func (promoter BranchPromoter) Promote(repositoryUrl, fromBranch, toBranch, titl
 				return "", nil, err
 			}
 			logger.WithField("func", "manageBranchStrategy").Infof("updated pull request %d in repo %s from branch %s to %s", pr.Number, repositoryUrl, fromBranch, toBranch)
+			addLabels(promoter.client, pr, promoter.Labels, promoter.ReportFinding)
 			return "updated pull request", &pr.URL, nil
 		} else {
 			return "unmanaged pull request already open", &pr.URL, nil
 		}
 	} else {
 		pr, err := promoter.client.CreatePullRequest(fromBranch, toBranch, title, body)
-		if err != nil {
+		if errors.Is(err, repoaccess.ErrNoPullRequests) {
+			logger.WithField("func", "manageBranchStrategy").Infof("new commits in repo %s from branch %s to %s without pull request: %v", repositoryUrl, fromBranch, toBranch, err)
+			return fmt.Sprintf("new commits in branch %s for %s (no pull request without access token)", fromBranch, toBranch), nil, nil
+		} else if err != nil {
 			return message, nil, err
 		}
 		logger.WithField("func", "manageBranchStrategy").Infof("opened pull request %d in repo %s from branch %s to %s", pr.Number, repositoryUrl, fromBranch, toBranch)
+		addLabels(promoter.client, pr, promoter.Labels, promoter.ReportFinding)
 		return "opened pull request", &pr.URL, nil
 	}
 }
+
+// DryRun returns the changes of fromBranch missing in toBranch which would be promoted by the pull request. The
+// checks of Promote run as well: without new commits there are no changes and an open pull request not managed by the
+// service is reported in the note of the result
+func (promoter BranchPromoter) DryRun(fromBranch, toBranch string) (result DryRunResult, err error) {
+	if newCommits, err := promoter.client.CheckForNewCommits(toBranch, fromBranch); err != nil {
+		return result, err
+	} else if !newCommits {
+		return result, nil
+	}
+	if pr, err := promoter.client.GetOpenPullRequest(fromBranch, toBranch); err != nil {
+		return result, err
+	} else if pr != nil && !strings.HasPrefix(pr.Title, promoter.pullRequestTitlePrefix) {
+		result.Note = fmt.Sprintf("unmanaged pull request %s already open", pr.URL)
+	}
+	files, err := promoter.client.CompareBranches(toBranch, fromBranch)
+	if err != nil {
+		return result, err
+	}
+	for _, f := range files {
+		result.Files = append(result.Files, f.Path)
+	}
+	if err := promoter.verify(fromBranch, toBranch, files); err != nil {
+		return result, err
+	}
+	result.Diff = compareDiff(files)
+	return result, nil
+}
+
+// verifyBranches calls Verify with the contents of the files changed by the commits of fromBranch missing in toBranch
+func (promoter BranchPromoter) verifyBranches(fromBranch, toBranch string) error {
+	if promoter.Verify == nil {
+		return nil
+	}
+	changed, err := promoter.client.CompareBranches(toBranch, fromBranch)
+	if err != nil {
+		return err
+	}
+	return promoter.verify(fromBranch, toBranch, changed)
+}
+
+// verify calls Verify with the contents of the changed files in toBranch and fromBranch
+func (promoter BranchPromoter) verify(fromBranch, toBranch string, changed []repoaccess.ChangedFile) (err error) {
+	if promoter.Verify == nil {
+		return nil
+	}
+	var files []FileChange
+	for _, c := range changed {
+		file := FileChange{Path: c.Path}
+		if file.Current, err = promoter.fileContent(toBranch, c.Path); err != nil {
+			return err
+		}
+		if file.New, err = promoter.fileContent(fromBranch, c.Path); err != nil {
+			return err
+		}
+		files = append(files, file)
+	}
+	return verify(promoter.Verify, files)
+}
+
+// fileContent returns the content of the file in branch or nil if it does not exist
+func (promoter BranchPromoter) fileContent(branch, path string) (*string, error) {
+	files, err := promoter.client.GetFilesForBranch(branch, path)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range files {
+		if f.Path == path {
+			return stringPtr(f.Content), nil
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,83 @@
+package promoter
+
+import (
+	"errors"
+	"keptn/git-promotion-service/pkg/model"
+	"keptn/git-promotion-service/pkg/repoaccess"
+	"reflect"
+	"testing"
+)
+
+func TestBranchPromoter_DryRun(t *testing.T) {
+	changed := []repoaccess.ChangedFile{{Path: "values.yaml", Status: "modified", Patch: "@@ -1 +1 @@\n-image: 1.0\n+image: 1.1"}}
+	tests := []struct {
+		name        string
+		newCommits  bool
+		pullRequest *repoaccess.PullRequest
+		wantFiles   []string
+		wantNote    string
+	}{
+		{name: "no new commits"},
+		{name: "new commits", newCommits: true, wantFiles: []string{"values.yaml"}},
+		{name: "managed pull request", newCommits: true, pullRequest: &repoaccess.PullRequest{Title: "keptn: promote", URL: "pr/1"}, wantFiles: []string{"values.yaml"}},
+		{name: "unmanaged pull request", newCommits: true, pullRequest: &repoaccess.PullRequest{Title: "manual", URL: "pr/1"}, wantFiles: []string{"values.yaml"}, wantNote: "unmanaged pull request pr/1 already open"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repository := &fakeRepository{t: t, newCommits: tt.newCommits, changed: changed, pullRequest: tt.pullRequest,
+				files: map[string][]repoaccess.RepositoryFile{
+					"staging":    {{Path: "values.yaml", Content: "image: 1.1\n"}},
+					"production": {{Path: "values.yaml", Content: "image: 1.0\n"}},
+				}}
+			p := NewBranchPromoter(repository, "keptn:")
+			var verified []FileChange
+			p.Verify = func(files []FileChange) error {
+				verified = files
+				return nil
+			}
+			result, err := p.DryRun("staging", "production")
+			if err != nil {
+				t.Fatalf("DryRun() error = %v", err)
+			}
+			if tt.newCommits && (len(verified) != 1 || verified[0].Path != "values.yaml" || verified[0].Current == nil || verified[0].New == nil || *verified[0].Current != "image: 1.0\n" || *verified[0].New != "image: 1.1\n") {
+				t.Errorf("DryRun() verified %v", verified)
+			}
+			if !reflect.DeepEqual(result.Files, tt.wantFiles) || result.Note != tt.wantNote {
+				t.Errorf("DryRun() = %v, %q, want %v, %q", result.Files, result.Note, tt.wantFiles, tt.wantNote)
+			}
+		})
+	}
+}
+
+func TestBranchPromoter_Promote_labelsFailed(t *testing.T) {
+	tests := []struct {
+		name        string
+		pullRequest *repoaccess.PullRequest
+		wantMessage string
+	}{
+		{name: "opened pull request", wantMessage: "opened pull request"},
+		{name: "updated pull request", pullRequest: &repoaccess.PullRequest{Number: 1, Title: "keptn: promote", URL: "pr/1"}, wantMessage: "updated pull request"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repository := &fakeRepository{t: t, newCommits: true, pullRequest: tt.pullRequest, pullRequests: true, labelsErr: errors.New("label not found")}
+			p := NewBranchPromoter(repository, "keptn:")
+			p.Labels = []string{"promotion"}
+			var findings []model.Finding
+			p.ReportFinding = func(finding model.Finding) {
+				findings = append(findings, finding)
+			}
+			message, prLink, err := p.Promote("https://github.com/test/repo", "staging", "production", "keptn: promote", "")
+			if err != nil {
+				t.Fatalf("Promote() error = %v", err)
+			}
+			if message != tt.wantMessage || prLink == nil || *prLink != "pr/1" {
+				t.Errorf("Promote() = %v, %v, want %v with pull request link", message, prLink, tt.wantMessage)
+			}
+			want := []model.Finding{model.NewWarning(model.FindingLabelsNotAdded, "spec.pullRequest.labels", "could not add labels to pull request pr/1: label not found")}
+			if !reflect.DeepEqual(findings, want) {
+				t.Errorf("Promote() findings = %v, want %v", findings, want)
+			}
+		})
+	}
+}
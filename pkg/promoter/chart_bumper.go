@@ -0,0 +1,142 @@
+package promoter
+
+import (
+	"fmt"
+	"github.com/Masterminds/semver/v3"
+	logger "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+	"keptn/git-promotion-service/pkg/model"
+	"keptn/git-promotion-service/pkg/replacer"
+	"keptn/git-promotion-service/pkg/repoaccess"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const chartFileName = "Chart.yaml"
+
+var chartVersionRegexp = regexp.MustCompile(`(?m)^version:.*$`)
+
+type chartMetadata struct {
+	Version string `yaml:"version"`
+}
+
+// bumpChangedCharts sets the appVersion of all charts in newTargetFiles and bumps the version of the charts whose
+// contents differ from the currentTargetFiles. The version is bumped based on the version of the current chart. The
+// version of an existing chart is never lowered
+func bumpChangedCharts(change pathChange, chart model.Chart, fields map[string]string) (report replacer.Report, err error) {
+	currentFiles := make(map[string]repoaccess.RepositoryFile)
+	for _, f := range change.currentTargetFiles {
+		currentFiles[f.Path] = f
+	}
+	for i, f := range change.newTargetFiles {
+		if path.Base(f.Path) != chartFileName {
+			continue
+		}
+		if chart.AppVersion != nil && *chart.AppVersion != "" {
+			annotation := replacer.Annotation{File: f.Path, Key: *chart.AppVersion}
+			report.Annotations = append(report.Annotations, annotation)
+			if appVersion, ok := fields[*chart.AppVersion]; !ok {
+				report.Unresolved = append(report.Unresolved, annotation)
+			} else {
+				change.newTargetFiles[i].Content = setAppVersion(f.Content, appVersion)
+			}
+		}
+		currentChart, exists := currentFiles[f.Path]
+		if !exists {
+			logger.WithField("func", "bumpChangedCharts").Infof("chart %s is new => keeping version", f.Path)
+			continue
+		}
+		if !chartChanged(path.Dir(f.Path), change.newTargetFiles, change.currentTargetFiles) {
+			if version, lower := lowerChartVersion(currentChart.Content, change.newTargetFiles[i].Content); !lower {
+				continue
+			} else if content, ok := replacer.SetValue(change.newTargetFiles[i].Content, "version", version); !ok {
+				return report, fmt.Errorf("could not set version of chart %s", f.Path)
+			} else {
+				logger.WithField("func", "bumpChangedCharts").Infof("keeping higher version %s of unchanged chart %s", version, f.Path)
+				change.newTargetFiles[i].Content = content
+			}
+			continue
+		}
+		if newVersion, err := nextChartVersion(currentChart.Content, change.newTargetFiles[i].Content, chart.Bump); err != nil {
+			return report, fmt.Errorf("could not bump version of chart %s: %w", f.Path, err)
+		} else if content, ok := replacer.SetValue(change.newTargetFiles[i].Content, "version", newVersion); !ok {
+			return report, fmt.Errorf("could not set version of chart %s", f.Path)
+		} else {
+			logger.WithField("func", "bumpChangedCharts").Infof("bumped version of chart %s to %s", f.Path, newVersion)
+			change.newTargetFiles[i].Content = content
+		}
+	}
+	return report, nil
+}
+
+func setAppVersion(content, appVersion string) string {
+	if result, ok := replacer.SetValue(content, "appVersion", appVersion); ok {
+		return result
+	}
+	return strings.TrimSuffix(content, "\n") + "\nappVersion: " + strconv.Quote(appVersion) + "\n"
+}
+
+// nextChartVersion returns the bumped version of the current chart or the version of the new chart if it is higher
+func nextChartVersion(currentChart, newChart string, bump *string) (string, error) {
+	current, err := parseChartVersion(currentChart)
+	if err != nil {
+		return "", err
+	}
+	var next semver.Version
+	switch toString(bump) {
+	case model.BumpMajor:
+		next = current.IncMajor()
+	case model.BumpMinor:
+		next = current.IncMinor()
+	default:
+		next = current.IncPatch()
+	}
+	if source, err := parseChartVersion(newChart); err == nil && source.GreaterThan(&next) {
+		return source.Original(), nil
+	}
+	return next.String(), nil
+}
+
+// lowerChartVersion returns the version of the current chart and true if the version of the new chart is lower or
+// invalid. Charts with an invalid current version are not compared
+func lowerChartVersion(currentChart, newChart string) (string, bool) {
+	current, err := parseChartVersion(currentChart)
+	if err != nil {
+		return "", false
+	}
+	if source, err := parseChartVersion(newChart); err == nil && !source.LessThan(current) {
+		return "", false
+	}
+	return current.Original(), true
+}
+
+func parseChartVersion(content string) (*semver.Version, error) {
+	var metadata chartMetadata
+	if err := yaml.Unmarshal([]byte(content), &metadata); err != nil {
+		return nil, err
+	}
+	return semver.NewVersion(metadata.Version)
+}
+
+// chartChanged compares all files of the chart in dir ignoring the chart version
+func chartChanged(dir string, newFiles, currentFiles []repoaccess.RepositoryFile) bool {
+	return checkForChanges(chartFiles(dir, newFiles), chartFiles(dir, currentFiles))
+}
+
+func chartFiles(dir string, files []repoaccess.RepositoryFile) (res []repoaccess.RepositoryFile) {
+	prefix := dir + "/"
+	if dir == "." {
+		prefix = ""
+	}
+	for _, f := range files {
+		if strings.HasPrefix(f.Path, prefix) {
+			if f.Path == prefix+chartFileName {
+				f.Content = chartVersionRegexp.ReplaceAllString(f.Content, "")
+			}
+			res = append(res, f)
+		}
+	}
+	return res
+}
@@ -0,0 +1,103 @@
+package promoter
+
+import (
+	"keptn/git-promotion-service/pkg/model"
+	"keptn/git-promotion-service/pkg/repoaccess"
+	"testing"
+)
+
+func Test_bumpChangedCharts(t *testing.T) {
+	chartYaml := func(version, appVersion string) string {
+		return "apiVersion: v2\nname: app\nversion: " + version + "\nappVersion: \"" + appVersion + "\"\n"
+	}
+	type args struct {
+		change pathChange
+		chart  model.Chart
+	}
+	tests := []struct {
+		name      string
+		args      args
+		wantChart string
+	}{
+		{
+			name: "changed chart gets minor bump and appVersion",
+			args: args{
+				change: pathChange{
+					currentTargetFiles: []repoaccess.RepositoryFile{
+						{Path: "prod/app/Chart.yaml", Content: chartYaml("1.2.3", "1.0")},
+						{Path: "prod/app/values.yaml", Content: "replicas: 1"},
+					},
+					newTargetFiles: []repoaccess.RepositoryFile{
+						{Path: "prod/app/Chart.yaml", Content: chartYaml("1.0.0", "1.0")},
+						{Path: "prod/app/values.yaml", Content: "replicas: 2"},
+					},
+				},
+				chart: model.Chart{Bump: strPtr("minor"), AppVersion: strPtr("data.image.tag")},
+			},
+			wantChart: chartYaml("1.3.0", "2.0"),
+		},
+		{
+			name: "only lower version differs",
+			args: args{
+				change: pathChange{
+					currentTargetFiles: []repoaccess.RepositoryFile{
+						{Path: "prod/app/Chart.yaml", Content: chartYaml("1.2.3", "1.0")},
+						{Path: "prod/app/values.yaml", Content: "replicas: 1"},
+					},
+					newTargetFiles: []repoaccess.RepositoryFile{
+						{Path: "prod/app/Chart.yaml", Content: chartYaml("1.0.0", "1.0")},
+						{Path: "prod/app/values.yaml", Content: "replicas: 1"},
+					},
+				},
+				chart: model.Chart{},
+			},
+			wantChart: chartYaml("1.2.3", "1.0"),
+		},
+		{
+			name: "only higher version differs",
+			args: args{
+				change: pathChange{
+					currentTargetFiles: []repoaccess.RepositoryFile{
+						{Path: "prod/app/Chart.yaml", Content: chartYaml("1.2.3", "1.0")},
+					},
+					newTargetFiles: []repoaccess.RepositoryFile{
+						{Path: "prod/app/Chart.yaml", Content: chartYaml("1.4.0", "1.0")},
+					},
+				},
+				chart: model.Chart{},
+			},
+			wantChart: chartYaml("1.4.0", "1.0"),
+		},
+		{
+			name: "higher source version wins",
+			args: args{
+				change: pathChange{
+					currentTargetFiles: []repoaccess.RepositoryFile{
+						{Path: "Chart.yaml", Content: chartYaml("1.2.3", "1.0")},
+					},
+					newTargetFiles: []repoaccess.RepositoryFile{
+						{Path: "Chart.yaml", Content: chartYaml("2.0.0", "1.0")},
+						{Path: "templates/service.yaml", Content: "kind: Service"},
+					},
+				},
+				chart: model.Chart{Bump: strPtr("patch")},
+			},
+			wantChart: chartYaml("2.0.0", "1.0"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := bumpChangedCharts(tt.args.change, tt.args.chart, map[string]string{"data.image.tag": "2.0"}); err != nil {
+				t.Errorf("bumpChangedCharts() error = %v", err)
+				return
+			}
+			if got := tt.args.change.newTargetFiles[0].Content; got != tt.wantChart {
+				t.Errorf("bumpChangedCharts() = %v, want %v", got, tt.wantChart)
+			}
+		})
+	}
+}
+
+func strPtr(str string) *string {
+	return &str
+}
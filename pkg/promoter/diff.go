@@ -0,0 +1,72 @@
+package promoter
+
+import (
+	"strings"
+
+	"github.com/pmezard/go-difflib/difflib"
+	"keptn/git-promotion-service/pkg/repoaccess"
+)
+
+// DryRunResult contains the changes a promotion would commit
+type DryRunResult struct {
+	// Files are the paths of the created, updated and deleted files
+	Files []string
+	// Diff is the unified diff of all changes
+	Diff string
+	// Note explains why the promotion would not open a pull request although there are changes (optional)
+	Note string
+}
+
+// UnifiedDiff returns the unified diff of the changed files. The paths are prefixed with prefix (e.g. a stage)
+func UnifiedDiff(files []FileChange, prefix string) (string, error) {
+	var diff strings.Builder
+	for _, f := range files {
+		if !f.Changed() {
+			continue
+		}
+		fileDiff := difflib.UnifiedDiff{FromFile: "a/" + prefix + f.Path, ToFile: "b/" + prefix + f.Path, Context: 3}
+		if f.Current == nil {
+			fileDiff.FromFile = "/dev/null"
+		} else {
+			fileDiff.A = splitLines(*f.Current)
+		}
+		if f.New == nil {
+			fileDiff.ToFile = "/dev/null"
+		} else {
+			fileDiff.B = splitLines(*f.New)
+		}
+		if err := difflib.WriteUnifiedDiff(&diff, fileDiff); err != nil {
+			return "", err
+		}
+	}
+	return diff.String(), nil
+}
+
+// compareDiff returns the unified diff of the files changed between two branches
+func compareDiff(files []repoaccess.ChangedFile) string {
+	var diff strings.Builder
+	for _, f := range files {
+		from, to := "a/"+f.Path, "b/"+f.Path
+		switch f.Status {
+		case "added":
+			from = "/dev/null"
+		case "removed":
+			to = "/dev/null"
+		}
+		diff.WriteString("--- " + from + "\n+++ " + to + "\n")
+		if f.Patch != "" {
+			diff.WriteString(strings.TrimSuffix(f.Patch, "\n") + "\n")
+		}
+	}
+	return diff.String()
+}
+
+// splitLines splits the content into lines ending with a newline (also the last line)
+func splitLines(content string) []string {
+	lines := strings.SplitAfter(content, "\n")
+	if lines[len(lines)-1] == "" {
+		return lines[:len(lines)-1]
+	}
+	lines[len(lines)-1] += "\n"
+	return lines
+}
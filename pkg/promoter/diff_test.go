@@ -0,0 +1,60 @@
+package promoter
+
+import (
+	"keptn/git-promotion-service/pkg/repoaccess"
+	"testing"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	files := []FileChange{
+		{Path: "staging/new.yaml", New: stringPtr("a: 1\n")},
+		{Path: "staging/old.yaml", Current: stringPtr("b: 2")},
+		{Path: "staging/same.yaml", Current: stringPtr("c: 3\n"), New: stringPtr("c: 3\n")},
+		{Path: "staging/values.yaml", Current: stringPtr("image: 1.0\nreplicas: 1\n"), New: stringPtr("image: 2.0\nreplicas: 1\n")},
+	}
+	want := `--- /dev/null
++++ b/prod/staging/new.yaml
+@@ -0,0 +1 @@
++a: 1
+--- a/prod/staging/old.yaml
++++ /dev/null
+@@ -1 +0,0 @@
+-b: 2
+--- a/prod/staging/values.yaml
++++ b/prod/staging/values.yaml
+@@ -1,2 +1,2 @@
+-image: 1.0
++image: 2.0
+ replicas: 1
+`
+	got, err := UnifiedDiff(files, "prod/")
+	if err != nil {
+		t.Fatalf("UnifiedDiff() error = %v", err)
+	}
+	if got != want {
+		t.Errorf("UnifiedDiff() = %v, want %v", got, want)
+	}
+}
+
+func Test_compareDiff(t *testing.T) {
+	files := []repoaccess.ChangedFile{
+		{Path: "values.yaml", Status: "modified", Patch: "@@ -1 +1 @@\n-image: 1.0\n+image: 2.0"},
+		{Path: "new.yaml", Status: "added", Patch: "@@ -0,0 +1 @@\n+a: 1"},
+		{Path: "logo.png", Status: "removed"},
+	}
+	want := `--- a/values.yaml
++++ b/values.yaml
+@@ -1 +1 @@
+-image: 1.0
++image: 2.0
+--- /dev/null
++++ b/new.yaml
+@@ -0,0 +1 @@
++a: 1
+--- a/logo.png
++++ /dev/null
+`
+	if got := compareDiff(files); got != want {
+		t.Errorf("compareDiff() = %v, want %v", got, want)
+	}
+}
@@ -7,84 +7,473 @@ import (
 	"keptn/git-promotion-service/pkg/model"
 	"keptn/git-promotion-service/pkg/replacer"
 	"keptn/git-promotion-service/pkg/repoaccess"
+	"sort"
 	"strings"
 )
 
+// ErrReplacementFindings is returned in strict replacement mode if annotations are unresolved or unmatched
+var ErrReplacementFindings = errors.New("unresolved or unmatched replacement annotations")
+
+// ErrVerification is returned if the verification of the promoted files failed
+var ErrVerification = errors.New("verification failed")
+
+// ErrBlockedUpdates is returned if updates are blocked by replacement constraints and violations should fail the promotion
+var ErrBlockedUpdates = errors.New("updates blocked by replacement constraints")
+
+// Verifier checks the files changed by the promotion before anything is written to the repository, e.g. the image
+// references of the files
+type Verifier func(files []FileChange) error
+
+// Repository is the access to the git repository used by FlatPrPromoter
+type Repository interface {
+	BranchExists(branchName string) (exists bool, err error)
+	CreateBranch(sourceBranch, targetBranch string) (err error)
+	DeleteBranch(branch string) (err error)
+	GetFilesForBranch(branch, path string) (files []repoaccess.RepositoryFile, err error)
+	SyncFilesWithBranch(branch, message string, currentTargetFiles, newTargetFiles []repoaccess.RepositoryFile) (changes int, err error)
+	CreatePullRequest(fromBranch, toBranch, title, body string) (pr *repoaccess.PullRequest, err error)
+	AddLabels(pr *repoaccess.PullRequest, labels []string) error
+}
+
 type FlatPrPromoter struct {
-	client repoaccess.Client
+	client Repository
+	// Verify is optional and called with the changed files before the promotion branch is created
+	Verify Verifier
+	// Values are the typed event values used for rendering templates (optional)
+	Values map[string]interface{}
+	// CommitMessage is used for all commits (optional)
+	CommitMessage string
+	// Labels are added to the opened pull request (optional)
+	Labels []string
+	// ReportFinding is optional and called for the warnings found during the promotion (e.g. a missing source)
+	ReportFinding func(finding model.Finding)
+}
+
+type pathChange struct {
+	currentTargetFiles []repoaccess.RepositoryFile
+	newTargetFiles     []repoaccess.RepositoryFile
+}
+
+// FileChange is a file of the target paths of the promotion
+type FileChange struct {
+	Path string
+	// Current is the content in the repository (nil for new files)
+	Current *string
+	// New is the content written by the promotion (nil for deleted files)
+	New *string
+}
+
+// Changed returns true if the promotion creates, updates or deletes the file
+func (c FileChange) Changed() bool {
+	return c.Current == nil || c.New == nil || *c.Current != *c.New
 }
 
-func NewFlatPrPromoter(client repoaccess.Client) FlatPrPromoter {
+func NewFlatPrPromoter(client Repository) FlatPrPromoter {
 	return FlatPrPromoter{client: client}
 }
 
-func (promoter FlatPrPromoter) Promote(repositoryUrl string, fields map[string]string, sourceBranch, targetBranch, title, body string, paths []model.Path) (message string, prLink *string, err error) {
+func (promoter FlatPrPromoter) Promote(repositoryUrl string, fields map[string]string, sourceBranch, targetBranch, title, body string, paths []model.Path, replacement model.Replacement) (message string, prLink *string, report replacer.Report, err error) {
 	logger.WithField("func", "manageFlatPRStrategy").Infof("starting flat pr strategy with sourceBranch %s and targetBranch %s and fields %v", sourceBranch, targetBranch, fields)
 
-	if exists, err := promoter.client.BranchExists(targetBranch); err != nil {
-		return "", nil, err
-	} else if exists {
-		return "", nil, errors.New(fmt.Sprintf("branch with name %s already exists", targetBranch))
+	if err := promoter.checkTargetBranch(targetBranch); err != nil {
+		return "", nil, report, err
 	}
-	if err := promoter.client.CreateBranch(sourceBranch, targetBranch); err != nil {
-		return "", nil, err
+	allChanges, report, err := promoter.plan(fields, sourceBranch, paths, replacement)
+	if err != nil {
+		return "", nil, report, err
 	}
-	changes := 0
-	logger.WithField("func", "manageFlatPRStrategy").Infof("processing %d paths", len(paths))
-	for _, p := range paths {
-		var path string
-		if p.Source == nil {
-			path = *p.Target
+	var pathChanges []pathChange
+	for i, change := range allChanges {
+		if checkForChanges(change.newTargetFiles, change.currentTargetFiles) {
+			pathChanges = append(pathChanges, change)
 		} else {
-			path = *p.Source
+			logger.WithField("func", "manageFlatPRStrategy").Infof("no changes detected in path %s", *paths[i].Target)
 		}
-		pNewTargetFiles, err := promoter.client.GetFilesForBranch(sourceBranch, path)
-		if err != nil {
-			return "", nil, err
-		}
-		var pCurrentTargetFiles []repoaccess.RepositoryFile
-		if p.Source != nil {
-			if pCurrentTargetFiles, err = promoter.client.GetFilesForBranch(sourceBranch, *p.Target); err != nil {
-				return "", nil, err
-			}
-		} else {
-			pCurrentTargetFiles = pNewTargetFiles
+	}
+	if len(pathChanges) == 0 {
+		logger.WithField("func", "manageFlatPRStrategy").Info("no changes detected, doing nothing")
+		return "no changes detected", nil, report, nil
+	}
+	if promoter.Verify != nil {
+		var files []FileChange
+		for _, c := range pathChanges {
+			files = append(files, c.fileChanges()...)
 		}
-		for i, c := range pNewTargetFiles {
-			pNewTargetFiles[i].Content = replacer.Replace(c.Content, fields)
-			if p.Source != nil {
-				pNewTargetFiles[i].Path = strings.Replace(pNewTargetFiles[i].Path, *p.Source, *p.Target, -1)
-			}
+		if err := verify(promoter.Verify, files); err != nil {
+			return "", nil, report, err
 		}
-		if checkForChanges(pNewTargetFiles, pCurrentTargetFiles) {
-			if pathChanges, err := promoter.client.SyncFilesWithBranch(targetBranch, pCurrentTargetFiles, pNewTargetFiles); err != nil {
-				return "", nil, err
-			} else {
-				changes += pathChanges
-			}
+	}
+	if err := promoter.client.CreateBranch(sourceBranch, targetBranch); err != nil {
+		return "", nil, report, err
+	}
+	changes := 0
+	for _, c := range pathChanges {
+		if syncChanges, err := promoter.client.SyncFilesWithBranch(targetBranch, promoter.CommitMessage, c.currentTargetFiles, c.newTargetFiles); err != nil {
+			return "", nil, report, err
 		} else {
-			logger.WithField("func", "manageFlatPRStrategy").Info("no changes detected, doing nothing")
-			return "no changes detected", nil, nil
+			changes += syncChanges
 		}
 	}
 	logger.WithField("func", "manageFlatPRStrategy").Infof("commited %d changes to branch %s", changes, targetBranch)
 	if changes > 0 {
-		if pr, err := promoter.client.CreatePullRequest(targetBranch, sourceBranch, title, body); err != nil {
-			return "", nil, err
+		if pr, err := promoter.client.CreatePullRequest(targetBranch, sourceBranch, title, body); errors.Is(err, repoaccess.ErrNoPullRequests) {
+			logger.WithField("func", "manageFlatPRStrategy").Infof("pushed branch %s to repo %s without pull request: %v", targetBranch, repositoryUrl, err)
+			return fmt.Sprintf("pushed branch %s (no pull request without access token)", targetBranch), nil, report, nil
+		} else if err != nil {
+			return "", nil, report, err
 		} else {
 			logger.WithField("func", "manageFlatPRStrategy").Infof("opened pull request %d in repo %s from branch %s to %s", pr.Number, repositoryUrl, sourceBranch, targetBranch)
-			return "opened pull request", &pr.URL, nil
+			addLabels(promoter.client, pr, promoter.Labels, promoter.ReportFinding)
+			return "opened pull request", &pr.URL, report, nil
 		}
 	} else {
 		logger.WithField("func", "manageFlatPRStrategy").Infof("no changes found, deleting branch %s", targetBranch)
 		if err := promoter.client.DeleteBranch(targetBranch); err != nil {
-			return "", nil, err
+			return "", nil, report, err
 		} else {
-			return "no changes found => no pull request necessary", nil, nil
+			return "no changes found => no pull request necessary", nil, report, nil
 		}
 	}
 }
 
+// DryRun computes the changes Promote would commit without creating the branch, the commits and the pull request.
+// The check of targetBranch, the replacement checks and the verification run like in Promote
+func (promoter FlatPrPromoter) DryRun(fields map[string]string, sourceBranch, targetBranch string, paths []model.Path, replacement model.Replacement) (result DryRunResult, report replacer.Report, err error) {
+	if err := promoter.checkTargetBranch(targetBranch); err != nil {
+		return result, report, err
+	}
+	files, report, err := promoter.Plan(fields, sourceBranch, paths, replacement)
+	if err != nil {
+		return result, report, err
+	}
+	for _, f := range files {
+		if f.Changed() {
+			result.Files = append(result.Files, f.Path)
+		}
+	}
+	if len(result.Files) == 0 {
+		return result, report, nil
+	}
+	if promoter.Verify != nil {
+		if err := verify(promoter.Verify, files); err != nil {
+			return result, report, err
+		}
+	}
+	result.Diff, err = UnifiedDiff(files, "")
+	return result, report, err
+}
+
+// verify calls verifier with the changed files
+func verify(verifier Verifier, files []FileChange) error {
+	var changed []FileChange
+	for _, f := range files {
+		if f.Changed() {
+			changed = append(changed, f)
+		}
+	}
+	if err := verifier(changed); err != nil {
+		return fmt.Errorf("%w: %s", ErrVerification, err.Error())
+	}
+	return nil
+}
+
+// addLabels adds the labels to the pull request. A failure is only reported as warning because the pull request
+// exists already
+func addLabels(client interface {
+	AddLabels(pr *repoaccess.PullRequest, labels []string) error
+}, pr *repoaccess.PullRequest, labels []string, reportFinding func(finding model.Finding)) {
+	if len(labels) == 0 {
+		return
+	}
+	if err := client.AddLabels(pr, labels); err != nil {
+		logger.WithField("func", "addLabels").WithError(err).Warnf("could not add labels to pull request %s", pr.URL)
+		if reportFinding != nil {
+			reportFinding(model.NewWarning(model.FindingLabelsNotAdded, "spec.pullRequest.labels", "could not add labels to pull request %s: %s", pr.URL, err.Error()))
+		}
+	}
+}
+
+// checkTargetBranch fails if the promotion branch already exists
+func (promoter FlatPrPromoter) checkTargetBranch(targetBranch string) error {
+	if exists, err := promoter.client.BranchExists(targetBranch); err != nil {
+		return err
+	} else if exists {
+		return errors.New(fmt.Sprintf("branch with name %s already exists", targetBranch))
+	}
+	return nil
+}
+
+// Plan returns the files of all target paths as they would be written by Promote without changing the repository.
+// The files are sorted by path
+func (promoter FlatPrPromoter) Plan(fields map[string]string, sourceBranch string, paths []model.Path, replacement model.Replacement) (files []FileChange, report replacer.Report, err error) {
+	changes, report, err := promoter.plan(fields, sourceBranch, paths, replacement)
+	if err != nil {
+		return nil, report, err
+	}
+	for _, c := range changes {
+		files = append(files, c.fileChanges()...)
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Path < files[j].Path
+	})
+	return files, report, nil
+}
+
+// plan processes all paths. It fails in strict replacement mode if annotations are unresolved or unmatched and if
+// replacement constraints blocked updates (unless onViolation is warn)
+func (promoter FlatPrPromoter) plan(fields map[string]string, sourceBranch string, paths []model.Path, replacement model.Replacement) (changes []pathChange, report replacer.Report, err error) {
+	logger.WithField("func", "manageFlatPRStrategy").Infof("processing %d paths", len(paths))
+	rules := toReplacerRules(replacement.Rules)
+	constraints := toReplacerConstraints(replacement.Constraints)
+	for i, p := range paths {
+		change, pathReport, err := promoter.processPath(sourceBranch, fmt.Sprintf("spec.paths[%d]", i), p, fields, rules, constraints)
+		if err != nil {
+			return nil, report, err
+		}
+		report.Merge(pathReport)
+		changes = append(changes, change)
+	}
+	promoter.reportUnmatchedSelectors(changes, rules, report.Unselected)
+	if report.HasFindings() {
+		logger.WithField("func", "manageFlatPRStrategy").Warnf("replacement finished with findings: %s", report.String())
+		if replacement.Strict != nil && *replacement.Strict {
+			return nil, report, fmt.Errorf("%w: %s", ErrReplacementFindings, report.String())
+		}
+	}
+	if len(report.Blocked) > 0 {
+		logger.WithField("func", "manageFlatPRStrategy").Warnf("replacement constraints blocked %d updates", len(report.Blocked))
+		if replacement.OnViolation == nil || *replacement.OnViolation != model.ViolationWarn {
+			return nil, report, fmt.Errorf("%w: %s", ErrBlockedUpdates, report.String())
+		}
+	}
+	return changes, report, nil
+}
+
+// reportUnmatchedSelectors reports a warning for every rule whose selector matches no document of the new files and
+// for every annotation whose selector does not match its document
+func (promoter FlatPrPromoter) reportUnmatchedSelectors(changes []pathChange, rules []replacer.Rule, unselected []replacer.Annotation) {
+	if promoter.ReportFinding == nil {
+		return
+	}
+	for i, r := range rules {
+		if r.Selector == (replacer.Selector{}) || selectsDocument(changes, r.Selector) {
+			continue
+		}
+		promoter.ReportFinding(model.NewWarning(model.FindingUnmatchedSelector, fmt.Sprintf("spec.replacement.rules[%d].selector", i), "selector (kind %q, name %q) matches no document", r.Selector.Kind, r.Selector.Name))
+	}
+	for _, a := range unselected {
+		promoter.ReportFinding(model.NewWarning(model.FindingUnmatchedSelector, "", "selector of annotation %s does not match its document", a.String()))
+	}
+}
+
+func selectsDocument(changes []pathChange, selector replacer.Selector) bool {
+	for _, c := range changes {
+		for _, f := range c.newTargetFiles {
+			if replacer.SelectsDocument(f.Path, f.Content, selector) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// fileChanges returns the new, updated, unchanged and deleted files of the path
+func (c pathChange) fileChanges() (files []FileChange) {
+	current := make(map[string]string)
+	for _, f := range c.currentTargetFiles {
+		current[f.Path] = f.Content
+	}
+	written := make(map[string]bool)
+	for _, f := range c.newTargetFiles {
+		change := FileChange{Path: f.Path, New: stringPtr(f.Content)}
+		if content, ok := current[f.Path]; ok {
+			change.Current = stringPtr(content)
+		}
+		written[f.Path] = true
+		files = append(files, change)
+	}
+	for _, f := range c.currentTargetFiles {
+		if !written[f.Path] {
+			files = append(files, FileChange{Path: f.Path, Current: stringPtr(f.Content)})
+		}
+	}
+	return files
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
+
+func (promoter FlatPrPromoter) processPath(sourceBranch, configPath string, p model.Path, fields map[string]string, rules []replacer.Rule, constraints []replacer.Constraint) (change pathChange, report replacer.Report, err error) {
+	var path string
+	if p.Source == nil {
+		path = *p.Target
+		configPath += ".target"
+	} else {
+		path = *p.Source
+		configPath += ".source"
+	}
+	if change.newTargetFiles, err = promoter.client.GetFilesForBranch(sourceBranch, path); err != nil {
+		return change, report, err
+	}
+	if len(change.newTargetFiles) == 0 && promoter.ReportFinding != nil {
+		promoter.ReportFinding(model.NewWarning(model.FindingSourceNotFound, configPath, "%s does not exist in branch %s", path, sourceBranch))
+	}
+	if p.Source != nil {
+		if change.currentTargetFiles, err = promoter.client.GetFilesForBranch(sourceBranch, *p.Target); err != nil {
+			return change, report, err
+		}
+	} else {
+		change.currentTargetFiles = make([]repoaccess.RepositoryFile, len(change.newTargetFiles))
+		copy(change.currentTargetFiles, change.newTargetFiles)
+	}
+	currentFiles := make(map[string]repoaccess.RepositoryFile)
+	for _, f := range change.currentTargetFiles {
+		currentFiles[f.Path] = f
+	}
+	templateMode := p.Mode != nil && *p.Mode == model.PathModeTemplate
+	kustomizeMode := p.Mode != nil && *p.Mode == model.PathModeKustomize
+	var images []replacer.KustomizeImage
+	if kustomizeMode {
+		images = toKustomizeImages(p.Images)
+	}
+	kustomizationFound := false
+	var untouched []string
+	for i, c := range change.newTargetFiles {
+		if p.Source != nil {
+			change.newTargetFiles[i].Path = strings.Replace(c.Path, *p.Source, *p.Target, -1)
+		}
+		template := templateMode && strings.HasSuffix(c.Path, replacer.TemplateSuffix)
+		if template {
+			change.newTargetFiles[i].Path = strings.TrimSuffix(change.newTargetFiles[i].Path, replacer.TemplateSuffix)
+		}
+		current, exists := currentFiles[change.newTargetFiles[i].Path]
+		if template {
+			templateFields := fields
+			if len(constraints) > 0 {
+				var currentContent *string
+				if exists {
+					currentContent = &current.Content
+				}
+				var templateReport replacer.Report
+				var ok bool
+				if templateFields, templateReport, ok, err = replacer.GuardTemplate(change.newTargetFiles[i].Path, c.Content, currentContent, fields, promoter.Values, constraints); err != nil {
+					return change, report, err
+				}
+				report.Merge(templateReport)
+				if !ok {
+					// blocked values without current value leave the target file untouched
+					change.newTargetFiles[i].Content = current.Content
+					if !exists {
+						untouched = append(untouched, change.newTargetFiles[i].Path)
+					}
+					continue
+				}
+			}
+			if change.newTargetFiles[i].Content, err = replacer.Render(c.Path, c.Content, templateFields, promoter.Values); err != nil {
+				return change, report, err
+			}
+			continue
+		}
+		var guard replacer.Guard
+		if len(constraints) > 0 {
+			if guard, err = replacer.NewGuard(constraints, replacer.CurrentValues(current.Path, current.Content, rules, images)); err != nil {
+				return change, report, err
+			}
+		}
+		content, fileReport := replacer.ReplaceFile(change.newTargetFiles[i].Path, c.Content, fields, guard)
+		report.Merge(fileReport)
+		content, fileReport = replacer.ApplyRules(change.newTargetFiles[i].Path, content, rules, fields, guard)
+		report.Merge(fileReport)
+		if kustomizeMode && replacer.IsKustomizationFile(change.newTargetFiles[i].Path) {
+			kustomizationFound = true
+			if content, fileReport, err = replacer.SetKustomizeImages(change.newTargetFiles[i].Path, content, images, fields, guard); err != nil {
+				return change, report, err
+			}
+			report.Merge(fileReport)
+		}
+		change.newTargetFiles[i].Content = content
+	}
+	change.newTargetFiles = withoutFiles(change.newTargetFiles, untouched)
+	if p.Chart != nil {
+		if chartReport, err := bumpChangedCharts(change, *p.Chart, fields); err != nil {
+			return change, report, err
+		} else {
+			report.Merge(chartReport)
+		}
+	}
+	if kustomizeMode && !kustomizationFound {
+		for _, image := range p.Images {
+			report.Unmatched = append(report.Unmatched, replacer.Annotation{File: *p.Target, Key: toString(image.Name)})
+		}
+	}
+	return change, report, nil
+}
+
+// withoutFiles returns the files without the given paths
+func withoutFiles(files []repoaccess.RepositoryFile, paths []string) []repoaccess.RepositoryFile {
+	if len(paths) == 0 {
+		return files
+	}
+	res := make([]repoaccess.RepositoryFile, 0, len(files))
+	for _, f := range files {
+		skip := false
+		for _, p := range paths {
+			skip = skip || f.Path == p
+		}
+		if !skip {
+			res = append(res, f)
+		}
+	}
+	return res
+}
+
+func toReplacerConstraints(constraints []model.Constraint) []replacer.Constraint {
+	res := make([]replacer.Constraint, 0, len(constraints))
+	for _, c := range constraints {
+		res = append(res, replacer.Constraint{
+			Key:    toString(c.Key),
+			Policy: toString(c.Policy),
+		})
+	}
+	return res
+}
+
+func toKustomizeImages(images []model.KustomizeImage) []replacer.KustomizeImage {
+	res := make([]replacer.KustomizeImage, 0, len(images))
+	for _, i := range images {
+		res = append(res, replacer.KustomizeImage{
+			Name:    toString(i.Name),
+			NewName: toString(i.NewName),
+			NewTag:  toString(i.NewTag),
+			Digest:  toString(i.Digest),
+		})
+	}
+	return res
+}
+
+func toReplacerRules(rules []model.ReplacementRule) []replacer.Rule {
+	res := make([]replacer.Rule, 0, len(rules))
+	for _, r := range rules {
+		res = append(res, replacer.Rule{
+			Key:  toString(r.ReplaceWith),
+			Path: toString(r.Path),
+			Selector: replacer.Selector{
+				Kind: toString(r.Selector.Kind),
+				Name: toString(r.Selector.Name),
+			},
+		})
+	}
+	return res
+}
+
+func toString(str *string) string {
+	if str == nil {
+		return ""
+	}
+	return *str
+}
+
 func checkForChanges(files []repoaccess.RepositoryFile, files2 []repoaccess.RepositoryFile) bool {
 	if len(files) != len(files2) {
 		return true
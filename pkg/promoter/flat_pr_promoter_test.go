@@ -1,10 +1,205 @@
 package promoter
 
 import (
+	"errors"
+	"keptn/git-promotion-service/pkg/model"
+	"keptn/git-promotion-service/pkg/replacer"
 	"keptn/git-promotion-service/pkg/repoaccess"
+	"reflect"
 	"testing"
 )
 
+// fakeRepository is a repository with the files by branch. Changes of the repository fail the test unless
+// pullRequests is set, which allows to open and edit pull requests and to add labels (failing with labelsErr)
+type fakeRepository struct {
+	t            *testing.T
+	branches     map[string]bool
+	files        map[string][]repoaccess.RepositoryFile
+	newCommits   bool
+	changed      []repoaccess.ChangedFile
+	pullRequest  *repoaccess.PullRequest
+	pullRequests bool
+	labelsErr    error
+}
+
+func (r *fakeRepository) BranchExists(branchName string) (bool, error) {
+	return r.branches[branchName], nil
+}
+
+func (r *fakeRepository) CreateBranch(_, _ string) error {
+	r.t.Errorf("CreateBranch() called")
+	return errors.New("unexpected")
+}
+
+func (r *fakeRepository) DeleteBranch(_ string) error {
+	r.t.Errorf("DeleteBranch() called")
+	return errors.New("unexpected")
+}
+
+func (r *fakeRepository) GetFilesForBranch(branch, path string) (files []repoaccess.RepositoryFile, err error) {
+	for _, f := range r.files[branch] {
+		if f.Path == path || len(f.Path) > len(path) && f.Path[:len(path)+1] == path+"/" {
+			files = append(files, f)
+		}
+	}
+	return files, nil
+}
+
+func (r *fakeRepository) SyncFilesWithBranch(_, _ string, _, _ []repoaccess.RepositoryFile) (int, error) {
+	r.t.Errorf("SyncFilesWithBranch() called")
+	return 0, errors.New("unexpected")
+}
+
+func (r *fakeRepository) CreatePullRequest(_, _, title, _ string) (*repoaccess.PullRequest, error) {
+	if r.pullRequests {
+		return &repoaccess.PullRequest{Number: 1, Title: title, URL: "pr/1"}, nil
+	}
+	r.t.Errorf("CreatePullRequest() called")
+	return nil, errors.New("unexpected")
+}
+
+func (r *fakeRepository) AddLabels(_ *repoaccess.PullRequest, _ []string) error {
+	if r.pullRequests {
+		return r.labelsErr
+	}
+	r.t.Errorf("AddLabels() called")
+	return errors.New("unexpected")
+}
+
+func (r *fakeRepository) CheckForNewCommits(_, _ string) (bool, error) {
+	return r.newCommits, nil
+}
+
+func (r *fakeRepository) CompareBranches(_, _ string) ([]repoaccess.ChangedFile, error) {
+	return r.changed, nil
+}
+
+func (r *fakeRepository) GetOpenPullRequest(_, _ string) (*repoaccess.PullRequest, error) {
+	return r.pullRequest, nil
+}
+
+func (r *fakeRepository) EditPullRequest(_ *repoaccess.PullRequest, _, _ string) error {
+	if r.pullRequests {
+		return nil
+	}
+	r.t.Errorf("EditPullRequest() called")
+	return errors.New("unexpected")
+}
+
+func TestFlatPrPromoter_DryRun(t *testing.T) {
+	source, target, mode := "dev", "prod", model.PathModeReplace
+	paths := []model.Path{{Source: &source, Target: &target, Mode: &mode}}
+	tests := []struct {
+		name      string
+		branches  map[string]bool
+		verifyErr error
+		wantFiles []string
+		wantErr   bool
+	}{
+		{name: "changes", wantFiles: []string{"prod/values.yaml"}},
+		{name: "existing branch", branches: map[string]bool{"promote": true}, wantErr: true},
+		{name: "verification failed", verifyErr: errors.New("image not found"), wantFiles: []string{"prod/values.yaml"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repository := &fakeRepository{t: t, branches: tt.branches, files: map[string][]repoaccess.RepositoryFile{"main": {
+				{Path: "dev/values.yaml", Content: "image: 1.1\n"},
+				{Path: "dev/unchanged.yaml", Content: "replicas: 1\n"},
+				{Path: "prod/unchanged.yaml", Content: "replicas: 1\n"},
+			}}}
+			p := NewFlatPrPromoter(repository)
+			var verified []string
+			p.Verify = func(files []FileChange) error {
+				for _, f := range files {
+					verified = append(verified, f.Path)
+				}
+				return tt.verifyErr
+			}
+			result, _, err := p.DryRun(map[string]string{}, "main", "promote", paths, model.Replacement{})
+			if (err != nil) != tt.wantErr || tt.verifyErr != nil && !errors.Is(err, ErrVerification) {
+				t.Fatalf("DryRun() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(result.Files) != len(tt.wantFiles) || len(tt.wantFiles) > 0 && result.Files[0] != tt.wantFiles[0] {
+				t.Errorf("DryRun() files = %v, want %v", result.Files, tt.wantFiles)
+			}
+			if len(tt.branches) == 0 && (len(verified) != 1 || verified[0] != "prod/values.yaml") {
+				t.Errorf("DryRun() verified %v, want only the changed file", verified)
+			}
+		})
+	}
+}
+
+func TestFlatPrPromoter_Plan_unmatchedSelectors(t *testing.T) {
+	target := "prod"
+	repository := &fakeRepository{t: t, files: map[string][]repoaccess.RepositoryFile{"main": {
+		{Path: "prod/deployment.yaml", Content: "kind: Deployment\nmetadata:\n  name: frontend\nimage: 1.0 # {\"keptn.git-promotion.replacewith\":\"data.image\",\"name\":\"backend\"}\n"},
+	}}}
+	p := NewFlatPrPromoter(repository)
+	var findings []model.Finding
+	p.ReportFinding = func(finding model.Finding) {
+		findings = append(findings, finding)
+	}
+	path, image, frontend, backend := "image", "data.image", "frontend", "backend"
+	replacement := model.Replacement{Rules: []model.ReplacementRule{
+		{Path: &path, ReplaceWith: &image, Selector: model.Selector{Name: &frontend}},
+		{Path: &path, ReplaceWith: &image, Selector: model.Selector{Name: &backend}},
+	}}
+	if _, _, err := p.Plan(map[string]string{"data.image": "1.1"}, "main", []model.Path{{Target: &target}}, replacement); err != nil {
+		t.Fatalf("Plan() error = %v", err)
+	}
+	want := []model.Finding{
+		model.NewWarning(model.FindingUnmatchedSelector, "spec.replacement.rules[1].selector", `selector (kind "", name "backend") matches no document`),
+		model.NewWarning(model.FindingUnmatchedSelector, "", "selector of annotation prod/deployment.yaml:4 (data.image) does not match its document"),
+	}
+	if !reflect.DeepEqual(findings, want) {
+		t.Errorf("Plan() findings = %v, want %v", findings, want)
+	}
+}
+
+func TestFlatPrPromoter_Plan_guardedTemplates(t *testing.T) {
+	source, target, mode, key := "dev", "prod", model.PathModeTemplate, "data.image.tag"
+	tests := []struct {
+		name        string
+		policy      string
+		onViolation string
+		tag         string
+		wantContent string
+		wantBlocked int
+		wantErr     bool
+	}{
+		{name: "increase", policy: replacer.PolicySemverIncreaseOnly, onViolation: model.ViolationFail, tag: "1.3.0", wantContent: "tag: 1.3.0\n"},
+		{name: "downgrade fails", policy: replacer.PolicySemverIncreaseOnly, onViolation: model.ViolationFail, tag: "1.0.0", wantErr: true},
+		{name: "downgrade keeps current value", policy: replacer.PolicySemverIncreaseOnly, onViolation: model.ViolationWarn, tag: "1.0.0", wantContent: "tag: 1.2.0\n", wantBlocked: 1},
+		{name: "range leaves new file untouched", policy: "~1.2", onViolation: model.ViolationWarn, tag: "2.0.0", wantContent: "tag: 1.2.0\n", wantBlocked: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files := []repoaccess.RepositoryFile{
+				{Path: "dev/values.yaml.tmpl", Content: "tag: {{ .data.image.tag }}\n"},
+				{Path: "prod/values.yaml", Content: "tag: 1.2.0\n"},
+			}
+			if tt.wantBlocked == 2 {
+				files = append(files, repoaccess.RepositoryFile{Path: "dev/new.yaml.tmpl", Content: "tag: {{ .data.image.tag }}\n"})
+			}
+			repository := &fakeRepository{t: t, files: map[string][]repoaccess.RepositoryFile{"main": files}}
+			replacement := model.Replacement{Constraints: []model.Constraint{{Key: &key, Policy: &tt.policy}}, OnViolation: &tt.onViolation}
+			got, report, err := NewFlatPrPromoter(repository).Plan(map[string]string{key: tt.tag}, "main", []model.Path{{Source: &source, Target: &target, Mode: &mode}}, replacement)
+			if (err != nil) != tt.wantErr || tt.wantErr && !errors.Is(err, ErrBlockedUpdates) {
+				t.Fatalf("Plan() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if len(got) != 1 || got[0].Path != "prod/values.yaml" || got[0].New == nil || *got[0].New != tt.wantContent {
+				t.Errorf("Plan() files = %v, want only prod/values.yaml with %q", got, tt.wantContent)
+			}
+			if len(report.Blocked) != tt.wantBlocked {
+				t.Errorf("Plan() blocked = %v, want %d", report.Blocked, tt.wantBlocked)
+			}
+		})
+	}
+}
+
 func Test_checkForChanges(t *testing.T) {
 	type args struct {
 		files  []repoaccess.RepositoryFile
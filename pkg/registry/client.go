@@ -0,0 +1,223 @@
+package registry
+
+import (
+	"encoding/json"
+	"fmt"
+	logger "github.com/sirupsen/logrus"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+var manifestMediaTypes = []string{
+	"application/vnd.oci.image.index.v1+json",
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+}
+
+var challengeParamRegexp = regexp.MustCompile(`(\w+)="([^"]*)"`)
+
+// Client accesses registries implementing the OCI distribution API
+type Client struct {
+	httpClient  *http.Client
+	credentials Credentials
+	// Insecure uses http instead of https
+	Insecure bool
+}
+
+// ResponseError is returned if the registry answers with an unexpected status code
+type ResponseError struct {
+	Reference  string
+	StatusCode int
+	Status     string
+	Body       string
+}
+
+func (e *ResponseError) Error() string {
+	if e.Body == "" {
+		return fmt.Sprintf("registry responded with %s for %s", e.Status, e.Reference)
+	}
+	return fmt.Sprintf("registry responded with %s for %s: %s", e.Status, e.Reference, e.Body)
+}
+
+// NewClient returns a new Client using the credentials for authentication. Without httpClient http.DefaultClient is used
+func NewClient(httpClient *http.Client, credentials Credentials) *Client {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &Client{httpClient: httpClient, credentials: credentials}
+}
+
+// ResolveDigest returns the manifest digest of the image reference. References already containing a digest are not resolved
+func (c *Client) ResolveDigest(raw string) (digest string, err error) {
+	ref, err := ParseReference(raw)
+	if err != nil {
+		return "", err
+	}
+	if ref.Digest != "" {
+		return ref.Digest, nil
+	}
+	resp, err := c.headManifest(ref)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", newResponseError(ref, resp)
+	}
+	resp.Body.Close()
+	digest = resp.Header.Get("Docker-Content-Digest")
+	if digest == "" {
+		return "", fmt.Errorf("registry returned no digest for %s", ref.String())
+	}
+	logger.WithField("func", "ResolveDigest").Infof("resolved %s to digest %s", ref.String(), digest)
+	return digest, nil
+}
+
+func (c *Client) headManifest(ref Reference) (*http.Response, error) {
+	version := ref.Tag
+	if ref.Digest != "" {
+		version = ref.Digest
+	}
+	u := fmt.Sprintf("%s://%s/v2/%s/manifests/%s", c.scheme(), ref.Host(), ref.Repository, version)
+	resp, err := c.do(http.MethodHead, u, "")
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusUnauthorized {
+		return resp, nil
+	}
+	resp.Body.Close()
+	authorization, err := c.authorize(ref, resp.Header.Get("WWW-Authenticate"))
+	if err != nil {
+		return nil, err
+	}
+	return c.do(http.MethodHead, u, authorization)
+}
+
+func (c *Client) do(method, u, authorization string) (*http.Response, error) {
+	req, err := http.NewRequest(method, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", strings.Join(manifestMediaTypes, ", "))
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// authorize answers the authentication challenge of the registry and returns the authorization header
+func (c *Client) authorize(ref Reference, challenge string) (string, error) {
+	credentials := c.credentials.For(ref.Registry)
+	scheme := strings.ToLower(strings.SplitN(challenge, " ", 2)[0])
+	if scheme == "basic" {
+		if credentials == nil {
+			return "", fmt.Errorf("registry %s requires credentials", ref.Registry)
+		}
+		return "Basic " + credentials.basicAuth(), nil
+	} else if scheme != "bearer" {
+		return "", fmt.Errorf("unsupported authentication challenge %q of registry %s", challenge, ref.Registry)
+	}
+	params := make(map[string]string)
+	for _, m := range challengeParamRegexp.FindAllStringSubmatch(challenge, -1) {
+		params[m[1]] = m[2]
+	}
+	realm, err := url.Parse(params["realm"])
+	if err != nil || params["realm"] == "" {
+		return "", fmt.Errorf("invalid authentication realm %q of registry %s", params["realm"], ref.Registry)
+	}
+	query := realm.Query()
+	if params["service"] != "" {
+		query.Set("service", params["service"])
+	}
+	query.Set("scope", fmt.Sprintf("repository:%s:pull", ref.Repository))
+	realm.RawQuery = query.Encode()
+	req, err := http.NewRequest(http.MethodGet, realm.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	if credentials != nil {
+		req.Header.Set("Authorization", "Basic "+credentials.basicAuth())
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", newResponseError(ref, resp)
+	}
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", fmt.Errorf("could not decode token of registry %s: %w", ref.Registry, err)
+	}
+	if token.Token == "" {
+		token.Token = token.AccessToken
+	}
+	return "Bearer " + token.Token, nil
+}
+
+func (c *Client) scheme() string {
+	if c.Insecure {
+		return "http"
+	}
+	return "https"
+}
+
+func newResponseError(ref Reference, resp *http.Response) *ResponseError {
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return &ResponseError{
+		Reference:  ref.String(),
+		StatusCode: resp.StatusCode,
+		Status:     resp.Status,
+		Body:       strings.TrimSpace(string(body)),
+	}
+}
+
+// ImageExists checks that the manifest of the image reference exists in the registry
+func (c *Client) ImageExists(raw string) error {
+	ref, err := ParseReference(raw)
+	if err != nil {
+		return err
+	}
+	resp, err := c.headManifest(ref)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return newResponseError(ref, resp)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// VerifyImages checks that all image references exist. The returned error lists every missing image with the response of the registry
+func (c *Client) VerifyImages(images []string) error {
+	var missing []string
+	checked := make(map[string]bool)
+	for _, image := range images {
+		if checked[image] {
+			continue
+		}
+		checked[image] = true
+		if err := c.ImageExists(image); err != nil {
+			logger.WithField("func", "VerifyImages").WithError(err).Errorf("image %s could not be verified", image)
+			missing = append(missing, fmt.Sprintf("%s (%s)", image, err.Error()))
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("%d of %d images not found: %s", len(missing), len(checked), strings.Join(missing, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,181 @@
+package registry
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const testDigest = "sha256:4a5573037f358b6cdfa2f3e8a9c33a5cf11bcd1675ca3ca4ee5e7bd4ee3ef1f6"
+
+// newTestRegistry returns a registry stand-in with token authentication serving the manifest of test/app:1.2.3
+func newTestRegistry(t *testing.T, username, password string) *httptest.Server {
+	var server *httptest.Server
+	server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/token":
+			if r.Header.Get("Authorization") != "Basic "+base64.StdEncoding.EncodeToString([]byte(username+":"+password)) {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			if r.URL.Query().Get("scope") != "repository:test/app:pull" {
+				t.Errorf("unexpected scope %s", r.URL.Query().Get("scope"))
+			}
+			fmt.Fprint(w, `{"token":"testtoken"}`)
+		case r.Header.Get("Authorization") != "Bearer testtoken":
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="test-registry"`, server.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+		case r.Method == http.MethodHead && r.URL.Path == "/v2/test/app/manifests/1.2.3":
+			if !strings.Contains(r.Header.Get("Accept"), "application/vnd.oci.image.index.v1+json") {
+				t.Errorf("unexpected accept header %s", r.Header.Get("Accept"))
+			}
+			w.Header().Set("Docker-Content-Digest", testDigest)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	return server
+}
+
+func TestClient_ResolveDigest(t *testing.T) {
+	server := newTestRegistry(t, "user", "secret")
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "https://")
+
+	tests := []struct {
+		name        string
+		credentials Credentials
+		reference   string
+		wantDigest  string
+		wantStatus  int
+		wantErr     bool
+	}{
+		{
+			name:        "resolve with credentials",
+			credentials: Credentials{host: {Username: "user", Password: "secret"}},
+			reference:   host + "/test/app:1.2.3",
+			wantDigest:  testDigest,
+		},
+		{
+			name:       "reference with digest",
+			reference:  host + "/test/app:1.2.3@sha256:1234",
+			wantDigest: "sha256:1234",
+		},
+		{
+			name:        "unknown tag",
+			credentials: Credentials{"": {Username: "user", Password: "secret"}},
+			reference:   host + "/test/app:9.9.9",
+			wantStatus:  http.StatusNotFound,
+			wantErr:     true,
+		},
+		{
+			name:       "missing credentials",
+			reference:  host + "/test/app:1.2.3",
+			wantStatus: http.StatusUnauthorized,
+			wantErr:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewClient(server.Client(), tt.credentials)
+			gotDigest, err := c.ResolveDigest(tt.reference)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ResolveDigest() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			var responseError *ResponseError
+			if tt.wantStatus != 0 && (!errors.As(err, &responseError) || responseError.StatusCode != tt.wantStatus) {
+				t.Errorf("ResolveDigest() error = %v, want status %d", err, tt.wantStatus)
+			}
+			if gotDigest != tt.wantDigest {
+				t.Errorf("ResolveDigest() = %v, want %v", gotDigest, tt.wantDigest)
+			}
+		})
+	}
+}
+
+func TestClient_ResolveDigests(t *testing.T) {
+	server := newTestRegistry(t, "user", "secret")
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "https://")
+
+	c := NewClient(server.Client(), Credentials{"": {Username: "user", Password: "secret"}})
+	fields := map[string]string{
+		"data.image": host + "/test/app:1.2.3",
+	}
+	if err := c.ResolveDigests(fields, []Digest{{Key: "data.image", Replace: true}}); err != nil {
+		t.Fatalf("ResolveDigests() error = %v", err)
+	}
+	pinned := host + "/test/app:1.2.3@" + testDigest
+	if fields["data.image"] != pinned || fields["data.image@pinned"] != pinned || fields["data.image@digest"] != testDigest {
+		t.Errorf("ResolveDigests() = %v", fields)
+	}
+}
+
+func TestClient_VerifyImages(t *testing.T) {
+	server := newTestRegistry(t, "user", "secret")
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "https://")
+
+	c := NewClient(server.Client(), Credentials{"": {Username: "user", Password: "secret"}})
+	if err := c.VerifyImages([]string{host + "/test/app:1.2.3", host + "/test/app:1.2.3"}); err != nil {
+		t.Errorf("VerifyImages() error = %v", err)
+	}
+	err := c.VerifyImages([]string{host + "/test/app:1.2.3", host + "/test/app:9.9.9"})
+	if err == nil || !strings.Contains(err.Error(), host+"/test/app:9.9.9 (registry responded with 404 Not Found") {
+		t.Errorf("VerifyImages() error = %v", err)
+	}
+	if strings.Contains(err.Error(), "1.2.3") {
+		t.Errorf("VerifyImages() error = %v, should not contain existing image", err)
+	}
+}
+
+func TestParseReference(t *testing.T) {
+	tests := []struct {
+		raw     string
+		want    Reference
+		wantErr bool
+	}{
+		{raw: "nginx", want: Reference{Registry: "docker.io", Repository: "library/nginx", Tag: "latest"}},
+		{raw: "test/app:1.0", want: Reference{Registry: "docker.io", Repository: "test/app", Tag: "1.0"}},
+		{raw: "localhost:5000/app", want: Reference{Registry: "localhost:5000", Repository: "app", Tag: "latest"}},
+		{raw: "ghcr.io/org/team/app:1.2.3@sha256:abc", want: Reference{Registry: "ghcr.io", Repository: "org/team/app", Tag: "1.2.3", Digest: "sha256:abc"}},
+		{raw: "", wantErr: true},
+		{raw: "ghcr.io/app@abc", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			got, err := ParseReference(tt.raw)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseReference() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("ParseReference() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCredentialsFromSecret(t *testing.T) {
+	auth := base64.StdEncoding.EncodeToString([]byte("user:secret"))
+	credentials, err := CredentialsFromSecret(map[string][]byte{
+		".dockerconfigjson": []byte(`{"auths":{"https://ghcr.io":{"auth":"` + auth + `"},"index.docker.io":{"username":"hub","password":"pw"}}}`),
+	})
+	if err != nil {
+		t.Fatalf("CredentialsFromSecret() error = %v", err)
+	}
+	if c := credentials.For("ghcr.io"); c == nil || *c != (Credential{Username: "user", Password: "secret"}) {
+		t.Errorf("For(ghcr.io) = %v", c)
+	}
+	if c := credentials.For("docker.io"); c == nil || *c != (Credential{Username: "hub", Password: "pw"}) {
+		t.Errorf("For(docker.io) = %v", c)
+	}
+	if c := credentials.For("quay.io"); c != nil {
+		t.Errorf("For(quay.io) = %v, want nil", c)
+	}
+}
@@ -0,0 +1,86 @@
+package registry
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+const dockerConfigJSONKey = ".dockerconfigjson"
+const usernameKey = "username"
+const passwordKey = "password"
+
+// Credential is a username and password for a registry
+type Credential struct {
+	Username string
+	Password string
+}
+
+// Credentials maps registry hosts to credentials. The entry with an empty host is used for all registries
+type Credentials map[string]Credential
+
+type dockerConfig struct {
+	Auths map[string]struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+		Auth     string `json:"auth"`
+	} `json:"auths"`
+}
+
+// CredentialsFromSecret reads the credentials of a kubernetes secret. Secrets of type kubernetes.io/dockerconfigjson
+// (key .dockerconfigjson) and secrets with the keys username and password (used for all registries) are supported
+func CredentialsFromSecret(data map[string][]byte) (Credentials, error) {
+	credentials := make(Credentials)
+	if content, ok := data[dockerConfigJSONKey]; ok {
+		var config dockerConfig
+		if err := json.Unmarshal(content, &config); err != nil {
+			return nil, fmt.Errorf("could not parse %s: %w", dockerConfigJSONKey, err)
+		}
+		for host, auth := range config.Auths {
+			credential := Credential{Username: auth.Username, Password: auth.Password}
+			if auth.Auth != "" {
+				decoded, err := base64.StdEncoding.DecodeString(auth.Auth)
+				if err != nil {
+					return nil, fmt.Errorf("could not decode auth of registry %s: %w", host, err)
+				}
+				parts := strings.SplitN(string(decoded), ":", 2)
+				if len(parts) != 2 {
+					return nil, fmt.Errorf("invalid auth of registry %s", host)
+				}
+				credential = Credential{Username: parts[0], Password: parts[1]}
+			}
+			credentials[normalizeHost(host)] = credential
+		}
+		return credentials, nil
+	}
+	if username, ok := data[usernameKey]; ok {
+		credentials[""] = Credential{Username: string(username), Password: string(data[passwordKey])}
+		return credentials, nil
+	}
+	return nil, fmt.Errorf("secret contains neither %s nor %s", dockerConfigJSONKey, usernameKey)
+}
+
+// For returns the credential for the registry or nil if there is none
+func (c Credentials) For(registry string) *Credential {
+	for _, host := range []string{normalizeHost(registry), ""} {
+		if credential, ok := c[host]; ok {
+			return &credential
+		}
+	}
+	if registry == defaultRegistry {
+		if credential, ok := c["index.docker.io"]; ok {
+			return &credential
+		}
+	}
+	return nil
+}
+
+func (c Credential) basicAuth() string {
+	return base64.StdEncoding.EncodeToString([]byte(c.Username + ":" + c.Password))
+}
+
+func normalizeHost(host string) string {
+	host = strings.TrimPrefix(strings.TrimPrefix(host, "https://"), "http://")
+	return strings.SplitN(host, "/", 2)[0]
+}
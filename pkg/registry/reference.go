@@ -0,0 +1,76 @@
+package registry
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const defaultRegistry = "docker.io"
+const defaultRegistryHost = "registry-1.docker.io"
+const defaultTag = "latest"
+
+// Reference is a parsed image reference like ghcr.io/test/app:1.2.3@sha256:...
+type Reference struct {
+	Registry   string
+	Repository string
+	Tag        string
+	Digest     string
+}
+
+// ParseReference parses an image reference. Without a registry docker.io is used, without a tag and digest "latest"
+func ParseReference(raw string) (ref Reference, err error) {
+	name := strings.TrimSpace(raw)
+	if name == "" {
+		return ref, errors.New("empty image reference")
+	}
+	if i := strings.Index(name, "@"); i >= 0 {
+		ref.Digest = name[i+1:]
+		name = name[:i]
+		if !strings.Contains(ref.Digest, ":") {
+			return ref, fmt.Errorf("invalid digest in image reference %s", raw)
+		}
+	}
+	if i := strings.LastIndex(name, ":"); i >= 0 && i > strings.LastIndex(name, "/") {
+		ref.Tag = name[i+1:]
+		name = name[:i]
+	}
+	if ref.Tag == "" && ref.Digest == "" {
+		ref.Tag = defaultTag
+	}
+	parts := strings.SplitN(name, "/", 2)
+	if len(parts) == 2 && (strings.ContainsAny(parts[0], ".:") || parts[0] == "localhost") {
+		ref.Registry = parts[0]
+		ref.Repository = parts[1]
+	} else {
+		ref.Registry = defaultRegistry
+		ref.Repository = name
+	}
+	if ref.Registry == defaultRegistry && !strings.Contains(ref.Repository, "/") {
+		ref.Repository = "library/" + ref.Repository
+	}
+	if ref.Repository == "" || strings.HasSuffix(ref.Repository, "/") {
+		return ref, fmt.Errorf("invalid image reference %s", raw)
+	}
+	return ref, nil
+}
+
+// Host returns the host name of the registry api
+func (r Reference) Host() string {
+	if r.Registry == defaultRegistry {
+		return defaultRegistryHost
+	}
+	return r.Registry
+}
+
+// String formats the reference as registry/repository[:tag][@digest]
+func (r Reference) String() string {
+	s := r.Registry + "/" + r.Repository
+	if r.Tag != "" {
+		s += ":" + r.Tag
+	}
+	if r.Digest != "" {
+		s += "@" + r.Digest
+	}
+	return s
+}
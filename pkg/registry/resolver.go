@@ -0,0 +1,45 @@
+package registry
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DigestKeySuffix is appended to the key of an image reference for the key of the resolved digest (e.g. data.image@digest)
+const DigestKeySuffix = "@digest"
+
+// PinnedKeySuffix is appended to the key of an image reference for the key of the reference pinned to the
+// resolved digest (e.g. data.image@pinned => ghcr.io/test/app:1.2.3@sha256:...)
+const PinnedKeySuffix = "@pinned"
+
+// Digest references a value containing an image reference that is resolved to its digest. With Replace the value
+// itself is replaced with the pinned reference
+type Digest struct {
+	Key     string
+	Replace bool
+}
+
+// ResolveDigests resolves the image references of the values and adds the digest and pinned reference to the values
+func (c *Client) ResolveDigests(fields map[string]string, digests []Digest) error {
+	for _, d := range digests {
+		value, ok := fields[d.Key]
+		if !ok {
+			return fmt.Errorf("value %s not found", d.Key)
+		}
+		digest, err := c.ResolveDigest(value)
+		if err != nil {
+			return fmt.Errorf("could not resolve digest of %s (%s): %w", d.Key, value, err)
+		}
+		pinned := value
+		if i := strings.Index(pinned, "@"); i >= 0 {
+			pinned = pinned[:i]
+		}
+		pinned += "@" + digest
+		fields[d.Key+DigestKeySuffix] = digest
+		fields[d.Key+PinnedKeySuffix] = pinned
+		if d.Replace {
+			fields[d.Key] = pinned
+		}
+	}
+	return nil
+}
@@ -0,0 +1,247 @@
+package replacer
+
+import (
+	logger "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var documentSeparatorRegexp = regexp.MustCompile(`^---(\s.*)?$`)
+var pathSegmentRegexp = regexp.MustCompile(`^([^\[\]]*)((?:\[\d+\])*)$`)
+var pathIndexRegexp = regexp.MustCompile(`\[(\d+)\]`)
+
+// Selector restricts a Rule to kubernetes documents with the given kind and metadata.name. Empty fields match all documents
+type Selector struct {
+	Kind string
+	Name string
+}
+
+// Rule replaces the value at Path (e.g. spec.template.spec.containers[0].image) with the value of Key
+// in all yaml documents matching the Selector
+type Rule struct {
+	Key      string
+	Path     string
+	Selector Selector
+}
+
+// Document is a single yaml document of a (multi document) file
+type Document struct {
+	// FirstLine is the index of the first line of the document in the file (starting with 0)
+	FirstLine int
+	Content   string
+	Kind      string
+	Name      string
+	node      *yaml.Node
+}
+
+// SplitDocuments splits content into the yaml documents separated by "---" lines. Kind and name are
+// only set if the document could be parsed
+func SplitDocuments(content string) (documents []Document) {
+	lines := strings.Split(content, "\n")
+	start := 0
+	for i := 0; i <= len(lines); i++ {
+		if i == len(lines) || documentSeparatorRegexp.MatchString(lines[i]) {
+			documents = append(documents, newDocument(start, strings.Join(lines[start:i], "\n")))
+			start = i + 1
+		}
+	}
+	return documents
+}
+
+func newDocument(firstLine int, content string) Document {
+	document := Document{FirstLine: firstLine, Content: content}
+	var node yaml.Node
+	if err := yaml.Unmarshal([]byte(content), &node); err != nil || len(node.Content) == 0 {
+		return document
+	}
+	document.node = node.Content[0]
+	if kind := lookup(document.node, "kind"); kind != nil {
+		document.Kind = kind.Value
+	}
+	if name := lookup(lookup(document.node, "metadata"), "name"); name != nil {
+		document.Name = name.Value
+	}
+	return document
+}
+
+// Matches returns true if the document matches the selector
+func (d Document) Matches(selector Selector) bool {
+	return (selector.Kind == "" || selector.Kind == d.Kind) && (selector.Name == "" || selector.Name == d.Name)
+}
+
+// documentOfLine returns the document containing the line (starting with 0)
+func documentOfLine(documents []Document, line int) Document {
+	document := documents[0]
+	for _, d := range documents {
+		if d.FirstLine > line {
+			break
+		}
+		document = d
+	}
+	return document
+}
+
+// SelectsDocument returns true if the file is a yaml file with at least one document matching the selector
+func SelectsDocument(file, content string, selector Selector) bool {
+	if path.Ext(file) != ".yaml" && path.Ext(file) != ".yml" {
+		return false
+	}
+	for _, d := range SplitDocuments(content) {
+		if d.node != nil && d.Matches(selector) {
+			return true
+		}
+	}
+	return false
+}
+
+// ApplyRules applies the rules to all documents of a yaml file. Files without a yaml extension are returned unchanged.
+// If a guard is given, every value is checked before it is written
+func ApplyRules(file, content string, rules []Rule, tags map[string]string, guard Guard) (result string, report Report) {
+	if len(rules) == 0 || (path.Ext(file) != ".yaml" && path.Ext(file) != ".yml") {
+		return content, report
+	}
+	lines := strings.Split(content, "\n")
+	replacements := 0
+	for _, d := range SplitDocuments(content) {
+		if d.node == nil {
+			continue
+		}
+		for _, r := range rules {
+			if !d.Matches(r.Selector) {
+				continue
+			}
+			node := lookupPath(d.node, r.Path)
+			if node == nil {
+				if r.Selector != (Selector{}) {
+					report.Unmatched = append(report.Unmatched, Annotation{File: file, Line: d.FirstLine + 1, Key: r.Key})
+				}
+				continue
+			}
+			annotation := Annotation{File: file, Line: d.FirstLine + node.Line, Key: r.Key}
+			report.Annotations = append(report.Annotations, annotation)
+			if value, ok := tags[r.Key]; !ok {
+				report.Unresolved = append(report.Unresolved, annotation)
+			} else if value, ok = checkGuard(guard, &annotation, value, &report); !ok {
+				continue
+			} else if replaced, ok := replaceScalar(lines[annotation.Line-1], node, value); !ok {
+				report.Unmatched = append(report.Unmatched, annotation)
+			} else {
+				lines[annotation.Line-1] = replaced
+				replacements++
+			}
+		}
+	}
+	result = strings.Join(lines, "\n")
+	logger.WithField("func", "ApplyRules").Infof("applied %d rules to file %s with %d replacements", len(rules), file, replacements)
+	return result, report
+}
+
+// SetValue replaces the scalar value at path in the first yaml document of content. It returns false if the value
+// does not exist or could not be replaced
+func SetValue(content, path, value string) (result string, ok bool) {
+	documents := SplitDocuments(content)
+	if documents[0].node == nil {
+		return content, false
+	}
+	node := lookupPath(documents[0].node, path)
+	if node == nil {
+		return content, false
+	}
+	lines := strings.Split(content, "\n")
+	line := documents[0].FirstLine + node.Line - 1
+	if lines[line], ok = replaceScalar(lines[line], node, value); !ok {
+		return content, false
+	}
+	return strings.Join(lines, "\n"), true
+}
+
+// replaceScalar replaces the scalar value of node in line and keeps the quoting style and any trailing comment
+func replaceScalar(line string, node *yaml.Node, value string) (string, bool) {
+	// the column is counted in characters, not bytes
+	start := -1
+	column := 0
+	for i := range line {
+		column++
+		if column == node.Column {
+			start = i
+			break
+		}
+	}
+	if node.Kind != yaml.ScalarNode || start < 0 {
+		return line, false
+	}
+	rest := line[start:]
+	var length int
+	switch node.Style {
+	case yaml.DoubleQuotedStyle:
+		length = closingQuote(rest, '"')
+		value = strconv.Quote(value)
+	case yaml.SingleQuotedStyle:
+		length = closingQuote(rest, '\'')
+		value = "'" + strings.Replace(value, "'", "''", -1) + "'"
+	case 0:
+		if !strings.HasPrefix(rest, node.Value) {
+			return line, false
+		}
+		length = len(node.Value)
+	default:
+		return line, false
+	}
+	if length <= 0 {
+		return line, false
+	}
+	return line[:start] + value + rest[length:], true
+}
+
+func closingQuote(s string, quote byte) int {
+	for i := 1; i < len(s); i++ {
+		if s[i] == '\\' && quote == '"' {
+			i++
+		} else if s[i] == quote {
+			if quote == '\'' && i+1 < len(s) && s[i+1] == '\'' {
+				i++
+				continue
+			}
+			return i + 1
+		}
+	}
+	return -1
+}
+
+func lookupPath(node *yaml.Node, p string) *yaml.Node {
+	for _, segment := range strings.Split(p, ".") {
+		matches := pathSegmentRegexp.FindStringSubmatch(segment)
+		if matches == nil {
+			return nil
+		}
+		if matches[1] != "" {
+			node = lookup(node, matches[1])
+		}
+		for _, index := range pathIndexRegexp.FindAllStringSubmatch(matches[2], -1) {
+			i, _ := strconv.Atoi(index[1])
+			if node == nil || node.Kind != yaml.SequenceNode || i >= len(node.Content) {
+				return nil
+			}
+			node = node.Content[i]
+		}
+		if node == nil {
+			return nil
+		}
+	}
+	return node
+}
+
+func lookup(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+package replacer
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const multiDocument = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: frontend
+spec:
+  template:
+    spec:
+      containers:
+        - name: frontend
+          image: "ghcr.io/test/frontend:1.0" # pinned
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: backend
+spec:
+  template:
+    spec:
+      containers:
+        - name: backend
+          image: ghcr.io/test/backend:1.0
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: frontend
+`
+
+func TestSplitDocuments(t *testing.T) {
+	documents := SplitDocuments(multiDocument)
+	if len(documents) != 3 {
+		t.Fatalf("SplitDocuments() returned %d documents, want 3", len(documents))
+	}
+	got := make([][]interface{}, len(documents))
+	for i, d := range documents {
+		got[i] = []interface{}{d.FirstLine, d.Kind, d.Name}
+	}
+	want := [][]interface{}{{0, "Deployment", "frontend"}, {11, "Deployment", "backend"}, {22, "Service", "frontend"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("SplitDocuments() = %v, want %v", got, want)
+	}
+}
+
+func TestApplyRules(t *testing.T) {
+	tags := map[string]string{
+		"data.image": "ghcr.io/test/app:2.0",
+	}
+	type args struct {
+		file  string
+		rules []Rule
+	}
+	tests := []struct {
+		name           string
+		args           args
+		wantImages     []string
+		wantReport     Report
+		wantUnmodified bool
+	}{
+		{
+			name: "all deployments",
+			args: args{
+				file: "prod/deployments.yaml",
+				rules: []Rule{
+					{Key: "data.image", Path: "spec.template.spec.containers[0].image", Selector: Selector{Kind: "Deployment"}},
+				},
+			},
+			wantImages: []string{
+				`          image: "ghcr.io/test/app:2.0" # pinned`,
+				`          image: ghcr.io/test/app:2.0`,
+			},
+			wantReport: Report{
+				Annotations: []Annotation{
+					{File: "prod/deployments.yaml", Line: 10, Key: "data.image"},
+					{File: "prod/deployments.yaml", Line: 21, Key: "data.image"},
+				},
+			},
+		},
+		{
+			name: "named deployment",
+			args: args{
+				file: "prod/deployments.yaml",
+				rules: []Rule{
+					{Key: "data.image", Path: "spec.template.spec.containers[0].image", Selector: Selector{Kind: "Deployment", Name: "backend"}},
+				},
+			},
+			wantImages: []string{
+				`          image: "ghcr.io/test/frontend:1.0" # pinned`,
+				`          image: ghcr.io/test/app:2.0`,
+			},
+			wantReport: Report{
+				Annotations: []Annotation{{File: "prod/deployments.yaml", Line: 21, Key: "data.image"}},
+			},
+		},
+		{
+			name: "unresolved and unmatched",
+			args: args{
+				file: "prod/deployments.yaml",
+				rules: []Rule{
+					{Key: "data.tag", Path: "spec.template.spec.containers[0].image", Selector: Selector{Name: "backend"}},
+					{Key: "data.image", Path: "spec.ports[0].port", Selector: Selector{Kind: "Service"}},
+				},
+			},
+			wantReport: Report{
+				Annotations: []Annotation{{File: "prod/deployments.yaml", Line: 21, Key: "data.tag"}},
+				Unresolved:  []Annotation{{File: "prod/deployments.yaml", Line: 21, Key: "data.tag"}},
+				Unmatched:   []Annotation{{File: "prod/deployments.yaml", Line: 23, Key: "data.image"}},
+			},
+			wantUnmodified: true,
+		},
+		{
+			name: "no yaml file",
+			args: args{
+				file: "prod/README.md",
+				rules: []Rule{
+					{Key: "data.image", Path: "spec.template.spec.containers[0].image"},
+				},
+			},
+			wantUnmodified: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotResult, gotReport := ApplyRules(tt.args.file, multiDocument, tt.args.rules, tags, nil)
+			if !reflect.DeepEqual(gotReport, tt.wantReport) {
+				t.Errorf("ApplyRules() gotReport = %+v, want %+v", gotReport, tt.wantReport)
+			}
+			if tt.wantUnmodified {
+				if gotResult != multiDocument {
+					t.Errorf("ApplyRules() modified content: %v", gotResult)
+				}
+				return
+			}
+			lines := strings.Split(gotResult, "\n")
+			gotImages := []string{lines[9], lines[20]}
+			if !reflect.DeepEqual(gotImages, tt.wantImages) {
+				t.Errorf("ApplyRules() gotImages = %v, want %v", gotImages, tt.wantImages)
+			}
+		})
+	}
+}
@@ -1,38 +1,80 @@
 package replacer
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	cloudevents "github.com/cloudevents/sdk-go/v2"
-	"log"
-	"reflect"
+	"io"
+	"strconv"
 )
 
-func ConvertToMap(event cloudevents.Event) (res map[string]string) {
-	temp := make(map[string]interface{})
+// ConvertToMap flattens the data and the context attributes of the event. Nested objects are joined with "."
+// (data.labels.team) and array elements are indexed (data.images[0].tag). res contains the values formatted as
+// strings, values contains the typed values (string, int64, float64 or bool) of the same keys
+func ConvertToMap(event cloudevents.Event) (res map[string]string, values map[string]interface{}, err error) {
 	res = make(map[string]string)
-	if err := event.DataAs(&temp); err != nil {
-		log.Fatalf("marshall err %s", err)
+	values = make(map[string]interface{})
+	if data := event.Data(); len(bytes.TrimSpace(data)) > 0 {
+		var temp map[string]interface{}
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		if err := decoder.Decode(&temp); err != nil {
+			return nil, nil, fmt.Errorf("could not decode data of event %s: %w", event.ID(), err)
+		}
+		if _, err := decoder.Token(); err != io.EOF {
+			return nil, nil, fmt.Errorf("could not decode data of event %s: unexpected content after json object", event.ID())
+		}
+		addKeysToMap("data", res, values, temp)
+	}
+	addKeysToMap("", res, values, event.Extensions())
+	for k, v := range map[string]string{"id": event.ID(), "source": event.Source(), "specversion": event.SpecVersion()} {
+		res[k] = v
+		values[k] = v
+	}
+	return res, values, nil
+}
+
+// CopyFields returns a copy of the fields returned by ConvertToMap. The promoters add the resolved digests to the
+// fields, so every stage gets its own copy
+func CopyFields(fields map[string]string) map[string]string {
+	res := make(map[string]string, len(fields))
+	for k, v := range fields {
+		res[k] = v
 	}
-	addKeysToMap("data", &res, temp)
-	addKeysToMap("", &res, event.Extensions())
-	res["id"] = event.ID()
-	res["source"] = event.Source()
-	res["specversion"] = event.SpecVersion()
 	return res
 }
 
-func addKeysToMap(root string, m *map[string]string, temp map[string]interface{}) {
+func addKeysToMap(root string, res map[string]string, values map[string]interface{}, temp map[string]interface{}) {
 	for k, v := range temp {
 		key := k
 		if root != "" {
 			key = root + "." + k
 		}
-		if v != nil {
-			if reflect.TypeOf(v).Kind() != reflect.Map {
-				(*m)[key] = fmt.Sprintf("%v", v)
-			} else {
-				addKeysToMap(key, m, v.(map[string]interface{}))
-			}
+		addValue(key, res, values, v)
+	}
+}
+
+func addValue(key string, res map[string]string, values map[string]interface{}, v interface{}) {
+	switch t := v.(type) {
+	case nil:
+	case map[string]interface{}:
+		addKeysToMap(key, res, values, t)
+	case []interface{}:
+		for i, e := range t {
+			addValue(key+"["+strconv.Itoa(i)+"]", res, values, e)
+		}
+	case json.Number:
+		res[key] = t.String()
+		if i, err := t.Int64(); err == nil {
+			values[key] = i
+		} else if f, err := t.Float64(); err == nil {
+			values[key] = f
+		} else {
+			values[key] = t.String()
 		}
+	default:
+		res[key] = fmt.Sprintf("%v", v)
+		values[key] = v
 	}
 }
@@ -35,7 +35,7 @@ func TestConvertToMap(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if gotRes := ConvertToMap(tt.args.event); !reflect.DeepEqual(gotRes, tt.wantRes) {
+			if gotRes, _, err := ConvertToMap(tt.args.event); err != nil || !reflect.DeepEqual(gotRes, tt.wantRes) {
 				t.Errorf("ConvertToMap() = %v, want %v", gotRes, tt.wantRes)
 			}
 		})
@@ -77,7 +77,7 @@ func TestConvertToMap2(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if gotRes := ConvertToMap(tt.args.event); !reflect.DeepEqual(gotRes, tt.wantRes) {
+			if gotRes, _, err := ConvertToMap(tt.args.event); err != nil || !reflect.DeepEqual(gotRes, tt.wantRes) {
 				t.Errorf("ConvertToMap() = %v, want %v", gotRes, tt.wantRes)
 			}
 		})
@@ -125,7 +125,7 @@ func TestConvertToMapWithInt(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if gotRes := ConvertToMap(tt.args.event); !reflect.DeepEqual(gotRes, tt.wantRes) {
+			if gotRes, _, err := ConvertToMap(tt.args.event); err != nil || !reflect.DeepEqual(gotRes, tt.wantRes) {
 				t.Errorf("ConvertToMap() = %v, want %v", gotRes, tt.wantRes)
 			}
 		})
@@ -174,9 +174,68 @@ func TestConvertToMapWithNilEntry(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if gotRes := ConvertToMap(tt.args.event); !reflect.DeepEqual(gotRes, tt.wantRes) {
+			if gotRes, _, err := ConvertToMap(tt.args.event); err != nil || !reflect.DeepEqual(gotRes, tt.wantRes) {
 				t.Errorf("ConvertToMap() = %v, want %v", gotRes, tt.wantRes)
 			}
 		})
 	}
 }
+
+func TestConvertToMapWithArraysAndTypes(t *testing.T) {
+	evt := v2.NewEvent()
+	if err := evt.SetData(v2.ApplicationJSON, map[string]interface{}{
+		"images": []interface{}{
+			map[string]interface{}{"name": "app", "tag": "1.2.3"},
+			map[string]interface{}{"name": "sidecar", "tag": "0.1"},
+		},
+		"labels":   map[string]interface{}{"x": "y"},
+		"replicas": 1000000,
+		"ratio":    0.25,
+		"canary":   true,
+		"matrix":   []interface{}{[]interface{}{1, 2}},
+	}); err != nil {
+		t.Errorf("err: %s", err)
+	}
+	wantRes := map[string]string{
+		"data.images[0].name": "app",
+		"data.images[0].tag":  "1.2.3",
+		"data.images[1].name": "sidecar",
+		"data.images[1].tag":  "0.1",
+		"data.labels.x":       "y",
+		"data.replicas":       "1000000",
+		"data.ratio":          "0.25",
+		"data.canary":         "true",
+		"data.matrix[0][0]":   "1",
+		"data.matrix[0][1]":   "2",
+		"source":              "",
+		"specversion":         "1.0",
+		"id":                  "",
+	}
+	gotRes, gotValues, err := ConvertToMap(evt)
+	if err != nil {
+		t.Fatalf("ConvertToMap() error = %v", err)
+	}
+	if !reflect.DeepEqual(gotRes, wantRes) {
+		t.Errorf("ConvertToMap() = %v, want %v", gotRes, wantRes)
+	}
+	for k, want := range map[string]interface{}{
+		"data.replicas":      int64(1000000),
+		"data.ratio":         0.25,
+		"data.canary":        true,
+		"data.images[0].tag": "1.2.3",
+	} {
+		if gotValues[k] != want {
+			t.Errorf("ConvertToMap() value %s = %#v, want %#v", k, gotValues[k], want)
+		}
+	}
+}
+
+func TestConvertToMapWithInvalidData(t *testing.T) {
+	evt := v2.NewEvent()
+	if err := evt.SetData(v2.ApplicationJSON, []string{"no", "object"}); err != nil {
+		t.Errorf("err: %s", err)
+	}
+	if _, _, err := ConvertToMap(evt); err == nil {
+		t.Errorf("ConvertToMap() expected error for data that is no json object")
+	}
+}
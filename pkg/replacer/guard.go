@@ -0,0 +1,162 @@
+package replacer
+
+import (
+	"fmt"
+	"github.com/Masterminds/semver/v3"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// PolicySemverIncreaseOnly blocks updates to a lower semantic version than the current one.
+// All other policies are interpreted as semantic version range (e.g. ">=1.0.0 <2.0.0")
+const PolicySemverIncreaseOnly = "semver-increase-only"
+
+var annotatedValueRegexp = regexp.MustCompile(`^.+: (.*) # ` + annotationRegexp.String() + `$`)
+
+// Guard checks an incoming value for a key before it is written. If the update is blocked, an error describing the
+// reason and the current value of the target file are returned. Without a current value an empty value is returned and
+// the value in the processed file is left untouched
+type Guard func(key, incoming string) (value string, err error)
+
+// Constraint restricts the updates of the value of Key to the Policy
+type Constraint struct {
+	Key    string
+	Policy string
+}
+
+// NewGuard returns a guard that checks the constraints against the current values (key => value) of the target file
+func NewGuard(constraints []Constraint, current map[string]string) (Guard, error) {
+	checks := make(map[string]func(current *semver.Version, incoming semver.Version) error)
+	for _, c := range constraints {
+		if c.Policy == PolicySemverIncreaseOnly {
+			checks[c.Key] = func(current *semver.Version, incoming semver.Version) error {
+				if current != nil && incoming.LessThan(current) {
+					return fmt.Errorf("%s is lower than current version %s", incoming.Original(), current.Original())
+				}
+				return nil
+			}
+		} else if constraint, err := semver.NewConstraint(c.Policy); err != nil {
+			return nil, fmt.Errorf("invalid policy %s for %s: %w", c.Policy, c.Key, err)
+		} else {
+			policy := c.Policy
+			checks[c.Key] = func(current *semver.Version, incoming semver.Version) error {
+				if !constraint.Check(&incoming) {
+					return fmt.Errorf("%s is not in range %s", incoming.Original(), policy)
+				}
+				return nil
+			}
+		}
+	}
+	return func(key, incoming string) (string, error) {
+		check, ok := checks[key]
+		if !ok {
+			return incoming, nil
+		}
+		currentValue, exists := current[key]
+		incomingVersion, err := ParseVersion(incoming)
+		if err != nil {
+			return currentValue, fmt.Errorf("%s is not a semantic version", incoming)
+		}
+		var currentVersion *semver.Version
+		if exists {
+			// a current value that is no semantic version is replaced without comparison
+			currentVersion, _ = ParseVersion(currentValue)
+		}
+		if err := check(currentVersion, *incomingVersion); err != nil {
+			return currentValue, err
+		}
+		return incoming, nil
+	}, nil
+}
+
+// GuardTemplate checks the values of the constrained keys referenced in the template content before rendering. The
+// current value of a key is read from the current target file at the position the template renders the key to (see
+// templateValue). Without a current target file every value is checked without current value. If the current value of
+// an existing target file can not be found, the update is blocked because a downgrade could not be detected. Blocked
+// values are replaced by the current value. It returns false if a blocked value has no current value and the target
+// file must be left untouched
+func GuardTemplate(file, content string, current *string, fields map[string]string, values map[string]interface{}, constraints []Constraint) (guarded map[string]string, report Report, ok bool, err error) {
+	var keys []string
+	for _, c := range constraints {
+		if _, exists := fields[c.Key]; exists && strings.Contains(content, c.Key) {
+			keys = append(keys, c.Key)
+		}
+	}
+	sort.Strings(keys)
+	guarded = CopyFields(fields)
+	ok = true
+	currentValues := make(map[string]string)
+	var checked []string
+	for _, k := range keys {
+		if current == nil {
+			checked = append(checked, k)
+		} else if value, found := templateValue(file, content, *current, k, fields, values); found {
+			currentValues[k] = value
+			checked = append(checked, k)
+		} else {
+			report.Blocked = append(report.Blocked, Annotation{File: file, Key: k, Reason: "current value not found in target file"})
+			ok = false
+		}
+	}
+	guard, err := NewGuard(constraints, currentValues)
+	if err != nil {
+		return fields, report, false, err
+	}
+	for _, k := range checked {
+		annotation := Annotation{File: file, Key: k}
+		if value, passed := checkGuard(guard, &annotation, fields[k], &report); !passed {
+			ok = false
+		} else {
+			guarded[k] = value
+		}
+	}
+	return guarded, report, ok, nil
+}
+
+// ParseVersion parses the semantic version of a value. For image references (e.g. ghcr.io/test/app:1.2.3@sha256:...) the tag is used
+func ParseVersion(value string) (*semver.Version, error) {
+	if i := strings.Index(value, "@"); i >= 0 {
+		value = value[:i]
+	}
+	if i := strings.LastIndex(value, ":"); i >= 0 && i > strings.LastIndex(value, "/") {
+		value = value[i+1:]
+	}
+	return semver.NewVersion(strings.Trim(value, `"'`))
+}
+
+// CurrentValues returns the annotated values, the values referenced by the rules and, for kustomization files, the values
+// of the kustomize images (key => value) of a file
+func CurrentValues(file, content string, rules []Rule, images []KustomizeImage) map[string]string {
+	values := make(map[string]string)
+	if len(images) > 0 && IsKustomizationFile(file) {
+		kustomizeValues(content, images, values)
+	}
+	for _, line := range strings.Split(content, "\n") {
+		if matches := annotatedValueRegexp.FindStringSubmatch(line); matches != nil {
+			if _, exists := values[matches[2]]; !exists {
+				values[matches[2]] = matches[1]
+			}
+		}
+	}
+	if len(rules) == 0 || (path.Ext(file) != ".yaml" && path.Ext(file) != ".yml") {
+		return values
+	}
+	for _, d := range SplitDocuments(content) {
+		if d.node == nil {
+			continue
+		}
+		for _, r := range rules {
+			if !d.Matches(r.Selector) {
+				continue
+			}
+			if node := lookupPath(d.node, r.Path); node != nil {
+				if _, exists := values[r.Key]; !exists {
+					values[r.Key] = node.Value
+				}
+			}
+		}
+	}
+	return values
+}
@@ -0,0 +1,196 @@
+package replacer
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestReplaceFileWithGuard(t *testing.T) {
+	current := `tag: 1.2.0 # {"keptn.git-promotion.replacewith":"data.image.tag"}
+image: ghcr.io/test/app:1.2.0 # {"keptn.git-promotion.replacewith":"data.image"}
+context: abc # {"keptn.git-promotion.replacewith":"shkeptncontext"}`
+	source := `tag: 1.0.0 # {"keptn.git-promotion.replacewith":"data.image.tag"}
+image: ghcr.io/test/app:1.0.0 # {"keptn.git-promotion.replacewith":"data.image"}
+context: abc # {"keptn.git-promotion.replacewith":"shkeptncontext"}`
+	type args struct {
+		constraints []Constraint
+		tags        map[string]string
+	}
+	tests := []struct {
+		name        string
+		args        args
+		wantResult  string
+		wantBlocked []Annotation
+	}{
+		{
+			name: "increase allowed",
+			args: args{
+				constraints: []Constraint{{Key: "data.image.tag", Policy: PolicySemverIncreaseOnly}, {Key: "data.image", Policy: PolicySemverIncreaseOnly}},
+				tags:        map[string]string{"data.image.tag": "1.3.0", "data.image": "ghcr.io/test/app:v1.3.0", "shkeptncontext": "def"},
+			},
+			wantResult: `tag: 1.3.0 # {"keptn.git-promotion.replacewith":"data.image.tag"}
+image: ghcr.io/test/app:v1.3.0 # {"keptn.git-promotion.replacewith":"data.image"}
+context: def # {"keptn.git-promotion.replacewith":"shkeptncontext"}`,
+		},
+		{
+			name: "downgrade blocked keeps current value",
+			args: args{
+				constraints: []Constraint{{Key: "data.image.tag", Policy: PolicySemverIncreaseOnly}, {Key: "data.image", Policy: PolicySemverIncreaseOnly}},
+				tags:        map[string]string{"data.image.tag": "1.1.0", "data.image": "ghcr.io/test/app:1.1.0", "shkeptncontext": "def"},
+			},
+			wantResult: `tag: 1.2.0 # {"keptn.git-promotion.replacewith":"data.image.tag"}
+image: ghcr.io/test/app:1.2.0 # {"keptn.git-promotion.replacewith":"data.image"}
+context: def # {"keptn.git-promotion.replacewith":"shkeptncontext"}`,
+			wantBlocked: []Annotation{
+				{File: "values.yaml", Line: 1, Key: "data.image.tag", Reason: "1.1.0 is lower than current version 1.2.0"},
+				{File: "values.yaml", Line: 2, Key: "data.image", Reason: "1.1.0 is lower than current version 1.2.0"},
+			},
+		},
+		{
+			name: "range",
+			args: args{
+				constraints: []Constraint{{Key: "data.image.tag", Policy: "~1.2"}},
+				tags:        map[string]string{"data.image.tag": "2.0.0", "data.image": "ghcr.io/test/app:2.0.0", "shkeptncontext": "abc"},
+			},
+			wantResult: `tag: 1.2.0 # {"keptn.git-promotion.replacewith":"data.image.tag"}
+image: ghcr.io/test/app:2.0.0 # {"keptn.git-promotion.replacewith":"data.image"}
+context: abc # {"keptn.git-promotion.replacewith":"shkeptncontext"}`,
+			wantBlocked: []Annotation{
+				{File: "values.yaml", Line: 1, Key: "data.image.tag", Reason: "2.0.0 is not in range ~1.2"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			guard, err := NewGuard(tt.args.constraints, CurrentValues("values.yaml", current, nil, nil))
+			if err != nil {
+				t.Fatalf("NewGuard() error = %v", err)
+			}
+			gotResult, gotReport := ReplaceFile("values.yaml", source, tt.args.tags, guard)
+			if gotResult != tt.wantResult {
+				t.Errorf("ReplaceFile() = %v, want %v", gotResult, tt.wantResult)
+			}
+			if !reflect.DeepEqual(gotReport.Blocked, tt.wantBlocked) {
+				t.Errorf("ReplaceFile() blocked = %v, want %v", gotReport.Blocked, tt.wantBlocked)
+			}
+		})
+	}
+}
+
+func TestSetKustomizeImagesWithGuard(t *testing.T) {
+	current := `images:
+  - name: app
+    newName: ghcr.io/test/app
+    newTag: 1.2.0
+`
+	images := []KustomizeImage{{Name: "app", NewName: "data.image.name", NewTag: "data.image.tag"}}
+	guard, err := NewGuard([]Constraint{{Key: "data.image.tag", Policy: PolicySemverIncreaseOnly}}, CurrentValues("kustomization.yaml", current, nil, images))
+	if err != nil {
+		t.Fatalf("NewGuard() error = %v", err)
+	}
+	tags := map[string]string{"data.image.name": "ghcr.io/test/app2", "data.image.tag": "1.1.0"}
+	gotResult, gotReport, err := SetKustomizeImages("kustomization.yaml", current, images, tags, guard)
+	if err != nil {
+		t.Fatalf("SetKustomizeImages() error = %v", err)
+	}
+	wantResult := `images:
+  - name: app
+    newName: ghcr.io/test/app2
+    newTag: 1.2.0
+`
+	if gotResult != wantResult {
+		t.Errorf("SetKustomizeImages() = %v, want %v", gotResult, wantResult)
+	}
+	wantBlocked := []Annotation{{File: "kustomization.yaml", Line: 2, Key: "data.image.tag", Reason: "1.1.0 is lower than current version 1.2.0"}}
+	if !reflect.DeepEqual(gotReport.Blocked, wantBlocked) {
+		t.Errorf("SetKustomizeImages() blocked = %v, want %v", gotReport.Blocked, wantBlocked)
+	}
+}
+
+func TestGuardTemplate(t *testing.T) {
+	content := `image:
+  repository: ghcr.io/test/app
+  tag: "v{{ .data.image.tag }}"
+---
+context: {{ value "shkeptncontext" }}
+ranged: {{ .data.ranged }}`
+	current := `image:
+  repository: ghcr.io/test/app
+  tag: "v1.2.0"
+---
+context: abc
+ranged: 1.2.0`
+	constraints := []Constraint{{Key: "data.image.tag", Policy: PolicySemverIncreaseOnly}, {Key: "data.ranged", Policy: "~1.2"}, {Key: "data.unused", Policy: "~1.2"}}
+	tests := []struct {
+		name        string
+		current     *string
+		tags        map[string]string
+		wantFields  map[string]string
+		wantBlocked []Annotation
+		wantOk      bool
+	}{
+		{
+			name:       "increase allowed",
+			current:    &current,
+			tags:       map[string]string{"data.image.tag": "1.3.0", "data.ranged": "1.2.1", "shkeptncontext": "def"},
+			wantFields: map[string]string{"data.image.tag": "1.3.0", "data.ranged": "1.2.1", "shkeptncontext": "def"},
+			wantOk:     true,
+		},
+		{
+			name:       "downgrade blocked uses current value",
+			current:    &current,
+			tags:       map[string]string{"data.image.tag": "1.0.0", "data.ranged": "2.0.0", "shkeptncontext": "def"},
+			wantFields: map[string]string{"data.image.tag": "1.2.0", "data.ranged": "1.2.0", "shkeptncontext": "def"},
+			wantBlocked: []Annotation{
+				{File: "values.yaml", Key: "data.image.tag", Reason: "1.0.0 is lower than current version 1.2.0"},
+				{File: "values.yaml", Key: "data.ranged", Reason: "2.0.0 is not in range ~1.2"},
+			},
+			wantOk: true,
+		},
+		{
+			name:       "current value not found",
+			current:    stringPtr("image:\n  tag: 1.2.0\n"),
+			tags:       map[string]string{"data.image.tag": "1.3.0", "data.ranged": "1.2.1", "shkeptncontext": "def"},
+			wantFields: map[string]string{"data.image.tag": "1.3.0", "data.ranged": "1.2.1", "shkeptncontext": "def"},
+			wantBlocked: []Annotation{
+				{File: "values.yaml", Key: "data.image.tag", Reason: "current value not found in target file"},
+				{File: "values.yaml", Key: "data.ranged", Reason: "current value not found in target file"},
+			},
+		},
+		{
+			name:       "new file",
+			tags:       map[string]string{"data.image.tag": "1.0.0", "data.ranged": "1.2.1", "shkeptncontext": "def"},
+			wantFields: map[string]string{"data.image.tag": "1.0.0", "data.ranged": "1.2.1", "shkeptncontext": "def"},
+			wantOk:     true,
+		},
+		{
+			name:        "blocked without current value",
+			tags:        map[string]string{"data.image.tag": "latest", "data.ranged": "1.2.1", "shkeptncontext": "def"},
+			wantFields:  map[string]string{"data.image.tag": "latest", "data.ranged": "1.2.1", "shkeptncontext": "def"},
+			wantBlocked: []Annotation{{File: "values.yaml", Key: "data.image.tag", Reason: "latest is not a semantic version"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.tags["data.unused"] = "2.0.0"
+			tt.wantFields["data.unused"] = "2.0.0"
+			gotFields, gotReport, gotOk, err := GuardTemplate("values.yaml", content, tt.current, tt.tags, nil, constraints)
+			if err != nil {
+				t.Fatalf("GuardTemplate() error = %v", err)
+			}
+			if !reflect.DeepEqual(gotFields, tt.wantFields) {
+				t.Errorf("GuardTemplate() fields = %v, want %v", gotFields, tt.wantFields)
+			}
+			if !reflect.DeepEqual(gotReport.Blocked, tt.wantBlocked) {
+				t.Errorf("GuardTemplate() blocked = %v, want %v", gotReport.Blocked, tt.wantBlocked)
+			}
+			if gotOk != tt.wantOk {
+				t.Errorf("GuardTemplate() ok = %v, want %v", gotOk, tt.wantOk)
+			}
+		})
+	}
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
@@ -0,0 +1,79 @@
+package replacer
+
+import (
+	"path"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ImageReferences returns the image references of a yaml file: the values of "image" fields, the "repository" and
+// "tag" (or "digest") fields of the same map with an optional "registry" (like in helm values) and the images of
+// kustomization files. Values with template expressions and documents which are no valid yaml are ignored
+func ImageReferences(file, content string) (images []string) {
+	kustomization := IsKustomizationFile(file)
+	if !kustomization && path.Ext(file) != ".yaml" && path.Ext(file) != ".yml" {
+		return nil
+	}
+	for _, d := range SplitDocuments(content) {
+		if d.node == nil {
+			continue
+		}
+		if kustomization {
+			if imagesNode := lookup(d.node, "images"); imagesNode != nil && imagesNode.Kind == yaml.SequenceNode {
+				for _, entry := range imagesNode.Content {
+					images = appendImage(images, imageReference(entry))
+				}
+			}
+			continue
+		}
+		images = collectImages(d.node, images)
+	}
+	return images
+}
+
+func collectImages(node *yaml.Node, images []string) []string {
+	switch node.Kind {
+	case yaml.MappingNode:
+		if image := scalarValue(lookup(node, "image")); image != "" {
+			images = appendImage(images, image)
+		}
+		repository, tag, digest := scalarValue(lookup(node, "repository")), scalarValue(lookup(node, "tag")), scalarValue(lookup(node, "digest"))
+		if repository != "" && (tag != "" || digest != "") {
+			ref := repository
+			if registry := scalarValue(lookup(node, "registry")); registry != "" {
+				ref = registry + "/" + ref
+			}
+			if tag != "" {
+				ref += ":" + tag
+			}
+			if digest != "" {
+				ref += "@" + digest
+			}
+			images = appendImage(images, ref)
+		}
+		for i := 1; i < len(node.Content); i += 2 {
+			images = collectImages(node.Content[i], images)
+		}
+	case yaml.SequenceNode:
+		for _, n := range node.Content {
+			images = collectImages(n, images)
+		}
+	}
+	return images
+}
+
+func scalarValue(node *yaml.Node) string {
+	if node == nil || node.Kind != yaml.ScalarNode || node.Tag == "!!null" {
+		return ""
+	}
+	return node.Value
+}
+
+// appendImage appends the image reference unless it is empty or contains a template expression
+func appendImage(images []string, image string) []string {
+	if image == "" || strings.Contains(image, "{{") || strings.Contains(image, "${") {
+		return images
+	}
+	return append(images, image)
+}
@@ -0,0 +1,86 @@
+package replacer
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestImageReferences(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		want    []string
+	}{
+		{
+			name: "manifests",
+			file: "prod/deployments.yml",
+			content: `kind: Deployment
+spec:
+  template:
+    spec:
+      initContainers:
+        - image: "ghcr.io/test/init:1.0"
+      containers:
+        - name: app
+          image: ghcr.io/test/app:2.0 # {"keptn.git-promotion.replacewith":"data.image"}
+---
+kind: Pod
+spec:
+  containers:
+    - image: ghcr.io/test/sidecar@sha256:abc
+`,
+			want: []string{"ghcr.io/test/init:1.0", "ghcr.io/test/app:2.0", "ghcr.io/test/sidecar@sha256:abc"},
+		},
+		{
+			name: "helm values",
+			file: "prod/values.yaml",
+			content: `image:
+  registry: ghcr.io
+  repository: test/app
+  tag: "2.0"
+sidecar:
+  image:
+    repository: ghcr.io/test/sidecar
+    tag: 1.1
+    digest: sha256:abc
+worker:
+  repository: ghcr.io/test/worker
+`,
+			want: []string{"ghcr.io/test/app:2.0", "ghcr.io/test/sidecar:1.1@sha256:abc"},
+		},
+		{
+			name: "kustomization",
+			file: "prod/kustomization.yaml",
+			content: `images:
+  - name: app
+    newName: ghcr.io/test/app
+    newTag: "2.0"
+  - name: nginx
+`,
+			want: []string{"ghcr.io/test/app:2.0", "nginx"},
+		},
+		{
+			name:    "template expressions",
+			file:    "prod/values.yaml",
+			content: "image: ghcr.io/test/app:${data.image.tag}\nother:\n  image: \"{{ .Values.image }}\"\n",
+		},
+		{
+			name:    "invalid yaml",
+			file:    "prod/values.yaml",
+			content: "image: [ghcr.io/test/app:2.0\n",
+		},
+		{
+			name:    "no yaml file",
+			file:    "prod/README.md",
+			content: "image: ghcr.io/test/app:2.0\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ImageReferences(tt.file, tt.content); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ImageReferences() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
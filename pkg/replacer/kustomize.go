@@ -0,0 +1,163 @@
+package replacer
+
+import (
+	"bytes"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"path"
+)
+
+// KustomizationFileNames are the file names recognized as kustomization files
+var KustomizationFileNames = []string{"kustomization.yaml", "kustomization.yml", "Kustomization"}
+
+// KustomizeImage references the values used for an entry of the "images" section of a kustomization file.
+// NewName, NewTag and Digest are keys of the values, empty keys leave the field untouched
+type KustomizeImage struct {
+	Name    string
+	NewName string
+	NewTag  string
+	Digest  string
+}
+
+// IsKustomizationFile returns true if the base name of file is a kustomization file name
+func IsKustomizationFile(file string) bool {
+	for _, n := range KustomizationFileNames {
+		if path.Base(file) == n {
+			return true
+		}
+	}
+	return false
+}
+
+// SetKustomizeImages sets newName, newTag and digest of the named images in the "images" section of a kustomization
+// file. Missing entries are created. The content is only re-encoded if a value changed. If a guard is given, every value
+// is checked before it is written
+func SetKustomizeImages(file, content string, images []KustomizeImage, tags map[string]string, guard Guard) (result string, report Report, err error) {
+	var document yaml.Node
+	if err := yaml.Unmarshal([]byte(content), &document); err != nil {
+		return content, report, fmt.Errorf("could not parse kustomization file %s: %w", file, err)
+	}
+	if len(document.Content) == 0 {
+		document.Kind = yaml.DocumentNode
+		document.Content = []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}}
+	}
+	root := document.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return content, report, fmt.Errorf("kustomization file %s is not a yaml map", file)
+	}
+	changed := false
+	imagesNode := lookup(root, "images")
+	if imagesNode == nil {
+		imagesNode = &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		root.Content = append(root.Content, scalarNode("images"), imagesNode)
+	} else if imagesNode.Kind == yaml.ScalarNode && imagesNode.Tag == "!!null" {
+		*imagesNode = yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+	} else if imagesNode.Kind != yaml.SequenceNode {
+		return content, report, fmt.Errorf("images in kustomization file %s is not a list", file)
+	}
+	for _, image := range images {
+		entry := findImage(imagesNode, image.Name)
+		// missing entries are only added if at least one value is written
+		missing := entry == nil
+		if missing {
+			entry = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", Content: []*yaml.Node{scalarNode("name"), scalarNode(image.Name)}}
+		}
+		for _, f := range [][2]string{{"newName", image.NewName}, {"newTag", image.NewTag}, {"digest", image.Digest}} {
+			field, key := f[0], f[1]
+			if key == "" {
+				continue
+			}
+			annotation := Annotation{File: file, Line: entry.Line, Key: key}
+			report.Annotations = append(report.Annotations, annotation)
+			if value, ok := tags[key]; !ok {
+				report.Unresolved = append(report.Unresolved, annotation)
+			} else if value, ok = checkGuard(guard, &annotation, value, &report); !ok {
+				continue
+			} else if setValue(entry, field, value) {
+				changed = true
+				if missing {
+					imagesNode.Content = append(imagesNode.Content, entry)
+					missing = false
+				}
+			}
+		}
+	}
+	if !changed {
+		return content, report, nil
+	}
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&document); err != nil {
+		return content, report, fmt.Errorf("could not write kustomization file %s: %w", file, err)
+	}
+	return buf.String(), report, nil
+}
+
+// kustomizeValues adds the current values of the images (key => value) of a kustomization file to values
+func kustomizeValues(content string, images []KustomizeImage, values map[string]string) {
+	var document yaml.Node
+	if err := yaml.Unmarshal([]byte(content), &document); err != nil || len(document.Content) == 0 {
+		return
+	}
+	imagesNode := lookup(document.Content[0], "images")
+	if imagesNode == nil || imagesNode.Kind != yaml.SequenceNode {
+		return
+	}
+	for _, image := range images {
+		entry := findImage(imagesNode, image.Name)
+		for _, f := range [][2]string{{"newName", image.NewName}, {"newTag", image.NewTag}, {"digest", image.Digest}} {
+			if value := scalarValue(lookup(entry, f[0])); f[1] != "" && value != "" {
+				if _, exists := values[f[1]]; !exists {
+					values[f[1]] = value
+				}
+			}
+		}
+	}
+}
+
+// imageReference returns the image reference of a kustomize image entry
+func imageReference(entry *yaml.Node) string {
+	value := func(key string) string {
+		if n := lookup(entry, key); n != nil {
+			return n.Value
+		}
+		return ""
+	}
+	ref := value("name")
+	if newName := value("newName"); newName != "" {
+		ref = newName
+	}
+	if newTag := value("newTag"); newTag != "" {
+		ref += ":" + newTag
+	}
+	if digest := value("digest"); digest != "" {
+		ref += "@" + digest
+	}
+	return ref
+}
+
+func findImage(images *yaml.Node, name string) *yaml.Node {
+	for _, entry := range images.Content {
+		if n := lookup(entry, "name"); n != nil && n.Value == name {
+			return entry
+		}
+	}
+	return nil
+}
+
+func setValue(mapping *yaml.Node, key, value string) (changed bool) {
+	if n := lookup(mapping, key); n != nil {
+		if n.Value == value && n.Kind == yaml.ScalarNode {
+			return false
+		}
+		n.Kind, n.Tag, n.Value, n.Content = yaml.ScalarNode, "!!str", value, nil
+		return true
+	}
+	mapping.Content = append(mapping.Content, scalarNode(key), scalarNode(value))
+	return true
+}
+
+func scalarNode(value string) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value}
+}
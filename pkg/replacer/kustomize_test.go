@@ -0,0 +1,120 @@
+package replacer
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSetKustomizeImages(t *testing.T) {
+	tags := map[string]string{
+		"data.image.name": "ghcr.io/test/app",
+		"data.image.tag":  "2.0",
+	}
+	type args struct {
+		content string
+		images  []KustomizeImage
+	}
+	tests := []struct {
+		name           string
+		args           args
+		wantResult     string
+		wantUnresolved []Annotation
+		wantImages     []string
+		wantErr        bool
+	}{
+		{
+			name: "update existing entry",
+			args: args{
+				content: `resources:
+  - ../../base
+images:
+  - name: app
+    newName: ghcr.io/test/app
+    newTag: "1.0" # current version
+`,
+				images: []KustomizeImage{{Name: "app", NewTag: "data.image.tag"}},
+			},
+			wantResult: `resources:
+  - ../../base
+images:
+  - name: app
+    newName: ghcr.io/test/app
+    newTag: "2.0" # current version
+`,
+			wantImages: []string{"ghcr.io/test/app:2.0"},
+		},
+		{
+			name: "create missing entry",
+			args: args{
+				content: `resources:
+  - ../../base
+`,
+				images: []KustomizeImage{{Name: "app", NewName: "data.image.name", NewTag: "data.image.tag"}},
+			},
+			wantResult: `resources:
+  - ../../base
+images:
+  - name: app
+    newName: ghcr.io/test/app
+    newTag: "2.0"
+`,
+			wantImages: []string{"ghcr.io/test/app:2.0"},
+		},
+		{
+			name: "unresolved missing entry is not created",
+			args: args{
+				content: `resources:
+  - ../../base
+`,
+				images: []KustomizeImage{{Name: "app", Digest: "data.image.digest"}},
+			},
+			wantResult: `resources:
+  - ../../base
+`,
+			wantUnresolved: []Annotation{{File: "kustomization.yaml", Key: "data.image.digest"}},
+		},
+		{
+			name: "unchanged content is not re-encoded",
+			args: args{
+				content: `images:
+    - name: app
+      newTag: '2.0'
+`,
+				images: []KustomizeImage{{Name: "app", NewTag: "data.image.tag", Digest: "data.image.digest"}},
+			},
+			wantResult: `images:
+    - name: app
+      newTag: '2.0'
+`,
+			wantUnresolved: []Annotation{{File: "kustomization.yaml", Line: 2, Key: "data.image.digest"}},
+			wantImages:     []string{"app:2.0"},
+		},
+		{
+			name: "invalid images",
+			args: args{
+				content: `images: app`,
+				images:  []KustomizeImage{{Name: "app", NewTag: "data.image.tag"}},
+			},
+			wantResult: `images: app`,
+			wantErr:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotResult, gotReport, err := SetKustomizeImages("kustomization.yaml", tt.args.content, tt.args.images, tags, nil)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("SetKustomizeImages() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if gotResult != tt.wantResult {
+				t.Errorf("SetKustomizeImages() = %v, want %v", gotResult, tt.wantResult)
+			}
+			if gotImages := ImageReferences("kustomization.yaml", gotResult); !reflect.DeepEqual(gotImages, tt.wantImages) {
+				t.Errorf("SetKustomizeImages() images = %v, want %v", gotImages, tt.wantImages)
+			}
+			if !reflect.DeepEqual(gotReport.Unresolved, tt.wantUnresolved) {
+				t.Errorf("SetKustomizeImages() unresolved = %v, want %v", gotReport.Unresolved, tt.wantUnresolved)
+			}
+		})
+	}
+}
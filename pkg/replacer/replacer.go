@@ -1,36 +1,153 @@
 package replacer
 
 import (
+	"fmt"
 	logger "github.com/sirupsen/logrus"
 	"regexp"
 	"strings"
 )
 
 const prefix = `{"keptn.git-promotion.replacewith":"`
-const suffix = `"}`
+
+// annotationRegexp matches the annotation with the key and an optional selector of the document,
+// e.g. {"keptn.git-promotion.replacewith":"data.image","kind":"Deployment","name":"frontend"}
+var annotationRegexp = regexp.MustCompile(regexp.QuoteMeta(prefix) + `([^"]*)"(?:,"kind":"([^"]*)")?(?:,"name":"([^"]*)")?}`)
+
+// Annotation is a replacement annotation found in a processed file
+type Annotation struct {
+	File string
+	Line int
+	Key  string
+	// Reason is set for blocked updates
+	Reason string
+}
+
+func (a Annotation) String() string {
+	key := a.Key
+	if a.Reason != "" {
+		key += ": " + a.Reason
+	}
+	if a.File == "" {
+		return fmt.Sprintf("line %d (%s)", a.Line, key)
+	} else if a.Line == 0 {
+		return fmt.Sprintf("%s (%s)", a.File, key)
+	}
+	return fmt.Sprintf("%s:%d (%s)", a.File, a.Line, key)
+}
+
+// Report collects all annotations found during replacement together with the ones that could not be processed.
+// Unresolved annotations reference a key that is not available, unmatched annotations are on lines
+// that could not be rewritten (e.g. the annotation is not at the end of a "key: value" line), blocked
+// annotations were not updated because of a Guard and unselected annotations are in a document that does not
+// match their selector
+type Report struct {
+	Annotations []Annotation
+	Unresolved  []Annotation
+	Unmatched   []Annotation
+	Blocked     []Annotation
+	Unselected  []Annotation
+}
+
+// Merge appends all annotations of other to the report
+func (r *Report) Merge(other Report) {
+	r.Annotations = append(r.Annotations, other.Annotations...)
+	r.Unresolved = append(r.Unresolved, other.Unresolved...)
+	r.Unmatched = append(r.Unmatched, other.Unmatched...)
+	r.Blocked = append(r.Blocked, other.Blocked...)
+	r.Unselected = append(r.Unselected, other.Unselected...)
+}
+
+// HasFindings returns true if at least one annotation is unresolved or unmatched
+func (r Report) HasFindings() bool {
+	return len(r.Unresolved) > 0 || len(r.Unmatched) > 0
+}
+
+// String returns a short summary of the report suitable for the finished event message
+func (r Report) String() string {
+	summary := fmt.Sprintf("%d annotations found", len(r.Annotations))
+	if len(r.Unresolved) > 0 {
+		summary += fmt.Sprintf(", %d unresolved: %s", len(r.Unresolved), joinAnnotations(r.Unresolved))
+	}
+	if len(r.Unmatched) > 0 {
+		summary += fmt.Sprintf(", %d unmatched: %s", len(r.Unmatched), joinAnnotations(r.Unmatched))
+	}
+	if len(r.Blocked) > 0 {
+		summary += fmt.Sprintf(", %d blocked: %s", len(r.Blocked), joinAnnotations(r.Blocked))
+	}
+	if len(r.Unselected) > 0 {
+		summary += fmt.Sprintf(", %d unselected: %s", len(r.Unselected), joinAnnotations(r.Unselected))
+	}
+	return summary
+}
+
+func joinAnnotations(annotations []Annotation) string {
+	s := make([]string, len(annotations))
+	for i, a := range annotations {
+		s[i] = a.String()
+	}
+	return strings.Join(s, ", ")
+}
 
 // Replace value marked by yaml comment e.g.
 // tag: 2.5.5 # {"keptn.git-promotion.replacewith":"data.image.tag"}
 func Replace(fileData string, tags map[string]string) (result string) {
-	replaced := fileData
-	//quick check for faster processing
-	for k, v := range tags {
-		if strings.Contains(replaced, prefix+k+suffix) {
-			replaced = replaceValue(replaced, k, v)
-		}
-	}
-	logger.WithField("func", "Replace").Infof("tags: %v, original: %s, replaced: %s", tags, fileData, replaced)
-	return replaced
+	result, _ = ReplaceFile("", fileData, tags, nil)
+	return result
 }
 
-func replaceValue(file, key, value string) string {
-	splitted := strings.Split(file, "\n")
-	annotation := prefix + key + suffix
-	re := regexp.MustCompile(`(^.+: ).*( # ` + annotation + `$)`)
+// ReplaceFile replaces all annotated values like Replace and additionally reports every annotation found in the file.
+// Annotations with a selector are only replaced if the yaml document of the line matches the selector.
+// If a guard is given, every value is checked before it is written
+func ReplaceFile(file, fileData string, tags map[string]string, guard Guard) (result string, report Report) {
+	splitted := strings.Split(fileData, "\n")
+	var documents []Document
 	for i, s := range splitted {
-		if strings.Contains(s, annotation) {
-			splitted[i] = re.ReplaceAllString(s, "${1}"+value+"${2}")
+		for _, match := range annotationRegexp.FindAllStringSubmatch(s, -1) {
+			annotation := Annotation{File: file, Line: i + 1, Key: match[1]}
+			report.Annotations = append(report.Annotations, annotation)
+			if selector := (Selector{Kind: match[2], Name: match[3]}); selector != (Selector{}) {
+				if documents == nil {
+					documents = SplitDocuments(fileData)
+				}
+				if !documentOfLine(documents, i).Matches(selector) {
+					report.Unselected = append(report.Unselected, annotation)
+					continue
+				}
+			}
+			if value, ok := tags[annotation.Key]; !ok {
+				report.Unresolved = append(report.Unresolved, annotation)
+			} else if value, ok = checkGuard(guard, &annotation, value, &report); !ok {
+				continue
+			} else if replaced, ok := replaceValue(s, match[0], value); !ok {
+				report.Unmatched = append(report.Unmatched, annotation)
+			} else {
+				splitted[i] = replaced
+			}
 		}
 	}
-	return strings.Join(splitted, "\n")
+	result = strings.Join(splitted, "\n")
+	logger.WithField("func", "Replace").Infof("tags: %v, original: %s, replaced: %s", tags, fileData, result)
+	return result, report
+}
+
+// checkGuard returns the value to write and false if the line should be left untouched
+func checkGuard(guard Guard, annotation *Annotation, value string, report *Report) (string, bool) {
+	if guard == nil {
+		return value, true
+	}
+	checked, err := guard(annotation.Key, value)
+	if err != nil {
+		blocked := *annotation
+		blocked.Reason = err.Error()
+		report.Blocked = append(report.Blocked, blocked)
+	}
+	return checked, err == nil || checked != ""
+}
+
+func replaceValue(line, annotation, value string) (string, bool) {
+	re := regexp.MustCompile(`(^.+: ).*( # ` + regexp.QuoteMeta(annotation) + `$)`)
+	if !re.MatchString(line) {
+		return line, false
+	}
+	return re.ReplaceAllString(line, "${1}"+strings.Replace(value, "$", "$$", -1)+"${2}"), true
 }
@@ -1,6 +1,9 @@
 package replacer
 
-import "testing"
+import (
+	"reflect"
+	"testing"
+)
 
 func TestReplace(t *testing.T) {
 	type args struct {
@@ -114,3 +117,116 @@ spec:
 		})
 	}
 }
+
+func TestReplaceFile(t *testing.T) {
+	type args struct {
+		file     string
+		fileData string
+		tags     map[string]string
+	}
+	tests := []struct {
+		name       string
+		args       args
+		wantResult string
+		wantReport Report
+	}{
+		{
+			name: "all resolved",
+			args: args{
+				file:     "dev/values.yaml",
+				fileData: `tag: 1.0 # {"keptn.git-promotion.replacewith":"data.image.tag"}`,
+				tags: map[string]string{
+					"data.image.tag": "1.1",
+				},
+			},
+			wantResult: `tag: 1.1 # {"keptn.git-promotion.replacewith":"data.image.tag"}`,
+			wantReport: Report{
+				Annotations: []Annotation{{File: "dev/values.yaml", Line: 1, Key: "data.image.tag"}},
+			},
+		},
+		{
+			name: "unresolved and unmatched",
+			args: args{
+				file: "dev/values.yaml",
+				fileData: `
+tag: 1.0 # {"keptn.git-promotion.replacewith":"data.image.tga"}
+# {"keptn.git-promotion.replacewith":"data.image.tag"} is used for the tag
+`,
+				tags: map[string]string{
+					"data.image.tag": "1.1",
+				},
+			},
+			wantResult: `
+tag: 1.0 # {"keptn.git-promotion.replacewith":"data.image.tga"}
+# {"keptn.git-promotion.replacewith":"data.image.tag"} is used for the tag
+`,
+			wantReport: Report{
+				Annotations: []Annotation{
+					{File: "dev/values.yaml", Line: 2, Key: "data.image.tga"},
+					{File: "dev/values.yaml", Line: 3, Key: "data.image.tag"},
+				},
+				Unresolved: []Annotation{{File: "dev/values.yaml", Line: 2, Key: "data.image.tga"}},
+				Unmatched:  []Annotation{{File: "dev/values.yaml", Line: 3, Key: "data.image.tag"}},
+			},
+		},
+		{
+			name: "selector",
+			args: args{
+				file: "dev/deployments.yaml",
+				fileData: `kind: Deployment
+metadata:
+  name: frontend
+image: 1.0 # {"keptn.git-promotion.replacewith":"data.image","kind":"Deployment","name":"frontend"}
+---
+kind: Deployment
+metadata:
+  name: backend
+image: 1.0 # {"keptn.git-promotion.replacewith":"data.image","kind":"Deployment","name":"frontend"}`,
+				tags: map[string]string{
+					"data.image": "1.1",
+				},
+			},
+			wantResult: `kind: Deployment
+metadata:
+  name: frontend
+image: 1.1 # {"keptn.git-promotion.replacewith":"data.image","kind":"Deployment","name":"frontend"}
+---
+kind: Deployment
+metadata:
+  name: backend
+image: 1.0 # {"keptn.git-promotion.replacewith":"data.image","kind":"Deployment","name":"frontend"}`,
+			wantReport: Report{
+				Annotations: []Annotation{
+					{File: "dev/deployments.yaml", Line: 4, Key: "data.image"},
+					{File: "dev/deployments.yaml", Line: 9, Key: "data.image"},
+				},
+				Unselected: []Annotation{{File: "dev/deployments.yaml", Line: 9, Key: "data.image"}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotResult, gotReport := ReplaceFile(tt.args.file, tt.args.fileData, tt.args.tags, nil)
+			if gotResult != tt.wantResult {
+				t.Errorf("ReplaceFile() gotResult = %v, want %v", gotResult, tt.wantResult)
+			}
+			if !reflect.DeepEqual(gotReport, tt.wantReport) {
+				t.Errorf("ReplaceFile() gotReport = %+v, want %+v", gotReport, tt.wantReport)
+			}
+		})
+	}
+}
+
+func TestReport_String(t *testing.T) {
+	report := Report{
+		Annotations: []Annotation{
+			{File: "dev/values.yaml", Line: 2, Key: "data.image.tga"},
+			{File: "dev/values.yaml", Line: 3, Key: "data.image.tag"},
+		},
+		Unresolved: []Annotation{{File: "dev/values.yaml", Line: 2, Key: "data.image.tga"}},
+	}
+	want := "2 annotations found, 1 unresolved: dev/values.yaml:2 (data.image.tga)"
+	if got := report.String(); got != want {
+		t.Errorf("String() = %v, want %v", got, want)
+	}
+}
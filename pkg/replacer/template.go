@@ -0,0 +1,193 @@
+package replacer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// TemplateSuffix marks files that are rendered in template mode
+const TemplateSuffix = ".tmpl"
+
+// Render renders the go template content against the event fields. The fields are available as nested
+// maps (e.g. {{ .data.image.tag }}) and through the value function with the flat key (e.g. {{ value "data.image.tag" }}).
+// Missing values fail the rendering, default also takes the flat key (e.g. {{ default "1" "data.replicas" }}).
+// Typed values (see ConvertToMap) are used for the nested maps if available, so numbers and booleans keep their type
+func Render(name, content string, fields map[string]string, values map[string]interface{}) (result string, err error) {
+	tmpl, err := template.New(name).Option("missingkey=error").Funcs(templateFuncs(fields)).Parse(content)
+	if err != nil {
+		return "", fmt.Errorf("could not parse template %s: %w", name, err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, toNestedMap(fields, values)); err != nil {
+		return "", fmt.Errorf("could not render template %s: %w", name, err)
+	}
+	return buf.String(), nil
+}
+
+// templateMarker is rendered instead of a value to find the position of the value in the rendered file
+const templateMarker = "git-promotion-template-marker"
+
+// pathStep is a mapping key or a sequence index in a yaml document
+type pathStep struct {
+	key   string
+	index int
+}
+
+// templateValue returns the value of key in the rendered file current. The template is rendered with a marker for
+// the key, the value is read from the same document and path of current with the text around the marker removed
+func templateValue(name, content, current, key string, fields map[string]string, values map[string]interface{}) (string, bool) {
+	markerFields := CopyFields(fields)
+	markerFields[key] = templateMarker
+	rendered, err := Render(name, content, markerFields, values)
+	if err != nil {
+		return "", false
+	}
+	currentDocuments := SplitDocuments(current)
+	for i, d := range SplitDocuments(rendered) {
+		if d.node == nil || i >= len(currentDocuments) || currentDocuments[i].node == nil {
+			continue
+		}
+		steps, marker := findMarker(d.node)
+		if marker == nil {
+			continue
+		}
+		node := followSteps(currentDocuments[i].node, steps)
+		if node == nil || node.Kind != yaml.ScalarNode {
+			return "", false
+		}
+		i := strings.Index(marker.Value, templateMarker)
+		prefix, suffix := marker.Value[:i], marker.Value[i+len(templateMarker):]
+		if len(node.Value) < len(prefix)+len(suffix) || !strings.HasPrefix(node.Value, prefix) || !strings.HasSuffix(node.Value, suffix) {
+			return "", false
+		}
+		return node.Value[len(prefix) : len(node.Value)-len(suffix)], true
+	}
+	return "", false
+}
+
+// findMarker returns the path to the first scalar value containing the templateMarker
+func findMarker(node *yaml.Node) ([]pathStep, *yaml.Node) {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		if strings.Contains(node.Value, templateMarker) {
+			return nil, node
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if steps, marker := findMarker(node.Content[i+1]); marker != nil {
+				return append([]pathStep{{key: node.Content[i].Value}}, steps...), marker
+			}
+		}
+	case yaml.SequenceNode:
+		for i, n := range node.Content {
+			if steps, marker := findMarker(n); marker != nil {
+				return append([]pathStep{{index: i}}, steps...), marker
+			}
+		}
+	}
+	return nil, nil
+}
+
+func followSteps(node *yaml.Node, steps []pathStep) *yaml.Node {
+	for _, s := range steps {
+		if node == nil {
+			return nil
+		}
+		if node.Kind == yaml.MappingNode {
+			node = lookup(node, s.key)
+		} else if node.Kind == yaml.SequenceNode && s.key == "" && s.index < len(node.Content) {
+			node = node.Content[s.index]
+		} else {
+			return nil
+		}
+	}
+	return node
+}
+
+func toNestedMap(fields map[string]string, values map[string]interface{}) map[string]interface{} {
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	// longer keys first so that nested maps win over conflicting leaf values
+	sort.Slice(keys, func(i, j int) bool {
+		return strings.Count(keys[i], ".") > strings.Count(keys[j], ".")
+	})
+	res := make(map[string]interface{})
+	for _, k := range keys {
+		current := res
+		parts := strings.Split(k, ".")
+		for _, p := range parts[:len(parts)-1] {
+			next, ok := current[p].(map[string]interface{})
+			if !ok {
+				next = make(map[string]interface{})
+				current[p] = next
+			}
+			current = next
+		}
+		if _, exists := current[parts[len(parts)-1]]; !exists {
+			// typed values are only used if the field was not changed afterwards (e.g. by a resolved digest)
+			if v, ok := values[k]; ok && fmt.Sprint(v) == fields[k] {
+				current[parts[len(parts)-1]] = v
+			} else {
+				current[parts[len(parts)-1]] = fields[k]
+			}
+		}
+	}
+	return res
+}
+
+func templateFuncs(fields map[string]string) template.FuncMap {
+	return template.FuncMap{
+		"value": func(key string) (string, error) {
+			if v, ok := fields[key]; ok {
+				return v, nil
+			}
+			return "", fmt.Errorf("value %s not found", key)
+		},
+		// default takes the flat key instead of the value because a missing value fails the rendering
+		"default": func(def, key string) string {
+			if v, ok := fields[key]; ok && v != "" {
+				return v
+			}
+			return def
+		},
+		"required": func(msg string, v interface{}) (interface{}, error) {
+			if v == nil || v == "" {
+				return nil, errors.New(msg)
+			}
+			return v, nil
+		},
+		"upper":      strings.ToUpper,
+		"lower":      strings.ToLower,
+		"trim":       strings.TrimSpace,
+		"trimPrefix": func(prefix, s string) string { return strings.TrimPrefix(s, prefix) },
+		"trimSuffix": func(suffix, s string) string { return strings.TrimSuffix(s, suffix) },
+		"replace":    func(old, new, s string) string { return strings.Replace(s, old, new, -1) },
+		"contains":   func(substr, s string) bool { return strings.Contains(s, substr) },
+		"hasPrefix":  func(prefix, s string) bool { return strings.HasPrefix(s, prefix) },
+		"hasSuffix":  func(suffix, s string) bool { return strings.HasSuffix(s, suffix) },
+		"split":      func(sep, s string) []string { return strings.Split(s, sep) },
+		"join": func(sep string, v []string) string {
+			return strings.Join(v, sep)
+		},
+		"quote":   func(s interface{}) string { return fmt.Sprintf("%q", fmt.Sprint(s)) },
+		"squote":  func(s interface{}) string { return "'" + fmt.Sprint(s) + "'" },
+		"indent":  indent,
+		"nindent": func(spaces int, s string) string { return "\n" + indent(spaces, s) },
+		"toYaml": func(v interface{}) (string, error) {
+			out, err := yaml.Marshal(v)
+			return strings.TrimSuffix(string(out), "\n"), err
+		},
+	}
+}
+
+func indent(spaces int, s string) string {
+	pad := strings.Repeat(" ", spaces)
+	return pad + strings.Replace(s, "\n", "\n"+pad, -1)
+}
@@ -0,0 +1,110 @@
+package replacer
+
+import "testing"
+
+func TestRender(t *testing.T) {
+	type args struct {
+		content string
+		fields  map[string]string
+		values  map[string]interface{}
+	}
+	tests := []struct {
+		name       string
+		args       args
+		wantResult string
+		wantErr    bool
+	}{
+		{
+			name: "nested and flat access",
+			args: args{
+				content: `image:
+  tag: {{ .data.image.tag }}
+  repository: {{ value "data.image.repository" | quote }}
+context: {{ .shkeptncontext }}`,
+				fields: map[string]string{
+					"data.image.tag":        "1.1",
+					"data.image.repository": "ghcr.io/test/app",
+					"shkeptncontext":        "mykeptncontext",
+				},
+			},
+			wantResult: `image:
+  tag: 1.1
+  repository: "ghcr.io/test/app"
+context: mykeptncontext`,
+		},
+		{
+			name: "helpers",
+			args: args{
+				content: `stage: {{ .data.stage | upper }}
+replicas: {{ default "1" "data.labels.replicas" }}
+team: {{ "data.labels.team" | default "red" }}
+region: {{ default "eu" "data.labels.region" }}
+{{- with .data.labels }}
+labels:{{ toYaml . | nindent 2 }}
+{{- end }}`,
+				fields: map[string]string{
+					"data.stage":           "prod",
+					"data.labels.replicas": "",
+					"data.labels.team":     "blue",
+				},
+			},
+			wantResult: `stage: PROD
+replicas: 1
+team: blue
+region: eu
+labels:
+  replicas: ""
+  team: blue`,
+		},
+		{
+			name: "typed values",
+			args: args{
+				content: `replicas: {{ .data.replicas }}
+{{- if .data.canary }}
+canary: {{ .data.canary }}
+{{- end }}
+{{- if .data.debug }}
+debug: true
+{{- end }}
+image: {{ .data.image }}`,
+				fields: map[string]string{
+					"data.replicas": "3",
+					"data.canary":   "true",
+					"data.debug":    "false",
+					"data.image":    "ghcr.io/test/app:1.1@sha256:1234",
+				},
+				values: map[string]interface{}{
+					"data.replicas": int64(3),
+					"data.canary":   true,
+					"data.debug":    false,
+					"data.image":    "ghcr.io/test/app:1.1",
+				},
+			},
+			wantResult: `replicas: 3
+canary: true
+image: ghcr.io/test/app:1.1@sha256:1234`,
+		},
+		{
+			name: "missing key",
+			args: args{
+				content: `tag: {{ .data.image.tga }}`,
+				fields: map[string]string{
+					"data.image.tag": "1.1",
+				},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotResult, err := Render(tt.name, tt.args.content, tt.args.fields, tt.args.values)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Render() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if gotResult != tt.wantResult {
+				t.Errorf("Render() = %v, want %v", gotResult, tt.wantResult)
+			}
+		})
+	}
+}
@@ -0,0 +1,202 @@
+package repoaccess
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// BareRepository accesses a local bare git repository with the git command line (e.g. to replay promotions).
+// Pull requests are kept in memory and get the URL file://<dir>/pull/<number>
+type BareRepository struct {
+	pullRequestStore
+	dir string
+	// env is added to the environment of all git commands
+	env []string
+}
+
+func NewBareRepository(dir string) *BareRepository {
+	return &BareRepository{pullRequestStore: pullRequestStore{urlPrefix: "file://" + dir}, dir: dir}
+}
+
+// git runs the git command in the repository and returns the output. env is added to the environment of the command
+func (r *BareRepository) git(stdin string, env []string, args ...string) (string, error) {
+	cmd := exec.Command("git", append([]string{"--git-dir", r.dir}, args...)...)
+	cmd.Env = append(append(os.Environ(), r.env...), env...)
+	cmd.Stdin = strings.NewReader(stdin)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("git %s failed: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
+
+func (r *BareRepository) revParse(rev string) (string, error) {
+	out, err := r.git("", nil, "rev-parse", "--verify", "--quiet", rev)
+	return strings.TrimSpace(out), err
+}
+
+func (r *BareRepository) BranchExists(branchName string) (exists bool, err error) {
+	cmd := exec.Command("git", "--git-dir", r.dir, "rev-parse", "--verify", "--quiet", "refs/heads/"+branchName)
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func (r *BareRepository) CreateBranch(sourceBranch, targetBranch string) (err error) {
+	commit, err := r.revParse("refs/heads/" + sourceBranch)
+	if err != nil {
+		return err
+	}
+	_, err = r.git("", nil, "update-ref", "refs/heads/"+targetBranch, commit, "")
+	return err
+}
+
+func (r *BareRepository) DeleteBranch(branch string) (err error) {
+	_, err = r.git("", nil, "update-ref", "-d", "refs/heads/"+branch)
+	return err
+}
+
+// GetFilesForBranch returns the file or all files of the directory path
+func (r *BareRepository) GetFilesForBranch(branch, path string) (files []RepositoryFile, err error) {
+	args := []string{"ls-tree", "-r", "-z", "--full-tree", "refs/heads/" + branch}
+	if path = strings.Trim(path, "/"); path != "" {
+		args = append(args, "--", path)
+	}
+	out, err := r.git("", nil, args...)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range strings.Split(out, "\x00") {
+		// <mode> SP <type> SP <object> TAB <path>
+		parts := strings.SplitN(entry, "\t", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		fields, filePath := strings.Fields(parts[0]), parts[1]
+		if len(fields) != 3 || fields[1] != "blob" {
+			continue
+		}
+		content, err := r.git("", nil, "cat-file", "blob", fields[2])
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, RepositoryFile{Path: filePath, Content: content, SHA: fields[2]})
+	}
+	return files, nil
+}
+
+// SyncFilesWithBranch commits the new files and the deletion of the current files missing in the new files with a
+// single commit
+func (r *BareRepository) SyncFilesWithBranch(branch, message string, currentTargetFiles, newTargetFiles []RepositoryFile) (changes int, err error) {
+	parent, err := r.revParse("refs/heads/" + branch)
+	if err != nil {
+		return 0, err
+	}
+	index, err := os.CreateTemp("", "git-promotion-index-")
+	if err != nil {
+		return 0, err
+	}
+	index.Close()
+	defer os.Remove(index.Name())
+	env := []string{"GIT_INDEX_FILE=" + index.Name()}
+	if _, err := r.git("", env, "read-tree", parent); err != nil {
+		return 0, err
+	}
+
+	// the index entries are updated with lines "<mode> SP <object> TAB <path>", mode 0 removes the entry
+	var indexInfo strings.Builder
+	newPaths := make(map[string]bool)
+	for _, f := range newTargetFiles {
+		newPaths[f.Path] = true
+		sha, err := r.git(f.Content, nil, "hash-object", "-w", "--stdin")
+		if err != nil {
+			return 0, err
+		}
+		sha = strings.TrimSpace(sha)
+		if current, err := r.revParse(parent + ":" + f.Path); err == nil && current == sha {
+			continue
+		}
+		fmt.Fprintf(&indexInfo, "100644 %s\t%s\n", sha, f.Path)
+		changes++
+	}
+	for _, f := range currentTargetFiles {
+		if !newPaths[f.Path] {
+			fmt.Fprintf(&indexInfo, "0 %s\t%s\n", strings.Repeat("0", 40), f.Path)
+			changes++
+		}
+	}
+	if changes == 0 {
+		return 0, nil
+	}
+	if _, err := r.git(indexInfo.String(), env, "update-index", "--index-info"); err != nil {
+		return 0, err
+	}
+
+	tree, err := r.git("", env, "write-tree")
+	if err != nil {
+		return changes, err
+	}
+	commit, err := r.git(commitMessage(message, "(build) update files"), []string{
+		"GIT_AUTHOR_NAME=git-promotion-service", "GIT_AUTHOR_EMAIL=git-promotion-service@keptn.sh",
+		"GIT_COMMITTER_NAME=git-promotion-service", "GIT_COMMITTER_EMAIL=git-promotion-service@keptn.sh",
+	}, "commit-tree", strings.TrimSpace(tree), "-p", parent)
+	if err != nil {
+		return changes, err
+	}
+	_, err = r.git("", nil, "update-ref", "refs/heads/"+branch, strings.TrimSpace(commit), parent)
+	return changes, err
+}
+
+func (r *BareRepository) CheckForNewCommits(toBranch, fromBranch string) (newCommits bool, err error) {
+	out, err := r.git("", nil, "rev-list", "--count", "refs/heads/"+toBranch+"..refs/heads/"+fromBranch)
+	if err != nil {
+		return false, err
+	}
+	count, err := strconv.Atoi(strings.TrimSpace(out))
+	return count > 0, err
+}
+
+// CompareBranches returns the files changed by the commits of fromBranch since the merge base with toBranch
+func (r *BareRepository) CompareBranches(toBranch, fromBranch string) (files []ChangedFile, err error) {
+	revisions := "refs/heads/" + toBranch + "...refs/heads/" + fromBranch
+	out, err := r.git("", nil, "diff", "--name-status", "-z", "--no-renames", revisions)
+	if err != nil {
+		return nil, err
+	}
+	fields := strings.Split(strings.TrimSuffix(out, "\x00"), "\x00")
+	for i := 0; i+1 < len(fields); i += 2 {
+		f := ChangedFile{Path: fields[i+1], Status: map[string]string{"A": "added", "D": "removed"}[fields[i]]}
+		if f.Status == "" {
+			f.Status = "modified"
+		}
+		patch, err := r.git("", nil, "diff", "--no-color", "--no-renames", revisions, "--", f.Path)
+		if err != nil {
+			return nil, err
+		}
+		if hunks := strings.Index(patch, "@@"); hunks >= 0 {
+			f.Patch = patch[hunks:]
+		}
+		files = append(files, f)
+	}
+	return files, nil
+}
+
+func (r *BareRepository) CreatePullRequest(fromBranch, toBranch, title, body string) (pr *PullRequest, err error) {
+	if exists, err := r.BranchExists(fromBranch); err != nil {
+		return nil, err
+	} else if !exists {
+		return nil, fmt.Errorf("branch %s not found", fromBranch)
+	}
+	return r.create(fromBranch, toBranch, title, body), nil
+}
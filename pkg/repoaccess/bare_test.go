@@ -0,0 +1,45 @@
+package repoaccess
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestBareRepository(t *testing.T) {
+	bare := newTestBareRepository(t)
+	testRepository(t, NewBareRepository(bare), "file://"+bare+"/pull/1")
+}
+
+// newTestBareRepository returns the path of a bare repository with a branch main
+func newTestBareRepository(t *testing.T) string {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	dir := t.TempDir()
+	work := filepath.Join(dir, "work")
+	for file, content := range map[string]string{
+		"dev/values.yaml":     "image: 1.0\n",
+		"staging/values.yaml": "image: 0.9\n",
+		"staging/old.yaml":    "old: true\n",
+	} {
+		if err := os.MkdirAll(filepath.Join(work, filepath.Dir(file)), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(work, file), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, args := range [][]string{
+		{"init", "-q", "-b", "main", work},
+		{"-C", work, "add", "."},
+		{"-C", work, "-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "-q", "-m", "init"},
+		{"clone", "-q", "--bare", work, filepath.Join(dir, "repo.git")},
+	} {
+		if out, err := exec.Command("git", args...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v failed: %v: %s", args, err, out)
+		}
+	}
+	return filepath.Join(dir, "repo.git")
+}
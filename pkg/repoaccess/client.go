@@ -2,9 +2,9 @@ package repoaccess
 
 import (
 	"context"
+	"fmt"
 	"github.com/google/go-github/github"
 	"golang.org/x/oauth2"
-	"net/url"
 	"strings"
 )
 
@@ -38,10 +38,12 @@ func NewClient(accessToken string, url string) (client Client, err error) {
 }
 
 func getGithubOwnerRepository(raw string) (owner, repository string, err error) {
-	u, err := url.Parse(raw)
+	l, err := ParseLocator(raw)
 	if err != nil {
 		return owner, repository, err
 	}
-	splittedUrl := strings.Split(u.Path, "/")
-	return splittedUrl[1], splittedUrl[2], nil
+	if strings.Contains(l.Namespace, "/") {
+		return owner, repository, fmt.Errorf("invalid github repository %s: subgroups are not supported", raw)
+	}
+	return l.Namespace, l.Name, nil
 }
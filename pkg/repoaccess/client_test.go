@@ -22,6 +22,36 @@ func Test_getGithubOwnerRepository(t *testing.T) {
 			wantRepository: "keptn-argo-dev",
 			wantErr:        false,
 		},
+		{
+			name: "git suffix and trailing slash",
+			args: args{
+				raw: "https://github.com/markuslackner/keptn-argo-dev.git/",
+			},
+			wantOwner:      "markuslackner",
+			wantRepository: "keptn-argo-dev",
+		},
+		{
+			name: "ssh",
+			args: args{
+				raw: "git@github.com:markuslackner/keptn-argo-dev2.git",
+			},
+			wantOwner:      "markuslackner",
+			wantRepository: "keptn-argo-dev2",
+		},
+		{
+			name: "short path",
+			args: args{
+				raw: "https://github.com/markuslackner",
+			},
+			wantErr: true,
+		},
+		{
+			name: "subgroup",
+			args: args{
+				raw: "https://github.com/markuslackner/sub/keptn-argo-dev",
+			},
+			wantErr: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -1,8 +1,12 @@
 package repoaccess
 
 import (
+	"context"
+	"fmt"
 	"github.com/google/go-github/github"
 	logger "github.com/sirupsen/logrus"
+	"strings"
+	"sync"
 )
 
 func (c *Client) CheckForNewCommits(toBranch, fromBranch string) (newCommits bool, err error) {
@@ -18,64 +22,142 @@ func (c *Client) CheckForNewCommits(toBranch, fromBranch string) (newCommits boo
 	}
 }
 
+// ChangedFile is a file changed between two branches. Patch contains the hunks of the unified diff
+type ChangedFile struct {
+	Path   string
+	Status string
+	Patch  string
+}
+
+// CompareBranches returns the files changed by the commits of fromBranch missing in toBranch
+func (c *Client) CompareBranches(toBranch, fromBranch string) (files []ChangedFile, err error) {
+	compare, _, err := c.githubInstance.client.Repositories.CompareCommits(c.githubInstance.context, c.githubInstance.owner, c.githubInstance.repository, toBranch, fromBranch)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range compare.Files {
+		files = append(files, ChangedFile{Path: f.GetFilename(), Status: f.GetStatus(), Patch: f.GetPatch()})
+	}
+	logger.WithField("func", "CompareBranches").Infof("found %d changed files in github repo %s/%s from branch %s to %s", len(files), c.githubInstance.owner, c.githubInstance.repository, fromBranch, toBranch)
+	return files, nil
+}
+
 type RepositoryFile struct {
 	Content string
 	Path    string
 	SHA     string
 }
 
+// maxParallelBlobFetches is the number of blobs GetFilesForBranch fetches at the same time
+const maxParallelBlobFetches = 8
+
+// GetFilesForBranch returns the file path or all files below the directory path (the whole repository for an empty
+// path) in branch. The files are read from the recursive tree of the current commit of branch, so all files are from
+// the same commit. If github truncates the recursive tree, the trees of the directories are read one by one. A missing
+// branch or path returns no files
 func (c *Client) GetFilesForBranch(branch, path string) (files []RepositoryFile, err error) {
 	logger.WithField("func", "GetFilesForBranch").Infof("starting with branch %s and path %s", branch, path)
-	if sourceFileContent, sourceDirContent, resp, err := c.githubInstance.client.Repositories.GetContents(c.githubInstance.context, c.githubInstance.owner, c.githubInstance.repository, path, &github.RepositoryContentGetOptions{
-		Ref: branch,
-	}); err != nil && resp.StatusCode != 404 {
-		return files, err
-	} else if resp.StatusCode == 404 {
+	b, resp, err := c.githubInstance.client.Repositories.GetBranch(c.githubInstance.context, c.githubInstance.owner, c.githubInstance.repository, branch)
+	if err != nil && resp != nil && resp.StatusCode == 404 {
 		return files, nil
-	} else if sourceFileContent != nil {
-		if content, err := sourceFileContent.GetContent(); err != nil {
+	} else if err != nil {
+		return files, err
+	}
+	commitSHA := b.GetCommit().GetSHA()
+	tree, _, err := c.githubInstance.client.Git.GetTree(c.githubInstance.context, c.githubInstance.owner, c.githubInstance.repository, commitSHA, true)
+	if err != nil {
+		return files, err
+	}
+	path = strings.Trim(path, "/")
+	entries := tree.Entries
+	if tree.GetTruncated() {
+		logger.WithField("func", "GetFilesForBranch").Infof("tree of commit %s is truncated, reading the trees of the directories", commitSHA)
+		if entries, err = c.walkTree(tree.GetSHA(), "", path); err != nil {
 			return files, err
-		} else {
-			files = append(files, RepositoryFile{
-				Content: content,
-				Path:    *sourceFileContent.Path,
-				SHA:     *sourceFileContent.SHA,
-			})
-			logger.WithField("func", "GetFilesForBranch").Infof("found file in path %s with content %s", *sourceFileContent.Path, content)
 		}
-	} else {
-		for _, sf := range sourceDirContent {
-			logger.WithField("func", "GetFilesForBranch").Infof("processing entry with path %s", *sf.Path)
-			if *sf.Type == "file" {
-				if contentsf, _, _, err := c.githubInstance.client.Repositories.GetContents(c.githubInstance.context, c.githubInstance.owner, c.githubInstance.repository, *sf.Path, &github.RepositoryContentGetOptions{}); err != nil {
-					return files, err
-				} else {
-					if content, err := contentsf.GetContent(); err != nil {
-						return files, err
-					} else {
-						files = append(files, RepositoryFile{
-							Content: content,
-							Path:    *sf.Path,
-							SHA:     *sf.SHA,
-						})
-						logger.WithField("func", "GetFilesForBranch").Infof("found file in path %s with content %s", *sf.Path, content)
-					}
-				}
-			} else if *sf.Type == "dir" {
-				if dirFiles, err := c.GetFilesForBranch(branch, *sf.Path); err != nil {
-					return files, err
-				} else {
-					files = append(files, dirFiles...)
-				}
-			} else {
-				logger.WithField("func", "GetFilesForBranch").Infof("unknown file type %s", *sf.Type)
-			}
+	}
+	for _, entry := range entries {
+		// symbolic links (mode 120000) and submodules are not files
+		if entry.GetType() != "blob" || entry.GetMode() == "120000" {
+			continue
 		}
+		if p := entry.GetPath(); path == "" || p == path || strings.HasPrefix(p, path+"/") {
+			files = append(files, RepositoryFile{Path: p, SHA: entry.GetSHA()})
+		}
+	}
+	if err := c.fetchContents(files); err != nil {
+		return nil, err
 	}
+	logger.WithField("func", "GetFilesForBranch").Infof("found %d files in path %s of commit %s", len(files), path, commitSHA)
 	return files, nil
 }
 
-func (c *Client) SyncFilesWithBranch(branch string, currentTargetFiles, newTargetFiles []RepositoryFile) (changes int, err error) {
+// walkTree returns the entries of the tree with sha and of its subtrees with the path prefixed with dir. Only the
+// subtrees containing path or contained in path are read
+func (c *Client) walkTree(sha, dir, path string) (entries []github.TreeEntry, err error) {
+	tree, _, err := c.githubInstance.client.Git.GetTree(c.githubInstance.context, c.githubInstance.owner, c.githubInstance.repository, sha, false)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range tree.Entries {
+		if dir != "" {
+			entry.Path = github.String(dir + "/" + entry.GetPath())
+		}
+		entries = append(entries, entry)
+		p := entry.GetPath()
+		if entry.GetType() != "tree" || (path != "" && p != path && !strings.HasPrefix(p, path+"/") && !strings.HasPrefix(path, p+"/")) {
+			continue
+		}
+		subtree, err := c.walkTree(entry.GetSHA(), p, path)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, subtree...)
+	}
+	return entries, nil
+}
+
+// fetchContents sets the content of the files from their blobs, at most maxParallelBlobFetches blobs are fetched at
+// the same time. The first error cancels the running fetches and no further fetches are started
+func (c *Client) fetchContents(files []RepositoryFile) error {
+	ctx, cancel := context.WithCancel(c.githubInstance.context)
+	defer cancel()
+	var wg sync.WaitGroup
+	var once sync.Once
+	var firstErr error
+	limit := make(chan struct{}, maxParallelBlobFetches)
+	for i := range files {
+		select {
+		case limit <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func(file *RepositoryFile) {
+			defer func() {
+				<-limit
+				wg.Done()
+			}()
+			content, _, err := c.githubInstance.client.Git.GetBlobRaw(ctx, c.githubInstance.owner, c.githubInstance.repository, file.SHA)
+			if err != nil {
+				once.Do(func() {
+					firstErr = fmt.Errorf("could not read file %s: %w", file.Path, err)
+					cancel()
+				})
+				return
+			}
+			file.Content = string(content)
+		}(&files[i])
+	}
+	wg.Wait()
+	return firstErr
+}
+
+// SyncFilesWithBranch creates, updates and deletes files in branch so that it contains newTargetFiles instead of
+// currentTargetFiles. Without message a message describing the operation is used for each commit
+func (c *Client) SyncFilesWithBranch(branch, message string, currentTargetFiles, newTargetFiles []RepositoryFile) (changes int, err error) {
 	changes = 0
 	logger.WithField("func", "SyncfilesWithBranch").Infof("starting for branch %s and %d currentTargetFiles and %d newTargetFiles", branch, len(currentTargetFiles), len(newTargetFiles))
 
@@ -95,7 +177,7 @@ func (c *Client) SyncFilesWithBranch(branch string, currentTargetFiles, newTarge
 		} else {
 			sourceRepositoryFile = nil
 		}
-		if changed, err := c.syncFile(branch, sourceRepositoryFile, k, &v.Content); err != nil {
+		if changed, err := c.syncFile(branch, message, sourceRepositoryFile, k, &v.Content); err != nil {
 			return changes, err
 		} else if changed {
 			changes++
@@ -103,7 +185,7 @@ func (c *Client) SyncFilesWithBranch(branch string, currentTargetFiles, newTarge
 	}
 	for k, v := range currentTargetFilesMap {
 		if _, ok := newTargetFilesMap[k]; !ok {
-			if changed, err := c.syncFile(branch, &v, k, nil); err != nil {
+			if changed, err := c.syncFile(branch, message, &v, k, nil); err != nil {
 				return changes, err
 			} else if changed {
 				changes++
@@ -113,7 +195,7 @@ func (c *Client) SyncFilesWithBranch(branch string, currentTargetFiles, newTarge
 	return changes, nil
 }
 
-func (c *Client) syncFile(branch string, currentFile *RepositoryFile, targetPath string, targetFileContent *string) (changed bool, err error) {
+func (c *Client) syncFile(branch, message string, currentFile *RepositoryFile, targetPath string, targetFileContent *string) (changed bool, err error) {
 	logger.WithField("func", "syncFile").Infof("starting with branch %s, targetPath %s", branch, targetPath)
 	if currentFile == nil && targetFileContent == nil {
 		logger.WithField("func", "syncFile").Infof("both contents are nil for branch %s and targetPath %s => doing nothing", branch, targetPath)
@@ -127,7 +209,7 @@ func (c *Client) syncFile(branch string, currentFile *RepositoryFile, targetPath
 		logger.WithField("func", "syncFile").Infof("deleting file %s in branch %s", currentFile.Path, branch)
 		if _, _, err := c.githubInstance.client.Repositories.DeleteFile(c.githubInstance.context, c.githubInstance.owner, c.githubInstance.repository,
 			currentFile.Path, &github.RepositoryContentFileOptions{
-				Message:   github.String("(build) delete file"),
+				Message:   github.String(commitMessage(message, "(build) delete file")),
 				Branch:    github.String(branch),
 				Author:    author,
 				Committer: author,
@@ -142,7 +224,7 @@ func (c *Client) syncFile(branch string, currentFile *RepositoryFile, targetPath
 			logger.WithField("func", "syncFile").Infof("creating file %s in branch %s", targetPath, branch)
 			if _, _, err := c.githubInstance.client.Repositories.CreateFile(c.githubInstance.context, c.githubInstance.owner, c.githubInstance.repository,
 				targetPath, &github.RepositoryContentFileOptions{
-					Message:   github.String("(build) create file"),
+					Message:   github.String(commitMessage(message, "(build) create file")),
 					Branch:    github.String(branch),
 					Author:    author,
 					Committer: author,
@@ -157,7 +239,7 @@ func (c *Client) syncFile(branch string, currentFile *RepositoryFile, targetPath
 				logger.WithField("func", "syncFile").Infof("updating file %s in branch %s", targetPath, branch)
 				if _, _, err := c.githubInstance.client.Repositories.UpdateFile(c.githubInstance.context, c.githubInstance.owner, c.githubInstance.repository,
 					targetPath, &github.RepositoryContentFileOptions{
-						Message:   github.String("(build) update file"),
+						Message:   github.String(commitMessage(message, "(build) update file")),
 						Branch:    github.String(branch),
 						SHA:       github.String(currentFile.SHA),
 						Author:    author,
@@ -175,3 +257,10 @@ func (c *Client) syncFile(branch string, currentFile *RepositoryFile, targetPath
 	}
 	return changed, nil
 }
+
+func commitMessage(message, defaultMessage string) string {
+	if message == "" {
+		return defaultMessage
+	}
+	return message
+}
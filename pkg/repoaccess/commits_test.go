@@ -0,0 +1,220 @@
+package repoaccess
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// slowBlob is the content of blobs the test github answers after 5 seconds unless the request is canceled
+const slowBlob = "slow"
+
+// newTestGithub returns a github API stand-in serving the branch main of test/repo with commit c1 and the files in
+// blobs. With truncated the recursive tree of c1 only contains the first entry. Requests to other paths fail the test
+func newTestGithub(t *testing.T, blobs map[string]string, truncated bool) (client *Client, blobRequests func() int, maxParallel func() int) {
+	var mutex sync.Mutex
+	requests, parallel, max := 0, 0, 0
+	// the trees of the directories of commit c1 for truncated recursive trees
+	trees := map[string]string{
+		"t1": `{"sha":"t1","tree":[
+			{"path":"README.md","mode":"100644","type":"blob","sha":"b-readme"},
+			{"path":"deploy","mode":"040000","type":"tree","sha":"t2"},
+			{"path":"deployment.yaml","mode":"100644","type":"blob","sha":"b-deployment"}
+		]}`,
+		"t2": `{"sha":"t2","tree":[
+			{"path":"app.yaml","mode":"100644","type":"blob","sha":"b-app"},
+			{"path":"dev","mode":"040000","type":"tree","sha":"t3"},
+			{"path":"link","mode":"120000","type":"blob","sha":"b-link"},
+			{"path":"module","mode":"160000","type":"commit","sha":"c2"}
+		]}`,
+		"t3": `{"sha":"t3","tree":[{"path":"values.yaml","mode":"100644","type":"blob","sha":"b-values"}]}`,
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/repos/test/repo/branches/main":
+			fmt.Fprint(w, `{"name":"main","commit":{"sha":"c1"}}`)
+		case r.URL.Path == "/repos/test/repo/git/trees/c1":
+			if r.URL.Query().Get("recursive") != "1" {
+				t.Errorf("tree requested without recursive=1")
+			}
+			if truncated {
+				fmt.Fprint(w, `{"sha":"t1","truncated":true,"tree":[{"path":"README.md","mode":"100644","type":"blob","sha":"b-readme"}]}`)
+				return
+			}
+			fmt.Fprint(w, `{"sha":"t1","truncated":false,"tree":[
+				{"path":"README.md","mode":"100644","type":"blob","sha":"b-readme"},
+				{"path":"deploy","mode":"040000","type":"tree","sha":"t2"},
+				{"path":"deploy/app.yaml","mode":"100644","type":"blob","sha":"b-app"},
+				{"path":"deploy/dev","mode":"040000","type":"tree","sha":"t3"},
+				{"path":"deploy/dev/values.yaml","mode":"100644","type":"blob","sha":"b-values"},
+				{"path":"deploy/link","mode":"120000","type":"blob","sha":"b-link"},
+				{"path":"deploy/module","mode":"160000","type":"commit","sha":"c2"},
+				{"path":"deployment.yaml","mode":"100644","type":"blob","sha":"b-deployment"}
+			]}`)
+		case strings.HasPrefix(r.URL.Path, "/repos/test/repo/git/trees/"):
+			if r.URL.Query().Get("recursive") != "" {
+				t.Errorf("subtree requested with recursive")
+			}
+			tree, ok := trees[strings.TrimPrefix(r.URL.Path, "/repos/test/repo/git/trees/")]
+			if !ok {
+				t.Errorf("unexpected request %s", r.URL)
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			fmt.Fprint(w, tree)
+		case strings.HasPrefix(r.URL.Path, "/repos/test/repo/git/blobs/"):
+			mutex.Lock()
+			requests++
+			if parallel++; parallel > max {
+				max = parallel
+			}
+			mutex.Unlock()
+			defer func() {
+				mutex.Lock()
+				parallel--
+				mutex.Unlock()
+			}()
+			content, ok := blobs[strings.TrimPrefix(r.URL.Path, "/repos/test/repo/git/blobs/")]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			if content == slowBlob {
+				select {
+				case <-r.Context().Done():
+				case <-time.After(5 * time.Second):
+				}
+			}
+			fmt.Fprint(w, content)
+		case strings.HasPrefix(r.URL.Path, "/repos/test/repo/branches/"):
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"message":"Branch not found"}`)
+		default:
+			t.Errorf("unexpected request %s", r.URL)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+	githubClient := github.NewClient(nil)
+	githubClient.BaseURL, _ = url.Parse(server.URL + "/")
+	client = &Client{githubInstance: githubInstance{owner: "test", repository: "repo", context: context.Background(), client: githubClient}}
+	return client, func() int {
+			mutex.Lock()
+			defer mutex.Unlock()
+			return requests
+		}, func() int {
+			mutex.Lock()
+			defer mutex.Unlock()
+			return max
+		}
+}
+
+func TestClient_GetFilesForBranch(t *testing.T) {
+	blobs := map[string]string{
+		"b-readme":     "readme",
+		"b-app":        "app",
+		"b-values":     "values",
+		"b-deployment": "deployment",
+	}
+	tests := []struct {
+		name      string
+		branch    string
+		path      string
+		truncated bool
+		want      []RepositoryFile
+		wantErr   bool
+	}{
+		{
+			name:   "whole repository",
+			branch: "main",
+			want: []RepositoryFile{
+				{Path: "README.md", SHA: "b-readme", Content: "readme"},
+				{Path: "deploy/app.yaml", SHA: "b-app", Content: "app"},
+				{Path: "deploy/dev/values.yaml", SHA: "b-values", Content: "values"},
+				{Path: "deployment.yaml", SHA: "b-deployment", Content: "deployment"},
+			},
+		},
+		{
+			name:   "directory",
+			branch: "main",
+			path:   "deploy/",
+			want: []RepositoryFile{
+				{Path: "deploy/app.yaml", SHA: "b-app", Content: "app"},
+				{Path: "deploy/dev/values.yaml", SHA: "b-values", Content: "values"},
+			},
+		},
+		{
+			name:   "file",
+			branch: "main",
+			path:   "deploy/dev/values.yaml",
+			want:   []RepositoryFile{{Path: "deploy/dev/values.yaml", SHA: "b-values", Content: "values"}},
+		},
+		{
+			name:   "missing path",
+			branch: "main",
+			path:   "missing",
+		},
+		{
+			name:   "missing branch",
+			branch: "missing",
+			path:   "deploy",
+		},
+		{
+			name:      "truncated tree",
+			branch:    "main",
+			truncated: true,
+			want: []RepositoryFile{
+				{Path: "README.md", SHA: "b-readme", Content: "readme"},
+				{Path: "deploy/app.yaml", SHA: "b-app", Content: "app"},
+				{Path: "deploy/dev/values.yaml", SHA: "b-values", Content: "values"},
+				{Path: "deployment.yaml", SHA: "b-deployment", Content: "deployment"},
+			},
+		},
+		{
+			name:      "directory of truncated tree",
+			branch:    "main",
+			path:      "deploy/dev",
+			truncated: true,
+			want:      []RepositoryFile{{Path: "deploy/dev/values.yaml", SHA: "b-values", Content: "values"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, _, _ := newTestGithub(t, blobs, tt.truncated)
+			got, err := client.GetFilesForBranch(tt.branch, tt.path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GetFilesForBranch() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetFilesForBranch() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClient_GetFilesForBranch_missingBlob(t *testing.T) {
+	client, blobRequests, maxParallel := newTestGithub(t, map[string]string{"b-readme": slowBlob, "b-app": slowBlob, "b-deployment": slowBlob}, false)
+	start := time.Now()
+	if _, err := client.GetFilesForBranch("main", ""); err == nil || !strings.Contains(err.Error(), "deploy/dev/values.yaml") {
+		t.Errorf("GetFilesForBranch() error = %v, want error for deploy/dev/values.yaml", err)
+	}
+	// the running fetches of the slow blobs are canceled
+	if d := time.Since(start); d > 2*time.Second {
+		t.Errorf("GetFilesForBranch() waited %s for the other blobs", d)
+	}
+	if blobRequests() == 0 {
+		t.Errorf("no blob requests")
+	}
+	if maxParallel() > maxParallelBlobFetches {
+		t.Errorf("%d parallel blob requests, want at most %d", maxParallel(), maxParallelBlobFetches)
+	}
+}
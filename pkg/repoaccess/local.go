@@ -0,0 +1,95 @@
+package repoaccess
+
+import (
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrReadOnly is returned by the methods of LocalRepository changing the repository
+var ErrReadOnly = errors.New("local repository is read-only")
+
+// LocalRepository reads the files of a local checkout. The branch is ignored, all files are read from the working
+// tree. Branches, commits and pull requests are not supported
+type LocalRepository struct {
+	dir string
+}
+
+func NewLocalRepository(dir string) *LocalRepository {
+	return &LocalRepository{dir: dir}
+}
+
+// GetFilesForBranch returns the file or all files of the directory path (like the github contents api). Paths are
+// relative to the checkout and must not leave it, a missing path returns no files. The .git directory and symbolic
+// links are skipped
+func (r *LocalRepository) GetFilesForBranch(_, path string) (files []RepositoryFile, err error) {
+	dir := filepath.Clean(r.dir)
+	root := filepath.Join(dir, filepath.FromSlash(strings.Trim(path, "/")))
+	if rel, err := filepath.Rel(dir, root); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return nil, fmt.Errorf("path %s is outside of the repository", path)
+	}
+	err = filepath.WalkDir(root, func(file string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if d.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, file)
+		if err != nil {
+			return err
+		}
+		files = append(files, RepositoryFile{Content: string(content), Path: filepath.ToSlash(rel), SHA: blobSHA(content)})
+		return nil
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	return files, err
+}
+
+func (r *LocalRepository) BranchExists(_ string) (exists bool, err error) {
+	return false, nil
+}
+
+func (r *LocalRepository) CreateBranch(_, _ string) (err error) {
+	return ErrReadOnly
+}
+
+func (r *LocalRepository) DeleteBranch(_ string) (err error) {
+	return ErrReadOnly
+}
+
+func (r *LocalRepository) SyncFilesWithBranch(_, _ string, _, _ []RepositoryFile) (changes int, err error) {
+	return 0, ErrReadOnly
+}
+
+func (r *LocalRepository) CreatePullRequest(_, _, _, _ string) (pr *PullRequest, err error) {
+	return nil, ErrReadOnly
+}
+
+func (r *LocalRepository) AddLabels(_ *PullRequest, _ []string) error {
+	return ErrReadOnly
+}
+
+// blobSHA returns the git object id of the content
+func blobSHA(content []byte) string {
+	h := sha1.New()
+	fmt.Fprintf(h, "blob %d\x00", len(content))
+	h.Write(content)
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
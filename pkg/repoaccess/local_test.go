@@ -0,0 +1,79 @@
+package repoaccess
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLocalRepository_GetFilesForBranch(t *testing.T) {
+	dir := t.TempDir()
+	for file, content := range map[string]string{
+		"dev/values.yaml":      "image: nginx\n",
+		"dev/sub/chart.yaml":   "version: 1.0.0\n",
+		"staging/values.yaml":  "image: nginx\n",
+		".git/config":          "[core]\n",
+		"dev/.git/ignored.txt": "ignored\n",
+	} {
+		if err := os.MkdirAll(filepath.Join(dir, filepath.Dir(file)), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, file), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		name      string
+		path      string
+		wantPaths []string
+	}{
+		{name: "directory", path: "dev", wantPaths: []string{"dev/sub/chart.yaml", "dev/values.yaml"}},
+		{name: "file", path: "/staging/values.yaml/", wantPaths: []string{"staging/values.yaml"}},
+		{name: "missing path", path: "production"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files, err := NewLocalRepository(dir).GetFilesForBranch("main", tt.path)
+			if err != nil {
+				t.Fatalf("GetFilesForBranch() error = %v", err)
+			}
+			var gotPaths []string
+			for _, f := range files {
+				gotPaths = append(gotPaths, f.Path)
+			}
+			if !reflect.DeepEqual(gotPaths, tt.wantPaths) {
+				t.Errorf("GetFilesForBranch() paths = %v, want %v", gotPaths, tt.wantPaths)
+			}
+		})
+	}
+}
+
+func TestLocalRepository_GetFilesForBranch_outside(t *testing.T) {
+	parent := t.TempDir()
+	dir := filepath.Join(parent, "checkout")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(parent, "secret.txt"), []byte("secret\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(parent, "secret.txt"), filepath.Join(dir, "link.txt")); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{"..", "../secret.txt", "dev/../../secret.txt"} {
+		if files, err := NewLocalRepository(dir).GetFilesForBranch("main", path); err == nil {
+			t.Errorf("GetFilesForBranch(%q) = %v, want error", path, files)
+		}
+	}
+	if files, err := NewLocalRepository(dir).GetFilesForBranch("main", ""); err != nil || len(files) != 0 {
+		t.Errorf("GetFilesForBranch() = %v, %v, want symbolic link skipped", files, err)
+	}
+}
+
+func Test_blobSHA(t *testing.T) {
+	// git hash-object of "hello\n"
+	if got := blobSHA([]byte("hello\n")); got != "ce013625030ba8dba906f756967f9e9ca394464a" {
+		t.Errorf("blobSHA() = %v", got)
+	}
+}
@@ -0,0 +1,130 @@
+package repoaccess
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Protocols of a Locator
+const (
+	ProtocolHTTPS = "https"
+	ProtocolHTTP  = "http"
+	ProtocolSSH   = "ssh"
+)
+
+var errMissingPath = errors.New("owner or group and repository name are missing")
+
+// Locator identifies a repository independent of the syntax of its URL
+type Locator struct {
+	Protocol string
+	// User is the user of SSH URLs (e.g. git)
+	User string
+	// Host is the host name without port
+	Host string
+	// Port is empty for the default port of the protocol
+	Port string
+	// Namespace is the owner of the repository or the path of the group including subgroups (e.g. group/subgroup)
+	Namespace string
+	// Name is the name of the repository without .git suffix
+	Name string
+}
+
+// ParseLocator parses https://host/namespace/name, ssh://[user@]host[:port]/namespace/name and the scp-like syntax
+// [user@]host:namespace/name of SSH URLs. A .git suffix and trailing slashes are removed
+func ParseLocator(raw string) (l Locator, err error) {
+	raw = strings.TrimSpace(raw)
+	var path string
+	if strings.Contains(raw, "://") {
+		u, err := url.Parse(raw)
+		if err != nil {
+			return l, fmt.Errorf("invalid repository url %s: %w", raw, err)
+		}
+		switch u.Scheme {
+		case ProtocolHTTPS, ProtocolHTTP, ProtocolSSH:
+		default:
+			return l, fmt.Errorf("invalid repository url %s: unsupported protocol %s", raw, u.Scheme)
+		}
+		if u.RawQuery != "" || u.Fragment != "" {
+			return l, fmt.Errorf("invalid repository url %s: query and fragment are not supported", raw)
+		}
+		l.Protocol, l.Host, l.Port, path = u.Scheme, u.Hostname(), u.Port(), u.Path
+		if u.User != nil {
+			l.User = u.User.Username()
+		}
+	} else {
+		// the host of the scp-like syntax is everything before the first colon, which must come before the first slash
+		colon := strings.Index(raw, ":")
+		if colon <= 0 || strings.Contains(raw[:colon], "/") {
+			return l, fmt.Errorf("invalid repository url %s", raw)
+		}
+		l.Protocol, l.Host, path = ProtocolSSH, raw[:colon], raw[colon+1:]
+		if at := strings.LastIndex(l.Host, "@"); at >= 0 {
+			l.User, l.Host = l.Host[:at], l.Host[at+1:]
+		}
+	}
+	if l.Host == "" {
+		return l, fmt.Errorf("invalid repository url %s: host is missing", raw)
+	}
+
+	path = strings.TrimSuffix(strings.Trim(path, "/"), ".git")
+	slash := strings.LastIndex(path, "/")
+	if slash <= 0 || slash == len(path)-1 {
+		return l, fmt.Errorf("invalid repository url %s: %w", raw, errMissingPath)
+	}
+	l.Namespace, l.Name = path[:slash], path[slash+1:]
+	for _, segment := range strings.Split(path, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return l, fmt.Errorf("invalid repository url %s: invalid path", raw)
+		}
+	}
+	return l, nil
+}
+
+// IsSSH returns true if the repository is accessed over SSH
+func (l Locator) IsSSH() bool {
+	return l.Protocol == ProtocolSSH
+}
+
+// Path returns namespace and name separated by a slash
+func (l Locator) Path() string {
+	return l.Namespace + "/" + l.Name
+}
+
+// String returns the URL of the repository. SSH URLs without port are formatted with the scp-like syntax and a .git
+// suffix
+func (l Locator) String() string {
+	switch {
+	case l.IsSSH() && l.Port == "":
+		return userPrefix(l.User) + l.Host + ":" + l.Path() + ".git"
+	case l.IsSSH():
+		return "ssh://" + userPrefix(l.User) + l.Host + ":" + l.Port + "/" + l.Path() + ".git"
+	default:
+		return l.Protocol + "://" + l.hostPort() + "/" + l.Path()
+	}
+}
+
+// HTTPSURL returns the https URL of the repository (e.g. to access the API of the provider for an SSH URL). The port
+// of SSH URLs is not used
+func (l Locator) HTTPSURL() string {
+	host := l.Host
+	if !l.IsSSH() {
+		host = l.hostPort()
+	}
+	return ProtocolHTTPS + "://" + host + "/" + l.Path()
+}
+
+func (l Locator) hostPort() string {
+	if l.Port == "" {
+		return l.Host
+	}
+	return l.Host + ":" + l.Port
+}
+
+func userPrefix(user string) string {
+	if user == "" {
+		return ""
+	}
+	return user + "@"
+}
@@ -0,0 +1,87 @@
+package repoaccess
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseLocator(t *testing.T) {
+	tests := []struct {
+		raw       string
+		want      Locator
+		wantURL   string
+		wantHTTPS string
+		wantErr   bool
+	}{
+		{
+			raw:       "https://github.com/test/repo",
+			want:      Locator{Protocol: ProtocolHTTPS, Host: "github.com", Namespace: "test", Name: "repo"},
+			wantURL:   "https://github.com/test/repo",
+			wantHTTPS: "https://github.com/test/repo",
+		},
+		{
+			raw:       "https://github.com/test/repo2.git/",
+			want:      Locator{Protocol: ProtocolHTTPS, Host: "github.com", Namespace: "test", Name: "repo2"},
+			wantURL:   "https://github.com/test/repo2",
+			wantHTTPS: "https://github.com/test/repo2",
+		},
+		{
+			raw:       "http://gitlab.example.com:8080/group/sub/repo",
+			want:      Locator{Protocol: ProtocolHTTP, Host: "gitlab.example.com", Port: "8080", Namespace: "group/sub", Name: "repo"},
+			wantURL:   "http://gitlab.example.com:8080/group/sub/repo",
+			wantHTTPS: "https://gitlab.example.com:8080/group/sub/repo",
+		},
+		{
+			raw:       "git@github.com:test/repo.git",
+			want:      Locator{Protocol: ProtocolSSH, User: "git", Host: "github.com", Namespace: "test", Name: "repo"},
+			wantURL:   "git@github.com:test/repo.git",
+			wantHTTPS: "https://github.com/test/repo",
+		},
+		{
+			raw:       "ssh://git@gitlab.example.com:2222/group/sub/repo.git",
+			want:      Locator{Protocol: ProtocolSSH, User: "git", Host: "gitlab.example.com", Port: "2222", Namespace: "group/sub", Name: "repo"},
+			wantURL:   "ssh://git@gitlab.example.com:2222/group/sub/repo.git",
+			wantHTTPS: "https://gitlab.example.com/group/sub/repo",
+		},
+		{
+			raw:       "ssh://github.com/test/repo",
+			want:      Locator{Protocol: ProtocolSSH, Host: "github.com", Namespace: "test", Name: "repo"},
+			wantURL:   "github.com:test/repo.git",
+			wantHTTPS: "https://github.com/test/repo",
+		},
+		{raw: "https://github.com/test", wantErr: true},
+		{raw: "https://github.com/", wantErr: true},
+		{raw: "https://github.com", wantErr: true},
+		{raw: "https://github.com/test//repo", wantErr: true},
+		{raw: "https://github.com/test/../repo", wantErr: true},
+		{raw: "https://github.com/test/repo?ref=main", wantErr: true},
+		{raw: "ftp://github.com/test/repo", wantErr: true},
+		{raw: "https:///test/repo", wantErr: true},
+		{raw: "/tmp/repo:1", wantErr: true},
+		{raw: "git@github.com:repo.git", wantErr: true},
+		{raw: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			got, err := ParseLocator(tt.raw)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseLocator() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseLocator() = %+v, want %+v", got, tt.want)
+			}
+			if got.String() != tt.wantURL {
+				t.Errorf("String() = %v, want %v", got.String(), tt.wantURL)
+			}
+			if got.HTTPSURL() != tt.wantHTTPS {
+				t.Errorf("HTTPSURL() = %v, want %v", got.HTTPSURL(), tt.wantHTTPS)
+			}
+			if again, err := ParseLocator(got.String()); err != nil || !reflect.DeepEqual(again, got) {
+				t.Errorf("ParseLocator(String()) = %+v, %v, want %+v", again, err, got)
+			}
+		})
+	}
+}
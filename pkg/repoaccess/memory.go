@@ -0,0 +1,188 @@
+package repoaccess
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// MemoryRepository is a repository held in memory (e.g. to replay promotions). Branches contain the files by path,
+// pull requests get the URL memory://pull/<number>
+type MemoryRepository struct {
+	pullRequestStore
+	branches map[string]map[string]string
+}
+
+func NewMemoryRepository() *MemoryRepository {
+	return &MemoryRepository{pullRequestStore: pullRequestStore{urlPrefix: "memory:/"}, branches: make(map[string]map[string]string)}
+}
+
+// SetFile creates or updates the file in the branch. The branch is created if it does not exist
+func (r *MemoryRepository) SetFile(branch, path, content string) {
+	if r.branches[branch] == nil {
+		r.branches[branch] = make(map[string]string)
+	}
+	r.branches[branch][path] = content
+}
+
+func (r *MemoryRepository) BranchExists(branchName string) (exists bool, err error) {
+	_, exists = r.branches[branchName]
+	return exists, nil
+}
+
+func (r *MemoryRepository) CreateBranch(sourceBranch, targetBranch string) (err error) {
+	files, ok := r.branches[sourceBranch]
+	if !ok {
+		return fmt.Errorf("branch %s not found", sourceBranch)
+	}
+	r.branches[targetBranch] = make(map[string]string, len(files))
+	for path, content := range files {
+		r.branches[targetBranch][path] = content
+	}
+	return nil
+}
+
+func (r *MemoryRepository) DeleteBranch(branch string) (err error) {
+	if _, ok := r.branches[branch]; !ok {
+		return fmt.Errorf("branch %s not found", branch)
+	}
+	delete(r.branches, branch)
+	return nil
+}
+
+// GetFilesForBranch returns the file or all files of the directory path sorted by path
+func (r *MemoryRepository) GetFilesForBranch(branch, path string) (files []RepositoryFile, err error) {
+	branchFiles, ok := r.branches[branch]
+	if !ok {
+		return nil, fmt.Errorf("branch %s not found", branch)
+	}
+	path = strings.Trim(path, "/")
+	for p, content := range branchFiles {
+		if p == path || path == "" || strings.HasPrefix(p, path+"/") {
+			files = append(files, RepositoryFile{Path: p, Content: content, SHA: blobSHA([]byte(content))})
+		}
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	return files, nil
+}
+
+func (r *MemoryRepository) SyncFilesWithBranch(branch, _ string, currentTargetFiles, newTargetFiles []RepositoryFile) (changes int, err error) {
+	branchFiles, ok := r.branches[branch]
+	if !ok {
+		return 0, fmt.Errorf("branch %s not found", branch)
+	}
+	newPaths := make(map[string]bool)
+	for _, f := range newTargetFiles {
+		newPaths[f.Path] = true
+		if content, ok := branchFiles[f.Path]; !ok || content != f.Content {
+			branchFiles[f.Path] = f.Content
+			changes++
+		}
+	}
+	for _, f := range currentTargetFiles {
+		if _, ok := branchFiles[f.Path]; ok && !newPaths[f.Path] {
+			delete(branchFiles, f.Path)
+			changes++
+		}
+	}
+	return changes, nil
+}
+
+func (r *MemoryRepository) CheckForNewCommits(toBranch, fromBranch string) (newCommits bool, err error) {
+	files, err := r.CompareBranches(toBranch, fromBranch)
+	return len(files) > 0, err
+}
+
+// CompareBranches returns the files differing between the branches. The patches are not computed
+func (r *MemoryRepository) CompareBranches(toBranch, fromBranch string) (files []ChangedFile, err error) {
+	to, ok := r.branches[toBranch]
+	if !ok {
+		return nil, fmt.Errorf("branch %s not found", toBranch)
+	}
+	from, ok := r.branches[fromBranch]
+	if !ok {
+		return nil, fmt.Errorf("branch %s not found", fromBranch)
+	}
+	for path, content := range from {
+		if toContent, ok := to[path]; !ok {
+			files = append(files, ChangedFile{Path: path, Status: "added"})
+		} else if toContent != content {
+			files = append(files, ChangedFile{Path: path, Status: "modified"})
+		}
+	}
+	for path := range to {
+		if _, ok := from[path]; !ok {
+			files = append(files, ChangedFile{Path: path, Status: "removed"})
+		}
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	return files, nil
+}
+
+func (r *MemoryRepository) CreatePullRequest(fromBranch, toBranch, title, body string) (pr *PullRequest, err error) {
+	if _, ok := r.branches[fromBranch]; !ok {
+		return nil, fmt.Errorf("branch %s not found", fromBranch)
+	}
+	return r.create(fromBranch, toBranch, title, body), nil
+}
+
+// pullRequestStore keeps the pull requests of repositories without pull requests (memory and bare git)
+type pullRequestStore struct {
+	urlPrefix    string
+	pullRequests []storedPullRequest
+}
+
+type storedPullRequest struct {
+	PullRequest
+	fromBranch string
+	toBranch   string
+	body       string
+	labels     []string
+}
+
+func (s *pullRequestStore) GetOpenPullRequest(fromBranch, toBranch string) (pr *PullRequest, err error) {
+	for _, p := range s.pullRequests {
+		if p.fromBranch == fromBranch && p.toBranch == toBranch {
+			found := p.PullRequest
+			return &found, nil
+		}
+	}
+	return nil, nil
+}
+
+func (s *pullRequestStore) EditPullRequest(pr *PullRequest, title, body string) error {
+	p, err := s.pullRequest(pr)
+	if err != nil {
+		return err
+	}
+	p.Title, p.body = title, body
+	return nil
+}
+
+func (s *pullRequestStore) AddLabels(pr *PullRequest, labels []string) error {
+	p, err := s.pullRequest(pr)
+	if err != nil {
+		return err
+	}
+	p.labels = append(p.labels, labels...)
+	return nil
+}
+
+func (s *pullRequestStore) create(fromBranch, toBranch, title, body string) *PullRequest {
+	number := len(s.pullRequests) + 1
+	s.pullRequests = append(s.pullRequests, storedPullRequest{
+		PullRequest: PullRequest{Number: number, Title: title, URL: fmt.Sprintf("%s/pull/%d", s.urlPrefix, number)},
+		fromBranch:  fromBranch,
+		toBranch:    toBranch,
+		body:        body,
+	})
+	created := s.pullRequests[number-1].PullRequest
+	return &created
+}
+
+func (s *pullRequestStore) pullRequest(pr *PullRequest) (*storedPullRequest, error) {
+	if pr == nil || pr.Number < 1 || pr.Number > len(s.pullRequests) {
+		return nil, fmt.Errorf("pull request not found")
+	}
+	return &s.pullRequests[pr.Number-1], nil
+}
@@ -0,0 +1,89 @@
+package repoaccess
+
+import (
+	"reflect"
+	"testing"
+)
+
+// repository contains the methods shared by MemoryRepository and BareRepository
+type repository interface {
+	BranchExists(branchName string) (exists bool, err error)
+	CreateBranch(sourceBranch, targetBranch string) (err error)
+	DeleteBranch(branch string) (err error)
+	GetFilesForBranch(branch, path string) (files []RepositoryFile, err error)
+	SyncFilesWithBranch(branch, message string, currentTargetFiles, newTargetFiles []RepositoryFile) (changes int, err error)
+	CheckForNewCommits(toBranch, fromBranch string) (newCommits bool, err error)
+	CompareBranches(toBranch, fromBranch string) (files []ChangedFile, err error)
+	CreatePullRequest(fromBranch, toBranch, title, body string) (pr *PullRequest, err error)
+	GetOpenPullRequest(fromBranch, toBranch string) (pr *PullRequest, err error)
+	AddLabels(pr *PullRequest, labels []string) error
+}
+
+func TestMemoryRepository(t *testing.T) {
+	r := NewMemoryRepository()
+	r.SetFile("main", "dev/values.yaml", "image: 1.0\n")
+	r.SetFile("main", "staging/values.yaml", "image: 0.9\n")
+	r.SetFile("main", "staging/old.yaml", "old: true\n")
+	testRepository(t, r, "memory://pull/1")
+}
+
+func testRepository(t *testing.T, r repository, wantURL string) {
+	if exists, err := r.BranchExists("promote"); err != nil || exists {
+		t.Fatalf("BranchExists() = %v, %v", exists, err)
+	}
+	if err := r.CreateBranch("main", "promote"); err != nil {
+		t.Fatalf("CreateBranch() error = %v", err)
+	}
+	current, err := r.GetFilesForBranch("promote", "staging")
+	if err != nil || len(current) != 2 {
+		t.Fatalf("GetFilesForBranch() = %v, %v", current, err)
+	}
+	changes, err := r.SyncFilesWithBranch("promote", "promote", current, []RepositoryFile{
+		{Path: "staging/values.yaml", Content: "image: 1.0\n"},
+		{Path: "staging/new.yaml", Content: "new: true\n"},
+	})
+	if err != nil || changes != 3 {
+		t.Fatalf("SyncFilesWithBranch() = %v, %v", changes, err)
+	}
+	files, err := r.GetFilesForBranch("promote", "/staging/")
+	if err != nil {
+		t.Fatalf("GetFilesForBranch() error = %v", err)
+	}
+	got := make(map[string]string)
+	for _, f := range files {
+		got[f.Path] = f.Content
+	}
+	if want := map[string]string{"staging/values.yaml": "image: 1.0\n", "staging/new.yaml": "new: true\n"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("GetFilesForBranch() = %v, want %v", got, want)
+	}
+	if newCommits, err := r.CheckForNewCommits("main", "promote"); err != nil || !newCommits {
+		t.Errorf("CheckForNewCommits() = %v, %v", newCommits, err)
+	}
+	compared, err := r.CompareBranches("main", "promote")
+	if err != nil {
+		t.Fatalf("CompareBranches() error = %v", err)
+	}
+	statuses := make(map[string]string)
+	for _, f := range compared {
+		statuses[f.Path] = f.Status
+	}
+	if want := map[string]string{"staging/new.yaml": "added", "staging/old.yaml": "removed", "staging/values.yaml": "modified"}; !reflect.DeepEqual(statuses, want) {
+		t.Errorf("CompareBranches() = %v, want %v", statuses, want)
+	}
+	pr, err := r.CreatePullRequest("promote", "main", "title", "body")
+	if err != nil || pr.URL != wantURL {
+		t.Fatalf("CreatePullRequest() = %v, %v", pr, err)
+	}
+	if err := r.AddLabels(pr, []string{"promotion"}); err != nil {
+		t.Errorf("AddLabels() error = %v", err)
+	}
+	if open, err := r.GetOpenPullRequest("promote", "main"); err != nil || open == nil || open.Number != pr.Number {
+		t.Errorf("GetOpenPullRequest() = %v, %v", open, err)
+	}
+	if err := r.DeleteBranch("promote"); err != nil {
+		t.Errorf("DeleteBranch() error = %v", err)
+	}
+	if exists, err := r.BranchExists("promote"); err != nil || exists {
+		t.Errorf("BranchExists() after delete = %v, %v", exists, err)
+	}
+}
@@ -56,3 +56,10 @@ func (c *Client) CreatePullRequest(fromBranch, toBranch, title, body string) (pr
 	}
 	return pr, nil
 }
+
+func (c *Client) AddLabels(pr *PullRequest, labels []string) error {
+	if _, _, err := c.githubInstance.client.Issues.AddLabelsToIssue(c.githubInstance.context, c.githubInstance.owner, c.githubInstance.repository, pr.Number, labels); err != nil {
+		return err
+	}
+	return nil
+}
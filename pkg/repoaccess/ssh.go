@@ -0,0 +1,144 @@
+package repoaccess
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// ErrNoPullRequests is returned by the pull request operations of an SSHRepository without pull request client
+var ErrNoPullRequests = errors.New("pull requests are not supported without access token")
+
+// PullRequestClient creates and updates pull requests through the API of the provider
+type PullRequestClient interface {
+	GetOpenPullRequest(fromBranch, toBranch string) (pr *PullRequest, err error)
+	EditPullRequest(pr *PullRequest, title, body string) error
+	CreatePullRequest(fromBranch, toBranch, title, body string) (pr *PullRequest, err error)
+	AddLabels(pr *PullRequest, labels []string) error
+}
+
+// SSHRepository accesses a repository over SSH with a deploy key. The repository is cloned bare to a temporary
+// directory, branches are created, committed and deleted in the clone and pushed immediately. Pull requests are
+// created with PullRequests, without PullRequests ErrNoPullRequests is returned. Close removes the clone
+type SSHRepository struct {
+	*BareRepository
+	// PullRequests is optional and creates the pull requests
+	PullRequests PullRequestClient
+	url          string
+	tempDir      string
+}
+
+// NewSSHRepository clones the repository with the private key (PEM or OpenSSH format without passphrase). The host
+// key of the server must be in knownHosts. The git and ssh command line tools are used
+func NewSSHRepository(repositoryURL string, privateKey, knownHosts []byte) (*SSHRepository, error) {
+	if _, err := ssh.ParsePrivateKey(privateKey); err != nil {
+		return nil, fmt.Errorf("invalid private key: %w", err)
+	}
+	if len(bytes.TrimSpace(knownHosts)) == 0 {
+		return nil, errors.New("known_hosts is missing")
+	}
+	tempDir, err := os.MkdirTemp("", "git-promotion-ssh-")
+	if err != nil {
+		return nil, err
+	}
+	keyFile, knownHostsFile := filepath.Join(tempDir, "id"), filepath.Join(tempDir, "known_hosts")
+	if err := os.WriteFile(keyFile, privateKey, 0o600); err != nil {
+		os.RemoveAll(tempDir)
+		return nil, err
+	}
+	if err := os.WriteFile(knownHostsFile, knownHosts, 0o600); err != nil {
+		os.RemoveAll(tempDir)
+		return nil, err
+	}
+	sshCommand := fmt.Sprintf("ssh -F /dev/null -i %s -o IdentitiesOnly=yes -o UserKnownHostsFile=%s -o StrictHostKeyChecking=yes -o BatchMode=yes",
+		shellQuote(keyFile), shellQuote(knownHostsFile))
+	return cloneRepository(repositoryURL, tempDir, []string{"GIT_SSH_COMMAND=" + sshCommand, "GIT_TERMINAL_PROMPT=0"})
+}
+
+// cloneRepository clones the repository bare to tempDir. The clone is partial, only commits and trees are fetched and
+// the blobs of the files read by the promotion are fetched on demand. env is used for all git commands
+func cloneRepository(repositoryURL, tempDir string, env []string) (*SSHRepository, error) {
+	dir := filepath.Join(tempDir, "repository.git")
+	cmd := exec.Command("git", "clone", "--bare", "--quiet", "--filter=blob:none", "--no-tags", "--", repositoryURL, dir)
+	cmd.Env = append(os.Environ(), env...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		os.RemoveAll(tempDir)
+		return nil, fmt.Errorf("could not clone %s: %w: %s", repositoryURL, err, strings.TrimSpace(stderr.String()))
+	}
+	bare := NewBareRepository(dir)
+	bare.env = env
+	return &SSHRepository{BareRepository: bare, url: repositoryURL, tempDir: tempDir}, nil
+}
+
+// Close removes the clone and the key files
+func (r *SSHRepository) Close() error {
+	return os.RemoveAll(r.tempDir)
+}
+
+func (r *SSHRepository) push(refspecs ...string) error {
+	_, err := r.git("", nil, append([]string{"push", "--quiet", "--porcelain", r.url}, refspecs...)...)
+	return err
+}
+
+func (r *SSHRepository) CreateBranch(sourceBranch, targetBranch string) (err error) {
+	if err := r.BareRepository.CreateBranch(sourceBranch, targetBranch); err != nil {
+		return err
+	}
+	return r.push("refs/heads/" + targetBranch + ":refs/heads/" + targetBranch)
+}
+
+func (r *SSHRepository) DeleteBranch(branch string) (err error) {
+	if err := r.push(":refs/heads/" + branch); err != nil {
+		return err
+	}
+	return r.BareRepository.DeleteBranch(branch)
+}
+
+func (r *SSHRepository) SyncFilesWithBranch(branch, message string, currentTargetFiles, newTargetFiles []RepositoryFile) (changes int, err error) {
+	if changes, err = r.BareRepository.SyncFilesWithBranch(branch, message, currentTargetFiles, newTargetFiles); err != nil || changes == 0 {
+		return changes, err
+	}
+	return changes, r.push("refs/heads/" + branch + ":refs/heads/" + branch)
+}
+
+// GetOpenPullRequest returns no pull request without pull request client
+func (r *SSHRepository) GetOpenPullRequest(fromBranch, toBranch string) (pr *PullRequest, err error) {
+	if r.PullRequests == nil {
+		return nil, nil
+	}
+	return r.PullRequests.GetOpenPullRequest(fromBranch, toBranch)
+}
+
+func (r *SSHRepository) EditPullRequest(pr *PullRequest, title, body string) error {
+	if r.PullRequests == nil {
+		return ErrNoPullRequests
+	}
+	return r.PullRequests.EditPullRequest(pr, title, body)
+}
+
+func (r *SSHRepository) CreatePullRequest(fromBranch, toBranch, title, body string) (pr *PullRequest, err error) {
+	if r.PullRequests == nil {
+		return nil, ErrNoPullRequests
+	}
+	return r.PullRequests.CreatePullRequest(fromBranch, toBranch, title, body)
+}
+
+func (r *SSHRepository) AddLabels(pr *PullRequest, labels []string) error {
+	if r.PullRequests == nil {
+		return ErrNoPullRequests
+	}
+	return r.PullRequests.AddLabels(pr, labels)
+}
+
+// shellQuote quotes s for GIT_SSH_COMMAND, which is run by the shell
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
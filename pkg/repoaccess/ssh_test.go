@@ -0,0 +1,55 @@
+package repoaccess
+
+import (
+	"errors"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSSHRepository(t *testing.T) {
+	remote := newTestBareRepository(t)
+	// the partial clone fetches the blobs on demand from the remote
+	if out, err := exec.Command("git", "-C", remote, "config", "uploadpack.allowFilter", "true").CombinedOutput(); err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+	r, err := cloneRepository("file://"+remote, t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if out, err := r.git("", nil, "rev-list", "--objects", "--missing=print", "--all"); err != nil || !strings.Contains(out, "?") {
+		t.Errorf("clone is not partial: %v, %s", err, out)
+	}
+	if _, err := r.CreatePullRequest("main", "main", "title", "body"); !errors.Is(err, ErrNoPullRequests) {
+		t.Errorf("CreatePullRequest() error = %v, want %v", err, ErrNoPullRequests)
+	}
+	if pr, err := r.GetOpenPullRequest("main", "main"); pr != nil || err != nil {
+		t.Errorf("GetOpenPullRequest() = %v, %v", pr, err)
+	}
+
+	r.PullRequests = r.BareRepository
+	testRepository(t, r, "file://"+filepath.Join(r.tempDir, "repository.git")+"/pull/1")
+
+	// created, committed and deleted branches are pushed to the remote
+	pushed := NewBareRepository(remote)
+	if exists, err := pushed.BranchExists("promote"); err != nil || exists {
+		t.Errorf("BranchExists() of remote = %v, %v", exists, err)
+	}
+	if err := r.CreateBranch("main", "pushed"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.SyncFilesWithBranch("pushed", "", nil, []RepositoryFile{{Path: "prod/values.yaml", Content: "image: 1.0\n"}}); err != nil {
+		t.Fatal(err)
+	}
+	if files, err := pushed.GetFilesForBranch("pushed", "prod"); err != nil || len(files) != 1 || files[0].Content != "image: 1.0\n" {
+		t.Errorf("GetFilesForBranch() of remote = %v, %v", files, err)
+	}
+}
+
+func TestNewSSHRepository_invalidKey(t *testing.T) {
+	if _, err := NewSSHRepository("git@github.com:test/repo.git", []byte("invalid"), []byte("github.com ssh-ed25519 AAAA")); err == nil {
+		t.Error("NewSSHRepository() error = nil, want invalid private key")
+	}
+}
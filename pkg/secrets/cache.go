@@ -0,0 +1,192 @@
+package secrets
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	logger "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	// cacheSyncTimeout is the time to wait for the initial list of a watched secret
+	cacheSyncTimeout = 10 * time.Second
+	// cacheRetryInterval is the time after which a secret that could not be watched is watched again
+	cacheRetryInterval = time.Minute
+	// maxWatchedSecrets is the number of watched secrets, the least recently used secret is no longer watched if
+	// another secret is watched
+	maxWatchedSecrets = 100
+)
+
+// Cache reads the Kubernetes secrets of the watch namespace from an informer per secret. The informer of a secret is
+// started with the first Get and watches only this secret, so rotated secrets are used without restart and without
+// reading the secret on every event. Secrets of other namespaces and secrets that can not be watched (e.g. the role
+// does not allow list and watch) are read on every Get. Without watch namespace no secret is watched, list and watch
+// should only be granted in a dedicated namespace of the promotion secrets
+type Cache struct {
+	direct         *Kubernetes
+	watchNamespace string
+	stop           chan struct{}
+	mutex          sync.Mutex
+	watching       map[string]*watchedSecret
+	syncTimeout    time.Duration
+	retryInterval  time.Duration
+	maxWatched     int
+}
+
+// watchedSecret is the informer of a secret. ready is closed when the informer is synced or could not be synced,
+// informer and failed are not changed afterwards
+type watchedSecret struct {
+	ready    chan struct{}
+	informer cache.SharedInformer
+	failed   time.Time
+	lastUsed time.Time
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+func (w *watchedSecret) stopInformer() {
+	w.stopOnce.Do(func() { close(w.stop) })
+}
+
+// isReady returns true if the informer is synced or could not be synced
+func (w *watchedSecret) isReady() bool {
+	select {
+	case <-w.ready:
+		return true
+	default:
+		return false
+	}
+}
+
+func NewCache(client kubernetes.Interface, namespace, watchNamespace string) *Cache {
+	return &Cache{
+		direct:         NewKubernetes(client, namespace),
+		watchNamespace: watchNamespace,
+		stop:           make(chan struct{}),
+		watching:       make(map[string]*watchedSecret),
+		syncTimeout:    cacheSyncTimeout,
+		retryInterval:  cacheRetryInterval,
+		maxWatched:     maxWatchedSecrets,
+	}
+}
+
+func (c *Cache) Get(namespace, name string) (data map[string][]byte, err error) {
+	if namespace == "" {
+		namespace = c.direct.namespace
+	}
+	if c.watchNamespace == "" || namespace != c.watchNamespace {
+		return c.direct.Get(namespace, name)
+	}
+	informer := c.informer(namespace, name)
+	if informer == nil {
+		return c.direct.Get(namespace, name)
+	}
+	item, exists, err := informer.GetStore().GetByKey(namespace + "/" + name)
+	if err != nil {
+		return nil, err
+	} else if !exists {
+		return nil, fmt.Errorf("%w: %s in namespace %s", ErrNotFound, name, namespace)
+	}
+	// the cached secret is shared, the caller gets a copy of the data
+	data = make(map[string][]byte)
+	for k, v := range item.(*corev1.Secret).Data {
+		data[k] = append([]byte(nil), v...)
+	}
+	return data, nil
+}
+
+// Stop stops all informers
+func (c *Cache) Stop() {
+	close(c.stop)
+}
+
+// informer returns the synced informer of the secret or nil if the secret can not be watched. The informer is started
+// and synced by the first caller without holding the lock, concurrent callers for the same secret wait for it
+func (c *Cache) informer(namespace, name string) cache.SharedInformer {
+	key := namespace + "/" + name
+	c.mutex.Lock()
+	w, ok := c.watching[key]
+	if ok && w.isReady() && w.informer == nil && time.Since(w.failed) >= c.retryInterval {
+		delete(c.watching, key)
+		ok = false
+	}
+	if ok {
+		w.lastUsed = time.Now()
+		c.mutex.Unlock()
+		<-w.ready
+		return w.informer
+	}
+	c.evict()
+	w = &watchedSecret{ready: make(chan struct{}), lastUsed: time.Now(), stop: make(chan struct{})}
+	c.watching[key] = w
+	c.mutex.Unlock()
+
+	c.start(w, namespace, name)
+	return w.informer
+}
+
+// evict stops the least recently used informers until another secret can be watched, c.mutex must be held
+func (c *Cache) evict() {
+	for len(c.watching) >= c.maxWatched {
+		var oldestKey string
+		var oldest *watchedSecret
+		for key, w := range c.watching {
+			if w.isReady() && (oldest == nil || w.lastUsed.Before(oldest.lastUsed)) {
+				oldestKey, oldest = key, w
+			}
+		}
+		if oldest == nil {
+			// all informers are syncing
+			return
+		}
+		logger.WithField("func", "Cache.evict").Infof("no longer watching secret %s", oldestKey)
+		oldest.stopInformer()
+		delete(c.watching, oldestKey)
+	}
+}
+
+// start runs the informer of the secret and closes w.ready when it is synced or could not be synced
+func (c *Cache) start(w *watchedSecret, namespace, name string) {
+	defer close(w.ready)
+	selector := fields.OneTermEqualSelector("metadata.name", name).String()
+	secrets := c.direct.client.CoreV1().Secrets(namespace)
+	informer := cache.NewSharedInformer(&cache.ListWatch{
+		ListFunc: func(options v1.ListOptions) (runtime.Object, error) {
+			options.FieldSelector = selector
+			return secrets.List(context.Background(), options)
+		},
+		WatchFunc: func(options v1.ListOptions) (watch.Interface, error) {
+			options.FieldSelector = selector
+			return secrets.Watch(context.Background(), options)
+		},
+	}, &corev1.Secret{}, 0)
+	go informer.Run(w.stop)
+	go func() {
+		select {
+		case <-c.stop:
+			w.stopInformer()
+		case <-w.stop:
+		}
+	}()
+	syncTimeout := make(chan struct{})
+	timer := time.AfterFunc(c.syncTimeout, func() { close(syncTimeout) })
+	synced := cache.WaitForCacheSync(syncTimeout, informer.HasSynced)
+	timer.Stop()
+	if !synced {
+		logger.WithField("func", "Cache.start").Warnf("could not watch secret %s in namespace %s, reading it on every event for %s", name, namespace, c.retryInterval)
+		w.stopInformer()
+		w.failed = time.Now()
+		return
+	}
+	logger.WithField("func", "Cache.start").Infof("watching secret %s in namespace %s", name, namespace)
+	w.informer = informer
+}
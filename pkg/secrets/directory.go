@@ -0,0 +1,56 @@
+package secrets
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Directory reads secrets mounted as directories <dir>/<name>/<key> (the layout of Kubernetes secret volumes) and
+// secrets of other namespaces from <dir>/<namespace>/<name>/<key>. The files are read on every Get, so updates of the
+// mounted secrets are used without restart
+type Directory struct {
+	dir string
+}
+
+func NewDirectory(dir string) *Directory {
+	return &Directory{dir: dir}
+}
+
+func (d *Directory) Get(namespace, name string) (data map[string][]byte, err error) {
+	if !validName(name) || (namespace != "" && !validName(namespace)) {
+		return nil, fmt.Errorf("invalid secret name %q in namespace %q", name, namespace)
+	}
+	secretDir := filepath.Join(d.dir, namespace, name)
+	entries, err := os.ReadDir(secretDir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s in directory %s", ErrNotFound, name, filepath.Dir(secretDir))
+	} else if err != nil {
+		return nil, err
+	}
+	data = make(map[string][]byte)
+	for _, entry := range entries {
+		// secret volumes contain the hidden directories ..data and ..<timestamp> the keys link to
+		if strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		file := filepath.Join(secretDir, entry.Name())
+		if info, err := os.Stat(file); err != nil {
+			return nil, err
+		} else if info.IsDir() {
+			continue
+		}
+		if data[entry.Name()], err = os.ReadFile(file); err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+// validName returns true if name can be used as directory name without leaving the directory
+func validName(name string) bool {
+	return name != "" && name == filepath.Base(name) && !strings.HasPrefix(name, ".")
+}
@@ -0,0 +1,65 @@
+package secrets
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// DefaultEnvPrefix is the prefix of the environment variables read by Env
+const DefaultEnvPrefix = "GIT_PROMOTION_SECRET_"
+
+// envKeySeparator separates the name of the secret and the key in the environment variables read by Env
+const envKeySeparator = "__"
+
+// Env reads secrets from environment variables <prefix><NAME>__<key>. The name is upper case with all characters
+// except letters and digits replaced by _, the key is used as written (e.g. GIT_PROMOTION_SECRET_GKE_TEST__access-token
+// is the key access-token of the secret gke-test). Keys containing __ are ignored, so the variables of a secret are
+// never read as keys of a secret with a shorter name. Other namespaces are not supported
+type Env struct {
+	prefix  string
+	environ func() []string
+}
+
+func NewEnv(prefix string) *Env {
+	return &Env{prefix: prefix, environ: os.Environ}
+}
+
+func (e *Env) Get(namespace, name string) (data map[string][]byte, err error) {
+	if namespace != "" {
+		return nil, fmt.Errorf("secret %s: namespaces are not supported by environment variables", name)
+	}
+	prefix := e.prefix + envName(name) + envKeySeparator
+	for _, variable := range e.environ() {
+		parts := strings.SplitN(variable, "=", 2)
+		if len(parts) != 2 || !strings.HasPrefix(parts[0], prefix) {
+			continue
+		}
+		key := strings.TrimPrefix(parts[0], prefix)
+		if key == "" || strings.Contains(key, envKeySeparator) {
+			continue
+		}
+		if data == nil {
+			data = make(map[string][]byte)
+		}
+		data[key] = []byte(parts[1])
+	}
+	if data == nil {
+		return nil, fmt.Errorf("%w: %s (environment variables %s*)", ErrNotFound, name, prefix)
+	}
+	return data, nil
+}
+
+// envName returns name in upper case with all characters except letters and digits replaced by _
+func envName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		default:
+			return '_'
+		}
+	}, name)
+}
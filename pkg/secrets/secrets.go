@@ -0,0 +1,80 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// ErrNotFound is returned by a Source if the secret does not exist
+var ErrNotFound = errors.New("secret not found")
+
+// ErrKeyNotFound is returned by Value if the secret does not contain the key or the value is empty
+var ErrKeyNotFound = errors.New("key not found in secret")
+
+// Source reads the data of secrets by namespace and name. The empty namespace is the default namespace of the source
+type Source interface {
+	Get(namespace, name string) (data map[string][]byte, err error)
+}
+
+// Value returns the value of the key of the secret. A missing key or an empty value is reported with ErrKeyNotFound
+func Value(source Source, namespace, name, key string) ([]byte, error) {
+	data, err := source.Get(namespace, name)
+	if err != nil {
+		return nil, err
+	}
+	if len(data[key]) == 0 {
+		keys := make([]string, 0, len(data))
+		for k := range data {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		if _, ok := data[key]; ok {
+			return nil, fmt.Errorf("%w: %s in secret %s is empty", ErrKeyNotFound, key, name)
+		}
+		return nil, fmt.Errorf("%w: %s not found in secret %s (available keys: %s)", ErrKeyNotFound, key, name, strings.Join(keys, ", "))
+	}
+	return data[key], nil
+}
+
+// Kubernetes reads the secrets of a namespace
+type Kubernetes struct {
+	client    kubernetes.Interface
+	namespace string
+}
+
+func NewKubernetes(client kubernetes.Interface, namespace string) *Kubernetes {
+	return &Kubernetes{client: client, namespace: namespace}
+}
+
+func (k *Kubernetes) Get(namespace, name string) (data map[string][]byte, err error) {
+	if namespace == "" {
+		namespace = k.namespace
+	}
+	secret, err := k.client.CoreV1().Secrets(namespace).Get(context.Background(), name, v1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		return nil, fmt.Errorf("%w: %s in namespace %s", ErrNotFound, name, namespace)
+	} else if err != nil {
+		return nil, err
+	}
+	return secret.Data, nil
+}
+
+// Static contains the data of the secrets by name or by <namespace>/<name> for other namespaces (e.g. for replays)
+type Static map[string]map[string][]byte
+
+func (s Static) Get(namespace, name string) (data map[string][]byte, err error) {
+	if namespace != "" {
+		name = namespace + "/" + name
+	}
+	if data, ok := s[name]; ok {
+		return data, nil
+	}
+	return nil, fmt.Errorf("%w: %s", ErrNotFound, name)
+}
@@ -0,0 +1,277 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestKubernetes_Get(t *testing.T) {
+	client := fake.NewSimpleClientset(&corev1.Secret{
+		ObjectMeta: v1.ObjectMeta{Name: "github", Namespace: "keptn"},
+		Data:       map[string][]byte{"access-token": []byte("token")},
+	})
+	data, err := NewKubernetes(client, "keptn").Get("", "github")
+	if err != nil || !reflect.DeepEqual(data, map[string][]byte{"access-token": []byte("token")}) {
+		t.Errorf("Get() = %v, %v", data, err)
+	}
+	if _, err := NewKubernetes(client, "other").Get("", "github"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get() error = %v, want %v", err, ErrNotFound)
+	}
+	if data, err := NewKubernetes(client, "other").Get("keptn", "github"); err != nil || string(data["access-token"]) != "token" {
+		t.Errorf("Get() = %v, %v", data, err)
+	}
+	if _, err := NewKubernetes(client, "keptn").Get("other", "github"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get() error = %v, want %v", err, ErrNotFound)
+	}
+}
+
+func TestStatic_Get(t *testing.T) {
+	s := Static{"github": {"access-token": []byte("token")}}
+	if data, err := s.Get("", "github"); err != nil || string(data["access-token"]) != "token" {
+		t.Errorf("Get() = %v, %v", data, err)
+	}
+	if _, err := s.Get("", "gitlab"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get() error = %v, want %v", err, ErrNotFound)
+	}
+}
+
+func TestDirectory_Get(t *testing.T) {
+	dir := t.TempDir()
+	// layout of a mounted secret volume: the keys link to the files in ..data
+	if err := os.MkdirAll(filepath.Join(dir, "github", "..2022_01_01", "nested"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "github", "..2022_01_01", "access-token"), []byte("token"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("..2022_01_01", filepath.Join(dir, "github", "..data")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join("..data", "access-token"), filepath.Join(dir, "github", "access-token")); err != nil {
+		t.Fatal(err)
+	}
+	data, err := NewDirectory(dir).Get("", "github")
+	if err != nil || !reflect.DeepEqual(data, map[string][]byte{"access-token": []byte("token")}) {
+		t.Errorf("Get() = %v, %v", data, err)
+	}
+	if _, err := NewDirectory(dir).Get("", "gitlab"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get() error = %v, want %v", err, ErrNotFound)
+	}
+	if _, err := NewDirectory(dir).Get("", "../github"); err == nil || errors.Is(err, ErrNotFound) {
+		t.Errorf("Get() error = %v, want invalid name", err)
+	}
+}
+
+func TestEnv_Get(t *testing.T) {
+	e := &Env{prefix: DefaultEnvPrefix, environ: func() []string {
+		return []string{
+			"GIT_PROMOTION_SECRET_GKE__access-token=gke",
+			"GIT_PROMOTION_SECRET_GKE_TEST__access-token=token",
+			"GIT_PROMOTION_SECRET_GKE_TEST__known_hosts=github.com ssh-ed25519 AAAA",
+			"GIT_PROMOTION_SECRET_GKE__TEST__access-token=other",
+			"GIT_PROMOTION_SECRET_REGISTRY__username=user",
+			"GIT_PROMOTION_SECRET_REGISTRY__password=a=b",
+			"GIT_PROMOTION_SECRET_REGISTRY__=empty",
+			"GIT_PROMOTION_SECRET_REGISTRY_TOKEN=token",
+			"HOME=/root",
+		}
+	}}
+	tests := []struct {
+		name    string
+		want    map[string][]byte
+		wantErr error
+	}{
+		{name: "gke", want: map[string][]byte{"access-token": []byte("gke")}},
+		{name: "gke-test", want: map[string][]byte{"access-token": []byte("token"), "known_hosts": []byte("github.com ssh-ed25519 AAAA")}},
+		{name: "registry", want: map[string][]byte{"username": []byte("user"), "password": []byte("a=b")}},
+		{name: "gitlab", wantErr: ErrNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := e.Get("", tt.name)
+			if !errors.Is(err, tt.wantErr) || !reflect.DeepEqual(data, tt.want) {
+				t.Errorf("Get() = %v, %v, want %v, %v", data, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+	if _, err := e.Get("other", "gke"); err == nil {
+		t.Errorf("Get() with namespace did not fail")
+	}
+}
+
+func TestCache_Get(t *testing.T) {
+	client := fake.NewSimpleClientset(&corev1.Secret{
+		ObjectMeta: v1.ObjectMeta{Name: "github", Namespace: "keptn"},
+		Data:       map[string][]byte{"access-token": []byte("token")},
+	})
+	c := NewCache(client, "keptn", "keptn")
+	defer c.Stop()
+	if data, err := c.Get("", "github"); err != nil || string(data["access-token"]) != "token" {
+		t.Errorf("Get() = %v, %v", data, err)
+	}
+	if _, err := c.Get("", "gitlab"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get() error = %v, want %v", err, ErrNotFound)
+	}
+
+	// rotated and created secrets are read from the watch
+	if _, err := client.CoreV1().Secrets("keptn").Update(context.Background(), &corev1.Secret{
+		ObjectMeta: v1.ObjectMeta{Name: "github", Namespace: "keptn"},
+		Data:       map[string][]byte{"access-token": []byte("rotated")},
+	}, v1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.CoreV1().Secrets("keptn").Create(context.Background(), &corev1.Secret{
+		ObjectMeta: v1.ObjectMeta{Name: "gitlab", Namespace: "keptn"},
+		Data:       map[string][]byte{"access-token": []byte("created")},
+	}, v1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, func() bool {
+		github, _ := c.Get("", "github")
+		gitlab, _ := c.Get("keptn", "gitlab")
+		return string(github["access-token"]) == "rotated" && string(gitlab["access-token"]) == "created"
+	})
+
+	if err := client.CoreV1().Secrets("keptn").Delete(context.Background(), "github", v1.DeleteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, func() bool {
+		_, err := c.Get("", "github")
+		return errors.Is(err, ErrNotFound)
+	})
+}
+
+func TestCache_Get_otherNamespace(t *testing.T) {
+	client := fake.NewSimpleClientset(&corev1.Secret{
+		ObjectMeta: v1.ObjectMeta{Name: "github", Namespace: "git-credentials"},
+		Data:       map[string][]byte{"access-token": []byte("token")},
+	})
+	c := NewCache(client, "keptn", "promotion-secrets")
+	defer c.Stop()
+	if data, err := c.Get("git-credentials", "github"); err != nil || string(data["access-token"]) != "token" {
+		t.Errorf("Get() = %v, %v", data, err)
+	}
+	for _, action := range client.Actions() {
+		if action.GetVerb() != "get" {
+			t.Errorf("unexpected %s of %s outside of the watch namespace", action.GetVerb(), action.GetResource().Resource)
+		}
+	}
+}
+
+func TestCache_Get_failedWatch(t *testing.T) {
+	client := fake.NewSimpleClientset(&corev1.Secret{
+		ObjectMeta: v1.ObjectMeta{Name: "github", Namespace: "keptn"},
+		Data:       map[string][]byte{"access-token": []byte("token")},
+	}, &corev1.Secret{
+		ObjectMeta: v1.ObjectMeta{Name: "slow", Namespace: "keptn"},
+		Data:       map[string][]byte{"access-token": []byte("slow")},
+	})
+	var mutex sync.Mutex
+	forbidden := true
+	client.PrependReactor("list", "secrets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		if forbidden && action.(k8stesting.ListAction).GetListRestrictions().Fields.Matches(fields.Set{"metadata.name": "slow"}) {
+			return true, nil, errors.New("forbidden")
+		}
+		return false, nil, nil
+	})
+	c := NewCache(client, "keptn", "keptn")
+	defer c.Stop()
+	c.syncTimeout, c.retryInterval = time.Second, 500*time.Millisecond
+
+	// the secret is read directly if it can not be watched, other secrets are not blocked meanwhile
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if data, err := c.Get("", "slow"); err != nil || string(data["access-token"]) != "slow" {
+			t.Errorf("Get() = %v, %v", data, err)
+		}
+	}()
+	time.Sleep(100 * time.Millisecond)
+	start := time.Now()
+	if data, err := c.Get("", "github"); err != nil || string(data["access-token"]) != "token" {
+		t.Errorf("Get() = %v, %v", data, err)
+	}
+	if d := time.Since(start); d > 500*time.Millisecond {
+		t.Errorf("Get() blocked for %s by the sync of another secret", d)
+	}
+	<-done
+	if w := c.watching["keptn/slow"]; w == nil || w.informer != nil {
+		t.Errorf("slow is watched")
+	}
+
+	// the watch is retried after the retry interval
+	mutex.Lock()
+	forbidden = false
+	mutex.Unlock()
+	eventually(t, func() bool {
+		c.Get("", "slow")
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+		w := c.watching["keptn/slow"]
+		return w != nil && w.isReady() && w.informer != nil
+	})
+}
+
+func TestCache_Get_evict(t *testing.T) {
+	client := fake.NewSimpleClientset(&corev1.Secret{
+		ObjectMeta: v1.ObjectMeta{Name: "github", Namespace: "keptn"},
+		Data:       map[string][]byte{"access-token": []byte("token")},
+	}, &corev1.Secret{
+		ObjectMeta: v1.ObjectMeta{Name: "gitlab", Namespace: "keptn"},
+		Data:       map[string][]byte{"access-token": []byte("token")},
+	})
+	c := NewCache(client, "keptn", "keptn")
+	defer c.Stop()
+	c.maxWatched = 1
+	for _, name := range []string{"github", "gitlab", "github"} {
+		if _, err := c.Get("", name); err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := c.watching["keptn/"+name]; !ok || len(c.watching) != 1 {
+			t.Errorf("watching %v after Get(%s)", c.watching, name)
+		}
+	}
+}
+
+func TestValue(t *testing.T) {
+	s := Static{"github": {"access-token": []byte("token"), "empty": nil, "user": []byte("u")}}
+	if value, err := Value(s, "", "github", "access-token"); err != nil || string(value) != "token" {
+		t.Errorf("Value() = %s, %v", value, err)
+	}
+	if _, err := Value(s, "", "github", "token"); !errors.Is(err, ErrKeyNotFound) || !strings.Contains(err.Error(), "available keys: access-token, empty, user") {
+		t.Errorf("Value() error = %v, want %v", err, ErrKeyNotFound)
+	}
+	if _, err := Value(s, "", "github", "empty"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("Value() error = %v, want %v", err, ErrKeyNotFound)
+	}
+	if _, err := Value(s, "", "gitlab", "access-token"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Value() error = %v, want %v", err, ErrNotFound)
+	}
+}
+
+func eventually(t *testing.T, condition func() bool) {
+	t.Helper()
+	for i := 0; i < 100; i++ {
+		if condition() {
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatal("condition not met")
+}